@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// UnmarshalJSON reads a job whose cmd is either a shell string or a list of arguments.
+// A list sets Args, with Cmd set to the arguments quoted for bash so the job
+// is shown, hashed and cached by its command like any other
+func (j *Job) UnmarshalJSON(b []byte) error {
+	type job Job
+	spec := struct {
+		*job
+		Cmd json.RawMessage `json:"cmd"`
+	}{job: (*job)(j)}
+	err := json.Unmarshal(b, &spec)
+	if err != nil {
+		return err
+	}
+	if len(spec.Cmd) == 0 || string(spec.Cmd) == "null" {
+		return nil
+	}
+	switch spec.Cmd[0] {
+	case '"':
+		return json.Unmarshal(spec.Cmd, &j.Cmd)
+	case '[':
+		err = json.Unmarshal(spec.Cmd, &j.Args)
+		if err != nil {
+			return fmt.Errorf("cmd: expected a string or a list of strings: %v", err)
+		}
+		j.Cmd = argsCmd(j.Args)
+		return nil
+	case '{':
+		return fmt.Errorf("cmd: expected a string or a list of strings")
+	}
+	// a yaml scalar such as true is a cmd of its text
+	j.Cmd = string(spec.Cmd)
+	return nil
+}
+
+// argsCmd returns args as a bash command executing them as they are,
+// each argument single quoted so none is interpreted by the shell
+func argsCmd(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	words := []string{"exec"}
+	for _, arg := range args {
+		words = append(words, shellQuote(arg))
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestCmdArgs(t *testing.T) {
+	defer cleanTestData(t)
+	yamlPath := writeTestYaml(t, "CmdArgs", `
+workflow_dir: .
+vars:
+  greeting: it's $(touch injected)
+jobs:
+- name: string
+  cmd: echo "shell $((1 + 1))" > string.out
+- name: list
+  cmd: ["bash", "-c", "printf '%s\n' \"$@\" > list.out", "bash", "${greeting}", "a b; touch injected"]
+`)
+	wf, err := workflowFromYaml(yamlPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectZero(t, wf.Run())
+
+	testCases := []struct {
+		output string
+		want   string
+	}{
+		{"string.out", "shell 2\n"},
+		{"list.out", "it's $(touch injected)\na b; touch injected\n"},
+	}
+	for _, tc := range testCases {
+		got, err := ioutil.ReadFile(wf.pathToWDir(tc.output))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("expected %s to be %q, got %q", tc.output, tc.want, string(got))
+		}
+	}
+	if _, err := os.Stat(wf.pathToWDir("injected")); err == nil {
+		t.Error("expected the arguments of a cmd list not to be interpreted by a shell")
+	}
+
+	loaded, err := loadWorkflowJSON(wf.WorkflowDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, j := range loaded.Jobs {
+		if j.Name == "list" && !reflect.DeepEqual(j.Args, []string{"bash", "-c", "printf '%s\n' \"$@\" > list.out",
+			"bash", "it's $(touch injected)", "a b; touch injected"}) {
+			t.Errorf("expected the workflow json to keep the substituted args, got %q", j.Args)
+		}
+	}
+}
+
+func TestCmdArgsMalformed(t *testing.T) {
+	err := ValidateWorkflowSpec([]byte("workflow_dir: out\njobs:\n- cmd: [echo, [a]]\n"))
+	if err == nil {
+		t.Error("expected an error for a cmd list of other than strings")
+	}
+}
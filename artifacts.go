@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// pathToArtifacts returns a path in the dir the job's artifacts are collected into
+func (j *Job) pathToArtifacts(s ...string) string {
+	return path.Join(append([]string{j.workflow.ArtifactsDir, j.label()}, s...)...)
+}
+
+// collectArtifacts copies the files matching each of the job's Artifacts globs into its
+// artifacts dir, replacing those of a previous run. Files in the job's work dir keep their
+// path relative to it, others are copied by name. A glob matching nothing is an error
+func (j *Job) collectArtifacts() error {
+	if len(j.Artifacts) == 0 {
+		return nil
+	}
+	err := os.RemoveAll(j.pathToArtifacts())
+	if err != nil {
+		return err
+	}
+	for _, pattern := range j.Artifacts {
+		matches, err := filepath.Glob(j.pathToOutput(pattern))
+		if err != nil {
+			return fmt.Errorf("invalid artifact '%s': %v", pattern, err)
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("missing artifact: %s", j.pathToOutput(pattern))
+		}
+		for _, match := range matches {
+			dest := filepath.Base(match)
+			if rel, err := filepath.Rel(j.workDir(), match); err == nil && !strings.HasPrefix(rel, "..") {
+				dest = rel
+			}
+			err = j.copyArtifact(match, j.pathToArtifacts(dest))
+			if err != nil {
+				return fmt.Errorf("could not collect artifact %s: %v", match, err)
+			}
+		}
+	}
+	j.infof("Collected artifacts: %s", j.pathToArtifacts())
+	return nil
+}
+
+// copyArtifact copies the file or dir at src to dest
+func (j *Job) copyArtifact(src, dest string) error {
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		target := path.Join(dest, strings.TrimPrefix(p, src))
+		if info.IsDir() {
+			return os.MkdirAll(target, j.workflow.dirMode())
+		}
+		err = os.MkdirAll(path.Dir(target), j.workflow.dirMode())
+		if err != nil {
+			return err
+		}
+		return copyFile(p, target, info.Mode().Perm())
+	})
+}
+
+func copyFile(src, dest string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
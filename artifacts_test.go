@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestArtifacts(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "Artifacts")
+	wf.KeepGoing = true
+	build := newJob(wf, []string{}, []*Job{}, []string{}, false,
+		"mkdir -p reports && echo a > reports/a.xml && echo b > reports/b.xml && echo skip > reports/c.txt && echo notes > notes.txt")
+	build.Name = "build"
+	build.Artifacts = []string{"reports/*.xml", "notes.txt"}
+	missing := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	missing.Artifacts = []string{"*.log"}
+	wf.AddJob(build, missing)
+	expectNonZero(t, wf.Run())
+
+	if build.Status != StatusSucceeded {
+		t.Fatalf("expected the job with artifacts to succeed, got %s: %s", build.Status, build.Reason)
+	}
+	artifactsDir := path.Join(wf.WorkflowDir, ".gflow", "artifacts", "build")
+	for name, want := range map[string]string{"reports/a.xml": "a\n", "reports/b.xml": "b\n", "notes.txt": "notes\n"} {
+		got, err := ioutil.ReadFile(path.Join(artifactsDir, name))
+		if err != nil {
+			t.Errorf("expected artifact %s to be collected: %v", name, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("expected artifact %s to contain %q, got %q", name, want, string(got))
+		}
+	}
+	if _, err := ioutil.ReadFile(path.Join(artifactsDir, "reports/c.txt")); err == nil {
+		t.Error("expected a file not matching the artifact globs not to be collected")
+	}
+	if missing.Status != StatusFailed || !strings.HasPrefix(missing.Reason, "missing artifact: ") {
+		t.Errorf("expected a job missing artifacts to fail, got %s: %s", missing.Status, missing.Reason)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+)
+
+// pathToCache returns a path in the workflow's CacheDir, a relative CacheDir is relative to the workflow dir
+func (w *Workflow) pathToCache(s ...string) string {
+	dir := w.CacheDir
+	if !path.IsAbs(dir) {
+		dir = w.pathToWDir(dir)
+	}
+	return path.Join(append([]string{dir}, s...)...)
+}
+
+// cacheKey returns the key of the job's entry in the cache, a hash of its command, ssh target, environment, outputs and
+// the paths and contents of its inputs as declared, so the same job in another workflow dir has the same key.
+// The environment is that of the workflow and the job, secrets are not part of the key.
+// A job with StdinFrom also hashes the contents of its stdin.
+// Jobs are only cached with a workflow CacheDir and when they have Outputs, otherwise the key is ""
+func (j *Job) cacheKey() (string, error) {
+	if j.workflow.CacheDir == "" || len(j.Outputs) == 0 {
+		return "", nil
+	}
+	h := sha256.New()
+	field := func(s string) {
+		fmt.Fprintf(h, "%d:%s\n", len(s), s)
+	}
+	field(j.shell())
+	field(j.Image)
+	field(j.sshTarget())
+	field(j.command())
+	for _, kv := range j.configEnviron() {
+		field(kv)
+	}
+	for _, output := range j.Outputs {
+		field(output)
+	}
+	for _, input := range j.Inputs {
+		field(input)
+		f, err := os.Open(j.pathToOutput(input))
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	stdin, err := j.openStdin()
+	if err != nil {
+		return "", err
+	}
+	if stdin != nil {
+		field(j.StdinFrom)
+		_, err = io.Copy(h, stdin)
+		stdin.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// restoreCache copies the job's outputs from its cache entry, returning the cache key of the job
+// and whether its outputs were restored. Errors are logged and the job is run instead
+func (j *Job) restoreCache() (string, bool) {
+	key, err := j.cacheKey()
+	if err != nil {
+		j.errorf("Failed computing cache key: %v", err)
+		return "", false
+	}
+	if key == "" {
+		return "", false
+	}
+	if _, err := os.Stat(j.workflow.pathToCache(key)); err != nil {
+		return key, false
+	}
+	for i, output := range j.Outputs {
+		dest := j.pathToOutput(output)
+		err := os.MkdirAll(path.Dir(dest), j.workflow.dirMode())
+		if err == nil {
+			err = copyFile(j.workflow.pathToCache(key, strconv.Itoa(i)), dest, j.workflow.fileMode())
+		}
+		if err != nil {
+			j.errorf("Failed restoring cache %s: %v", key, err)
+			return key, false
+		}
+	}
+	j.infof("Job Cached: outputs restored from cache %s", key)
+	j.recordEvent(EventFinished)
+	return key, true
+}
+
+// storeCache copies the outputs of the succeeded job into the cache entry key. The entry is written
+// to a tmp dir renamed into place, so an entry is never seen partially written. A job with an output
+// that is not a regular file is not cached. Errors are logged without failing the job
+func (j *Job) storeCache(key string) {
+	if key == "" {
+		return
+	}
+	w := j.workflow
+	if _, err := os.Stat(w.pathToCache(key)); err == nil {
+		return
+	}
+	err := os.MkdirAll(w.pathToCache(), w.dirMode())
+	if err != nil {
+		j.errorf("Failed storing cache %s: %v", key, err)
+		return
+	}
+	tmp, err := ioutil.TempDir(w.pathToCache(), key+".tmp")
+	if err != nil {
+		j.errorf("Failed storing cache %s: %v", key, err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+	for i, output := range j.Outputs {
+		src := j.pathToOutput(output)
+		info, err := os.Stat(src)
+		if err == nil && !info.Mode().IsRegular() {
+			j.infof("Job Not Cached: output %s is not a regular file", output)
+			return
+		}
+		if err == nil {
+			err = copyFile(src, path.Join(tmp, strconv.Itoa(i)), w.fileMode())
+		}
+		if err != nil {
+			j.errorf("Failed storing cache %s: %v", key, err)
+			return
+		}
+	}
+	err = os.Rename(tmp, w.pathToCache(key))
+	if _, statErr := os.Stat(w.pathToCache(key)); err != nil && statErr != nil {
+		j.errorf("Failed storing cache %s: %v", key, err)
+	}
+}
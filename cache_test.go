@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	defer cleanTestData(t)
+	cacheDir, err := filepath.Abs(path.Join(OutputDir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cachedWorkflow := func(name, input string) (*Workflow, *Job) {
+		wf := testWorkflow(t, name)
+		wf.CacheDir = cacheDir
+		if err := os.MkdirAll(wf.WorkflowDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(wf.pathToWDir("in.txt"), []byte(input), 0644); err != nil {
+			t.Fatal(err)
+		}
+		j := newJob(wf, []string{}, []*Job{}, []string{"out/result.txt"}, false,
+			"mkdir -p out && tr a-z A-Z < in.txt > out/result.txt")
+		j.Inputs = []string{"in.txt"}
+		wf.AddJob(j)
+		return wf, j
+	}
+	output := func(wf *Workflow) string {
+		b, err := ioutil.ReadFile(wf.pathToWDir("out", "result.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	first, j := cachedWorkflow("CacheFirst", "hello\n")
+	expectZero(t, first.Run())
+	if j.Attempts != 1 || output(first) != "HELLO\n" {
+		t.Fatalf("expected the job to run on a cache miss, attempts: %d", j.Attempts)
+	}
+
+	second, j := cachedWorkflow("CacheSecond", "hello\n")
+	expectZero(t, second.Run())
+	if j.Attempts != 0 || j.Status != StatusSucceeded {
+		t.Errorf("expected a cache hit in another workflow dir not to run the job, attempts: %d status: %s", j.Attempts, j.Status)
+	}
+	if got := output(second); got != "HELLO\n" {
+		t.Errorf("expected the cached output to be restored, got %q", got)
+	}
+	if events := jobEvents(t, second); events[j.ID][EventFinished].Type == "" {
+		t.Error("expected a restored job to be recorded as finished")
+	}
+
+	changed, j := cachedWorkflow("CacheChanged", "changed\n")
+	expectZero(t, changed.Run())
+	if j.Attempts != 1 || output(changed) != "CHANGED\n" {
+		t.Errorf("expected the job to run when its input changed, attempts: %d", j.Attempts)
+	}
+
+	env, j := cachedWorkflow("CacheWorkflowEnv", "hello\n")
+	env.Env = map[string]string{"LC_ALL": "C"}
+	expectZero(t, env.Run())
+	if j.Attempts != 1 {
+		t.Errorf("expected the job to run when the workflow env changed, attempts: %d", j.Attempts)
+	}
+}
+
+func TestCacheNotRegularOutput(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "CacheNotRegularOutput")
+	wf.CacheDir = "cache"
+	j := newJob(wf, []string{}, []*Job{}, []string{"out.txt", "dir"}, false, "echo out > out.txt; mkdir -p dir")
+	wf.AddJob(j)
+	expectZero(t, wf.Run())
+
+	entries, err := ioutil.ReadDir(wf.pathToCache())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no cache entry for a job with a dir output, got %d", len(entries))
+	}
+}
+
+func TestCacheStdinChanged(t *testing.T) {
+	defer cleanTestData(t)
+	spec := func(word string) string {
+		return `
+workflow_dir: .
+cache_dir: cache
+jobs:
+- name: a
+  cmd: echo ` + word + `
+- name: b
+  cmd: cat > b.out
+  stdin_from: a
+  outputs: [b.out]
+`
+	}
+	yamlPath := writeTestYaml(t, "CacheStdinChanged", spec("one"))
+	wf, err := workflowFromYaml(yamlPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectZero(t, wf.Run())
+
+	writeTestYaml(t, "CacheStdinChanged", spec("two"))
+	wf, err = workflowFromYaml(yamlPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectZero(t, wf.Run())
+	b, err := ioutil.ReadFile(wf.pathToWDir("b.out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "two\n" {
+		t.Errorf("expected the job to run again once its stdin changed, got %q", string(b))
+	}
+}
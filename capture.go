@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// outputRefPattern matches ${jobs.NAME.output} references to the captured output of a dependency
+var outputRefPattern = regexp.MustCompile(`\$\{jobs\.([^{}]+)\.output\}`)
+
+// isOutputRef reports whether the var name, referenced as ${name}, refers to the output of a job.
+// Such references are left for the job to resolve when it is dispatched
+func isOutputRef(name string) bool {
+	return strings.HasPrefix(name, "jobs.") && strings.HasSuffix(name, ".output")
+}
+
+// validCapture reports whether capture is empty, stdout or file:PATH
+func validCapture(capture string) bool {
+	return capture == "" || capture == "stdout" ||
+		(strings.HasPrefix(capture, "file:") && strings.TrimSpace(strings.TrimPrefix(capture, "file:")) != "")
+}
+
+// hasOutputRefs reports whether the job's cmd references the output of a job, so its command
+// is only known once its dependencies are done
+func (j *Job) hasOutputRefs() bool {
+	return outputRefPattern.MatchString(j.Cmd)
+}
+
+// command returns the job's cmd with the outputs it references substituted once they are resolved
+func (j *Job) command() string {
+	if j.resolvedCmd != "" {
+		return j.resolvedCmd
+	}
+	return j.Cmd
+}
+
+// capture records the output of a succeeded job with Capture set for its dependents:
+// the last line of its stdout log, or the contents of a file relative to its work dir.
+// It is only written by the job's own goroutine before the job is done
+func (j *Job) capture() {
+	j.output, j.outputErr = "", nil
+	if j.Capture == "" || j.Status != StatusSucceeded {
+		return
+	}
+	if j.Capture == "stdout" {
+		b, err := ioutil.ReadFile(j.StdoutLog)
+		if err != nil {
+			j.outputErr = err
+			return
+		}
+		j.output = lastLine(string(b))
+		return
+	}
+	b, err := ioutil.ReadFile(j.pathToOutput(strings.TrimSpace(strings.TrimPrefix(j.Capture, "file:"))))
+	if err != nil {
+		j.outputErr = err
+		return
+	}
+	j.output = strings.TrimRight(string(b), "\n")
+}
+
+// resolveOutputs substitutes the captured outputs of the job's dependencies for the
+// ${jobs.NAME.output} references in its cmd, rewriting its script, once they are done
+func (j *Job) resolveOutputs() error {
+	if !j.hasOutputRefs() {
+		return nil
+	}
+	deps := map[string]*Job{}
+	for _, d := range withDependencies(j.workflow.allJobs(), j.Dependencies) {
+		if d.Name != "" {
+			deps[d.Name] = d
+		}
+	}
+	var err error
+	resolve := func(s string) string {
+		return outputRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+			name := outputRefPattern.FindStringSubmatch(ref)[1]
+			d, ok := deps[name]
+			switch {
+			case !ok:
+				err = fmt.Errorf("output of job '%s' referenced, but the job does not depend on it", name)
+				return ""
+			case d.Capture == "":
+				err = fmt.Errorf("output of job '%s' referenced, but it does not capture an output", name)
+			case d.Status != StatusSucceeded:
+				err = fmt.Errorf("output of job '%s' referenced, but its status is %s", name, d.Status)
+			case d.outputErr != nil:
+				err = fmt.Errorf("could not capture the output of job '%s': %v", name, d.outputErr)
+			}
+			return d.output
+		})
+	}
+	if len(j.Args) > 0 {
+		args := []string{}
+		for _, arg := range j.Args {
+			args = append(args, resolve(arg))
+		}
+		j.resolvedCmd = argsCmd(args)
+	} else {
+		j.resolvedCmd = resolve(j.Cmd)
+	}
+	if err != nil {
+		return err
+	}
+	script, err := templateExecutable(j)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(j.pathToExec("exe"), []byte(script), j.workflow.execMode())
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCaptureOutput(t *testing.T) {
+	defer cleanTestData(t)
+	yamlPath := writeTestYaml(t, "CaptureOutput", `
+workflow_dir: .
+vars:
+  prefix: v
+jobs:
+- name: version
+  cmd: echo building; echo 1.2.3
+  capture: stdout
+- name: tag
+  depends_on: [version]
+  capture: file:tag.txt
+  cmd: echo "${prefix}${jobs.version.output}" > tag.txt
+- name: release
+  depends_on: [tag]
+  cmd: [sh, -c, 'echo "$0 $1" > release.txt', '${jobs.version.output}', '${jobs.tag.output}']
+`)
+	wf, err := workflowFromYaml(yamlPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectZero(t, wf.Run())
+	b, err := ioutil.ReadFile(wf.pathToWDir("release.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "1.2.3 v1.2.3\n" {
+		t.Errorf("expected the dependent to receive the captured outputs, got %q", string(b))
+	}
+	for _, j := range wf.allJobs()[1:] {
+		if !strings.Contains(j.Cmd, "${jobs.version.output}") {
+			t.Errorf("expected the cmd of job %s to keep its references, got %q", j.label(), j.Cmd)
+		}
+	}
+}
+
+func TestCaptureOutputNotDependency(t *testing.T) {
+	defer cleanTestData(t)
+	yamlPath := writeTestYaml(t, "CaptureOutputNotDependency", `
+workflow_dir: .
+jobs:
+- name: version
+  cmd: echo 1.2.3
+  capture: stdout
+- name: release
+  cmd: echo ${jobs.version.output}
+`)
+	wf, err := workflowFromYaml(yamlPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNonZero(t, wf.Run())
+	release := wf.allJobs()[1]
+	want := "output of job 'version' referenced, but the job does not depend on it"
+	if release.Status != StatusFailed || release.Reason != want {
+		t.Errorf("expected job to fail with reason '%s', got %s: '%s'", want, release.Status, release.Reason)
+	}
+}
+
+func TestCaptureOutputChanged(t *testing.T) {
+	defer cleanTestData(t)
+	cacheDir, err := filepath.Abs(path.Join(OutputDir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, version := range []string{"1.2.3", "1.2.4"} {
+		wf := testWorkflow(t, fmt.Sprintf("CaptureOutputChanged%d", i))
+		wf.CacheDir = cacheDir
+		wf.EventDBPath = path.Join(OutputDir, "CaptureOutputChanged.db")
+		v := newJob(wf, []string{}, []*Job{}, []string{}, false, "echo "+version)
+		v.Name = "version"
+		v.Capture = "stdout"
+		release := newJob(wf, []string{}, []*Job{v}, []string{"release.txt"}, false,
+			"echo ${jobs.version.output} > release.txt")
+		deploy := newJob(wf, []string{}, []*Job{v}, []string{}, false, "echo deploying ${jobs.version.output}")
+		deploy.SucceededWithin = Duration{time.Hour}
+		wf.AddJob(release, deploy)
+		expectZero(t, wf.Run())
+
+		if release.Attempts != 1 || deploy.Attempts != 1 {
+			t.Errorf("expected the dependents of a changed output to run, got %d and %d attempts",
+				release.Attempts, deploy.Attempts)
+		}
+		b, err := ioutil.ReadFile(wf.pathToWDir("release.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != version+"\n" {
+			t.Errorf("expected release %s, got %q", version, string(b))
+		}
+	}
+}
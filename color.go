@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// ANSI escape codes for the colors of job status lines
+const (
+	colorReset  = "\x1b[0m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+)
+
+// statusColors are the colors of log messages about a job's status, by message prefix
+var statusColors = []struct {
+	prefix string
+	color  string
+}{
+	{"Job Succeeded", colorGreen},
+	{"Workflow success", colorGreen},
+	{"Job Failed", colorRed},
+	{"Job Interrupted", colorRed},
+	{"Workflow failed", colorRed},
+	{"Workflow interrupted", colorRed},
+	{"Workflow timed out", colorRed},
+	{"Job Skipped", colorYellow},
+}
+
+// colorize colors msg if it is a status message, other messages are returned unchanged
+func colorize(msg string) string {
+	for _, c := range statusColors {
+		if strings.HasPrefix(msg, c.prefix) {
+			return c.color + msg + colorReset
+		}
+	}
+	return msg
+}
+
+// useColor reports whether output written to out should be colored:
+// out is a terminal and NO_COLOR is not set
+func useColor(out io.Writer) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	return isTerminal(out)
+}
+
+// isTerminal reports whether out is a terminal
+func isTerminal(out io.Writer) bool {
+	file, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+)
+
+// combinedLine is a line of the combined log, jobID is 0 for workflow messages
+type combinedLine struct {
+	jobID int
+	text  string
+}
+
+// combinedLog writes the output of every job and the workflow's log messages to a single file.
+// Lines are sent on a channel and written by a single goroutine, so each line is written whole
+// and lines are in the order they were sent, stamped with the time they were written.
+// A nil combinedLog discards its lines
+type combinedLog struct {
+	lines chan combinedLine
+	done  chan error
+}
+
+// openCombinedLog truncates the combined log at p and starts writing the lines sent to it
+func openCombinedLog(p string, mode os.FileMode) (*combinedLog, error) {
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, mode)
+	if err != nil {
+		return nil, err
+	}
+	c := &combinedLog{lines: make(chan combinedLine, 256), done: make(chan error, 1)}
+	go func() {
+		var err error
+		for l := range c.lines {
+			prefix := "[workflow]"
+			if l.jobID != 0 {
+				prefix = fmt.Sprintf("[job_%d]", l.jobID)
+			}
+			_, werr := fmt.Fprintf(f, "%s %s %s\n", time.Now().Format("2006/01/02 15:04:05.000000"), prefix, l.text)
+			if err == nil {
+				err = werr
+			}
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		c.done <- err
+	}()
+	return c, nil
+}
+
+// send queues a line of the job jobID for writing, it must not be called once Close has been called
+func (c *combinedLog) send(jobID int, text string) {
+	if c == nil {
+		return
+	}
+	c.lines <- combinedLine{jobID, text}
+}
+
+// Close writes the lines queued so far and closes the file, returning the first write error
+func (c *combinedLog) Close() error {
+	if c == nil {
+		return nil
+	}
+	close(c.lines)
+	return <-c.done
+}
+
+// combinedWriter sends each complete line written to it to the combined log as output of its job
+type combinedWriter struct {
+	log   *combinedLog
+	jobID int
+	buf   []byte
+}
+
+func (c *combinedWriter) Write(b []byte) (int, error) {
+	c.buf = append(c.buf, b...)
+	for {
+		i := bytes.IndexByte(c.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		c.log.send(c.jobID, string(c.buf[:i]))
+		c.buf = c.buf[i+1:]
+	}
+}
+
+// Flush sends any partial last line
+func (c *combinedWriter) Flush() error {
+	if len(c.buf) > 0 {
+		c.log.send(c.jobID, string(c.buf))
+		c.buf = nil
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCombinedLog(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "CombinedLog")
+	jobs := []*Job{}
+	for i := 0; i < 4; i++ {
+		j := newJob(wf, []string{}, []*Job{}, []string{}, false,
+			`for i in $(seq 1 200); do echo "out $i of $GFLOW_JOB"; echo "err $i of $GFLOW_JOB" >&2; done`)
+		j.Env = map[string]string{"GFLOW_JOB": fmt.Sprint(i)}
+		jobs = append(jobs, j)
+	}
+	wf.AddJob(jobs...)
+	expectZero(t, wf.Run())
+
+	b, err := ioutil.ReadFile(wf.CombinedLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := regexp.MustCompile(`^(\d{4}/\d\d/\d\d \d\d:\d\d:\d\d\.\d{6}) \[(job_\d+|workflow)\] (.*)$`)
+	next := map[string]int{}
+	last := ""
+	for _, l := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+		m := line.FindStringSubmatch(l)
+		if m == nil {
+			t.Fatalf("expected every line to be stamped and prefixed with its job, got %q", l)
+		}
+		if m[1] < last {
+			t.Errorf("expected lines in chronological order, %q after %s", l, last)
+		}
+		last = m[1]
+		var stream string
+		var n, job int
+		if _, err := fmt.Sscanf(m[3], "%s %d of %d", &stream, &n, &job); err != nil {
+			continue
+		}
+		key := fmt.Sprintf("%s %s %d", m[2], stream, job)
+		if n != next[key]+1 {
+			t.Errorf("expected %s line %d after line %d, got %q", key, next[key]+1, next[key], l)
+		}
+		next[key] = n
+	}
+	for i, j := range jobs {
+		for _, stream := range []string{"out", "err"} {
+			key := fmt.Sprintf("job_%d %s %d", j.ID, stream, i)
+			if next[key] != 200 {
+				t.Errorf("expected all 200 %s lines of job_id:%d, got %d", stream, j.ID, next[key])
+			}
+		}
+	}
+	if !strings.Contains(string(b), "[workflow] Workflow success\n") {
+		t.Errorf("expected the combined log to record the workflow messages, got:\n%s", string(b))
+	}
+}
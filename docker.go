@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// DockerExecutor runs jobs in a container of the job's Image with the docker cli.
+// The workflow dir, and the job's work dir, are mounted at the same paths in the container
+// so the job script, logs and outputs are where they would be for a local job.
+// The image must provide /bin/bash to run the job script
+type DockerExecutor struct{}
+
+// Run pulls the job's image if it is not present, then runs the job script in a new container.
+// When ctx is done the container is killed
+func (DockerExecutor) Run(ctx context.Context, j *Job, stdout, stderr io.Writer) (int, error) {
+	err := pullImage(ctx, j.Image)
+	if err != nil {
+		return -1, err
+	}
+	name := containerName(j)
+	cmd := exec.Command("docker", dockerRunArgs(j, name)...)
+	// secrets are passed by name so their values are not in the docker command line
+	cmd.Env = append(os.Environ(), j.secretEnviron()...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	stdin, err := j.openStdin()
+	if err != nil {
+		return -1, err
+	}
+	if stdin != nil {
+		defer stdin.Close()
+		cmd.Stdin = stdin
+	}
+	err = cmd.Start()
+	if err != nil {
+		return -1, err
+	}
+	waited := make(chan error, 1)
+	go func() { waited <- cmd.Wait() }()
+	select {
+	case err = <-waited:
+	case <-ctx.Done():
+		exec.Command("docker", "kill", name).Run()
+		err = <-waited
+	}
+	return exitCode(err), err
+}
+
+// pullImage pulls image unless it is already present
+func pullImage(ctx context.Context, image string) error {
+	if exec.CommandContext(ctx, "docker", "image", "inspect", image).Run() == nil {
+		return nil
+	}
+	out, err := exec.CommandContext(ctx, "docker", "pull", image).CombinedOutput()
+	if err != nil {
+		return &imageError{fmt.Errorf("failed pulling image %s: %v: %s", image, err, strings.TrimSpace(string(out)))}
+	}
+	return nil
+}
+
+// imageError is returned when the image of a job cannot be pulled
+type imageError struct {
+	error
+}
+
+func isImageError(err error) bool {
+	_, ok := err.(*imageError)
+	return ok
+}
+
+// containerName identifies the container of a job attempt, so it can be killed
+func containerName(j *Job) string {
+	return fmt.Sprintf("gflow-%d-job-%d-attempt-%d", os.Getpid(), j.ID, j.Attempts)
+}
+
+func dockerRunArgs(j *Job, name string) []string {
+	args := []string{"run", "--rm", "--name", name,
+		"--user", strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid()),
+		"-v", j.workflow.WorkflowDir + ":" + j.workflow.WorkflowDir}
+	workDir := j.workDir()
+	if !strings.HasPrefix(workDir+"/", j.workflow.WorkflowDir+"/") {
+		args = append(args, "-v", workDir+":"+workDir)
+	}
+	args = append(args, "-w", workDir)
+	if j.stdinJob != nil {
+		args = append(args, "-i")
+	}
+	for _, kv := range j.jobEnviron() {
+		args = append(args, "-e", kv)
+	}
+	for _, name := range j.secretNames() {
+		args = append(args, "-e", name)
+	}
+	return append(args, j.Image, "/bin/bash", j.pathToExec("exe"))
+}
+
+// dockerAvailable reports whether the docker cli is installed and can reach a daemon
+func dockerAvailable() bool {
+	out := &bytes.Buffer{}
+	cmd := exec.Command("docker", "info")
+	cmd.Stdout, cmd.Stderr = out, out
+	return cmd.Run() == nil
+}
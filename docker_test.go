@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDockerRunArgs(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "DockerRunArgs")
+	wf.Env = map[string]string{"STAGE": "test"}
+	wf.Secrets = []string{"TOKEN"}
+	wf.secrets = map[string]string{"TOKEN": "secret-value"}
+	j := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	j.Image = "ubuntu:22.04"
+	j.ID = 3
+	j.WorkDir = "/scratch"
+
+	user := strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid())
+	want := []string{"run", "--rm", "--name", "gflow-test", "--user", user,
+		"-v", wf.WorkflowDir + ":" + wf.WorkflowDir, "-v", "/scratch:/scratch", "-w", "/scratch",
+		"-e", "STAGE=test", "-e", "GFLOW_TMP=" + j.pathToTmp(),
+		"-e", "GFLOW_RUN_ID=", "-e", "GFLOW_JOB_ID=3", "-e", "GFLOW_JOB_NAME=", "-e", "TOKEN",
+		"ubuntu:22.04", "/bin/bash", j.pathToExec("exe")}
+	if got := dockerRunArgs(j, "gflow-test"); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected docker args %q, got %q", want, got)
+	}
+}
+
+func TestDockerExecutor(t *testing.T) {
+	if !dockerAvailable() {
+		t.Skip("docker is not available")
+	}
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "DockerExecutor")
+	j := newJob(wf, []string{}, []*Job{}, []string{"out.txt"}, false,
+		"echo hello from $(cat /etc/os-release | grep -o ubuntu | head -1) > out.txt; cat out.txt")
+	j.Image = "ubuntu:22.04"
+	missing := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	missing.Image = "gflow-test/no-such-image:missing"
+	wf.AddJob(j, missing)
+	expectNonZero(t, wf.Run())
+
+	if j.Status != StatusSucceeded || j.ExitCode != 0 {
+		t.Fatalf("expected job in a container to succeed, got %s: %s", j.Status, j.Reason)
+	}
+	stdout, err := ioutil.ReadFile(j.StdoutLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(stdout) != "hello from ubuntu\n" {
+		t.Errorf("expected container output in the stdout log, got %q", string(stdout))
+	}
+	if missing.Status != StatusFailed || !strings.HasPrefix(missing.Reason, "failed pulling image gflow-test/no-such-image:missing") {
+		t.Errorf("expected job with a missing image to fail pulling it, got %s: %s", missing.Status, missing.Reason)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Duration is a time.Duration read from and written to yaml/json
+// as a duration string such as "30s" or "1h30m"
+type Duration struct {
+	time.Duration
+}
+
+// MarshalJSON writes the duration as a duration string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON parses a duration string
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+	d.Duration, err = time.ParseDuration(s)
+	return err
+}
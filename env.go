@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// expandEnv expands ${VAR} references in the values of env using lookup
+func expandEnv(env map[string]string, lookup func(string) string) map[string]string {
+	expanded := map[string]string{}
+	for k, v := range env {
+		expanded[k] = os.Expand(v, lookup)
+	}
+	return expanded
+}
+
+// environ returns the environment of the job's process: the inherited process
+// environment, overridden by the workflow Env, overridden by the job Env,
+// overridden by the job's secrets.
+func (j *Job) environ() []string {
+	return append(append(os.Environ(), j.jobEnviron()...), j.secretEnviron()...)
+}
+
+// jobEnviron returns the variables the workflow sets for the job, its configEnviron followed by
+// GFLOW_TMP set to the job's tmp dir, GFLOW_RUN_ID to the id of the run
+// and GFLOW_JOB_ID and GFLOW_JOB_NAME to the job's ID and Name.
+func (j *Job) jobEnviron() []string {
+	return append(j.configEnviron(), "GFLOW_TMP="+j.pathToTmp(), "GFLOW_RUN_ID="+j.workflow.runID,
+		"GFLOW_JOB_ID="+strconv.Itoa(j.ID), "GFLOW_JOB_NAME="+j.Name)
+}
+
+// configEnviron returns the workflow Env overridden by the job Env as sorted NAME=value pairs,
+// without the inherited process environment, the variables gflow sets or secrets.
+// Workflow values expand references to the process environment,
+// job values expand references to the process and workflow environment.
+func (j *Job) configEnviron() []string {
+	wfEnv := expandEnv(j.workflow.Env, os.Getenv)
+	jobEnv := expandEnv(j.Env, func(key string) string {
+		if v, ok := wfEnv[key]; ok {
+			return v
+		}
+		return os.Getenv(key)
+	})
+
+	merged := map[string]string{}
+	for _, overrides := range []map[string]string{wfEnv, jobEnv} {
+		for k, v := range overrides {
+			merged[k] = v
+		}
+	}
+	keys := []string{}
+	for k := range merged {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	env := []string{}
+	for _, k := range keys {
+		env = append(env, k+"="+merged[k])
+	}
+	return env
+}
+
+// newRunID returns a random version 4 UUID identifying a run of the workflow
+func newRunID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// envSnapshot is the environment gflow ran a workflow with, recorded when the run starts
+type envSnapshot struct {
+	RecordedAt time.Time         `json:"recorded_at"`
+	Path       string            `json:"path"`
+	Env        map[string]string `json:"env,omitempty"`
+}
+
+// recordEnv writes the PATH of the process to EnvPath, with RecordEnv set along with the rest
+// of its environment. The values of secrets, and of variables named as secrets, are redacted
+func (w *Workflow) recordEnv() error {
+	snapshot := envSnapshot{RecordedAt: time.Now(), Path: w.redact(os.Getenv("PATH"))}
+	if w.RecordEnv {
+		snapshot.Env = map[string]string{}
+		for _, kv := range os.Environ() {
+			kv := strings.SplitN(kv, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			if _, secret := w.secrets[kv[0]]; secret {
+				snapshot.Env[kv[0]] = redacted
+			} else {
+				snapshot.Env[kv[0]] = w.redact(kv[1])
+			}
+		}
+	}
+	b, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(w.EnvPath, append(b, '\n'), w.fileMode())
+}
+
+// readEnvSnapshot reads the environment recorded by the last run at path
+func readEnvSnapshot(path string) (*envSnapshot, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &envSnapshot{}
+	err = json.Unmarshal(b, snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("reading env: %v", err)
+	}
+	return snapshot, nil
+}
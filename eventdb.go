@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Event types recorded in the event DB
+const (
+	EventStarted     = "started"
+	EventFinished    = "finished"
+	EventFailed      = "failed"
+	EventSkipped     = "skipped"
+	EventInterrupted = "interrupted"
+	EventCancelled   = "cancelled"
+	// EventRetriesExhausted is recorded after the failed event of a job's last retry
+	EventRetriesExhausted = "retries_exhausted"
+	// EventWorkflowStarted is recorded with a job id of 0 at the start of each run
+	EventWorkflowStarted = "workflow_started"
+	// EventSchemaVersion is the first event of the event DB, giving the version of its format
+	EventSchemaVersion = "schema_version"
+)
+
+// eventDBSchemaVersion is the version of the event DB format written by this gflow
+const eventDBSchemaVersion = 1
+
+// migrations upgrade the events of an event DB from the version of their index to the next.
+// Version 0 is an event DB written before the schema version was recorded, it needs
+// no change beyond recording the version
+var migrations = []func(events []Event) []Event{
+	func(events []Event) []Event { return events },
+}
+
+// The EventDB type records job events as they happen during a workflow run
+// Events are appended to the workflow's event.db file as one json object per line,
+// so the history of every run of the workflow is kept and can be queried afterwards.
+// Each event is written whole with a single write and synced to disk, an event left incomplete
+// by a crash is dropped the next time the event DB is opened
+type EventDB struct {
+	path  string
+	mode  os.FileMode
+	file  *os.File
+	mutex *sync.Mutex
+}
+
+// eventSink records the events of a workflow run, the EventDB or discardEvents without one
+type eventSink interface {
+	record(e Event) error
+	Close() error
+}
+
+// discardEvents is the eventSink of a workflow run without an event DB, it drops every event
+type discardEvents struct{}
+
+func (discardEvents) record(e Event) error { return nil }
+
+func (discardEvents) Close() error { return nil }
+
+// Event is a single job state change recorded in the event DB
+type Event struct {
+	Time    time.Time `json:"ts"`
+	JobID   int       `json:"job_id"`
+	Attempt int       `json:"attempt,omitempty"`
+	Type    string    `json:"type"`
+	RunID   string    `json:"run_id,omitempty"`
+
+	StdoutLog     string            `json:"stdout_log,omitempty"`
+	StderrLog     string            `json:"stderr_log,omitempty"`
+	WorkflowHash  string            `json:"workflow_hash,omitempty"`
+	SchemaVersion int               `json:"schema_version,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	JobHash       string            `json:"job_hash,omitempty"`
+}
+
+func (w *Workflow) setupEventDB() error {
+	db := &EventDB{path: w.EventDBPath, mode: w.fileMode(), mutex: &sync.Mutex{}}
+	err := migrate(db)
+	if err != nil {
+		return fmt.Errorf("could not migrate event db: %v", err)
+	}
+	db.file, err = os.OpenFile(w.EventDBPath, os.O_APPEND|os.O_WRONLY, w.fileMode())
+	if err != nil {
+		return err
+	}
+	w.eventDB = db
+	return nil
+}
+
+// OpenEventDB opens an existing event DB, such as a workflow's .gflow/event.db,
+// to query the events of previous runs. An event DB of an older schema version is migrated
+func OpenEventDB(path string) (*EventDB, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	db := &EventDB{path: path, mode: info.Mode().Perm(), mutex: &sync.Mutex{}}
+	err = migrate(db)
+	if err != nil {
+		return nil, fmt.Errorf("could not migrate event db: %v", err)
+	}
+	return db, nil
+}
+
+// migrate brings the event DB at db's path up to the current schema version, creating it with
+// db's mode if it does not exist, and drops an incomplete last event. The migrated events are written
+// to a new file which replaces the old one, so the old events are kept if migrating fails
+func migrate(db *EventDB) error {
+	raw, err := ioutil.ReadFile(db.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	complete := raw
+	if i := bytes.LastIndexByte(raw, '\n'); i+1 < len(raw) {
+		complete = raw[:i+1]
+	}
+	events, err := parseEvents(complete)
+	if err != nil {
+		return err
+	}
+	version := 0
+	if len(events) > 0 && events[0].Type == EventSchemaVersion {
+		version = events[0].SchemaVersion
+		events = events[1:]
+	}
+	switch {
+	case version > eventDBSchemaVersion:
+		return fmt.Errorf("schema version %d is newer than this gflow's %d", version, eventDBSchemaVersion)
+	case version == eventDBSchemaVersion && len(complete) == len(raw):
+		return nil
+	case version == eventDBSchemaVersion:
+		return os.Truncate(db.path, int64(len(complete)))
+	}
+	for ; version < eventDBSchemaVersion; version++ {
+		events = migrations[version](events)
+	}
+	header := Event{Time: time.Now(), Type: EventSchemaVersion, SchemaVersion: eventDBSchemaVersion}
+	migrated := &bytes.Buffer{}
+	enc := json.NewEncoder(migrated)
+	for _, e := range append([]Event{header}, events...) {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	tmp := db.path + ".migrate"
+	err = ioutil.WriteFile(tmp, migrated.Bytes(), db.mode)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, db.path)
+}
+
+// schemaVersion returns the schema version recorded in the event DB
+func (db *EventDB) schemaVersion() (int, error) {
+	events, err := readEvents(db.path)
+	if err != nil || len(events) == 0 || events[0].Type != EventSchemaVersion {
+		return 0, err
+	}
+	return events[0].SchemaVersion, nil
+}
+
+// record timestamps e and appends it to the event DB
+func (db *EventDB) record(e Event) error {
+	e.Time = time.Now()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	_, err = db.file.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+	return db.file.Sync()
+}
+
+// Close closes the event DB
+func (db *EventDB) Close() error {
+	if db.file == nil {
+		return nil
+	}
+	return db.file.Close()
+}
+
+// Events returns every event recorded for the job, oldest first
+func (db *EventDB) Events(jobID int) ([]Event, error) {
+	events, err := readEvents(db.path)
+	if err != nil {
+		return nil, err
+	}
+	jobEvents := []Event{}
+	for _, e := range events {
+		if e.JobID == jobID {
+			jobEvents = append(jobEvents, e)
+		}
+	}
+	return jobEvents, nil
+}
+
+// EventsSince returns the events recorded at or after since, oldest first
+func (db *EventDB) EventsSince(since time.Time) ([]Event, error) {
+	events, err := readEvents(db.path)
+	if err != nil {
+		return nil, err
+	}
+	return eventsSince(events, since), nil
+}
+
+// FailedJobs returns the ids of the jobs whose most recent event is a failure, in ascending order
+func (db *EventDB) FailedJobs() ([]int, error) {
+	return db.jobsWithLastEvent(EventFailed)
+}
+
+// SucceededJobs returns the ids of the jobs whose most recent event is finishing successfully,
+// in ascending order
+func (db *EventDB) SucceededJobs() ([]int, error) {
+	return db.jobsWithLastEvent(EventFinished)
+}
+
+func (db *EventDB) jobsWithLastEvent(eventType string) ([]int, error) {
+	events, err := readEvents(db.path)
+	if err != nil {
+		return nil, err
+	}
+	last := map[int]string{}
+	for _, e := range events {
+		if e.JobID != 0 && e.Type != EventRetriesExhausted {
+			last[e.JobID] = e.Type
+		}
+	}
+	ids := []int{}
+	for id, lastType := range last {
+		if lastType == eventType {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// Labels returns the labels recorded with the most recent event of the job,
+// or of the most recent workflow start for a jobID of 0
+func (db *EventDB) Labels(jobID int) (map[string]string, error) {
+	events, err := readEvents(db.path)
+	if err != nil {
+		return nil, err
+	}
+	labels := map[string]string{}
+	for _, e := range events {
+		if e.JobID == jobID && e.Type != EventSchemaVersion {
+			labels = e.Labels
+		}
+	}
+	return labels, nil
+}
+
+// EventsByLabel groups the job events recorded with the label key by the label's value
+func (db *EventDB) EventsByLabel(key string) (map[string][]Event, error) {
+	events, err := readEvents(db.path)
+	if err != nil {
+		return nil, err
+	}
+	groups := map[string][]Event{}
+	for _, e := range events {
+		if v, ok := e.Labels[key]; ok && e.JobID != 0 {
+			groups[v] = append(groups[v], e)
+		}
+	}
+	return groups, nil
+}
+
+// lastStarted returns when each job last started, by job id
+func (db *EventDB) lastStarted() (map[int]time.Time, error) {
+	events, err := readEvents(db.path)
+	if err != nil {
+		return nil, err
+	}
+	started := map[int]time.Time{}
+	for _, e := range events {
+		if e.Type == EventStarted {
+			started[e.JobID] = e.Time
+		}
+	}
+	return started, nil
+}
+
+// lastSucceeded returns when a job with each configuration hash last finished successfully
+func (db *EventDB) lastSucceeded() (map[string]time.Time, error) {
+	events, err := readEvents(db.path)
+	if err != nil {
+		return nil, err
+	}
+	succeeded := map[string]time.Time{}
+	for _, e := range events {
+		if e.Type == EventFinished && e.JobHash != "" {
+			succeeded[e.JobHash] = e.Time
+		}
+	}
+	return succeeded, nil
+}
+
+// lastWorkflowHash returns the workflow hash recorded by the most recent run, if any
+func (db *EventDB) lastWorkflowHash() (string, error) {
+	events, err := readEvents(db.path)
+	if err != nil {
+		return "", err
+	}
+	hash := ""
+	for _, e := range events {
+		if e.Type == EventWorkflowStarted {
+			hash = e.WorkflowHash
+		}
+	}
+	return hash, nil
+}
+
+// readEvents reads the events of the event DB at path, ignoring a last event still being written
+func readEvents(path string) ([]Event, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseEvents(raw[:bytes.LastIndexByte(raw, '\n')+1])
+}
+
+func parseEvents(raw []byte) ([]Event, error) {
+	events := []Event{}
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventDBQueries(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "EventDBQueries")
+	wf.KeepGoing = true
+	ok := newJob(wf, []string{}, []*Job{}, []string{}, false, "echo ok")
+	failed := newJob(wf, []string{}, []*Job{}, []string{}, false, "false")
+	wf.AddJob(ok, failed)
+	expectNonZero(t, wf.Run())
+
+	db, err := OpenEventDB(wf.EventDBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	testCases := []struct {
+		job  *Job
+		want []string
+	}{
+		{ok, []string{EventStarted, EventFinished}},
+		{failed, []string{EventStarted, EventFailed}},
+	}
+	for _, tc := range testCases {
+		events, err := db.Events(tc.job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, e := range events {
+			if e.JobID != tc.job.ID || e.Time.IsZero() {
+				t.Errorf("expected timestamped event for job_id:%d, got %+v", tc.job.ID, e)
+			}
+			got = append(got, e.Type)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("expected job_id:%d events %v, got %v", tc.job.ID, tc.want, got)
+		}
+	}
+
+	failedIDs, err := db.FailedJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(failedIDs, []int{failed.ID}) {
+		t.Errorf("expected failed jobs %v, got %v", []int{failed.ID}, failedIDs)
+	}
+
+	if _, err := OpenEventDB(wf.pathToWDir("missing.db")); err == nil {
+		t.Error("expected an error opening a missing event db")
+	}
+}
+
+func TestEventDBSchemaVersion(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "EventDBSchemaVersion")
+	wf.AddJob(newJob(wf, []string{}, []*Job{}, []string{}, false, "true"))
+	expectZero(t, wf.Run())
+
+	events, err := readEvents(wf.EventDBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) == 0 || events[0].Type != EventSchemaVersion || events[0].SchemaVersion != eventDBSchemaVersion {
+		t.Fatalf("expected a fresh event db to start with schema version %d, got %+v", eventDBSchemaVersion, events)
+	}
+	expectZero(t, wf.Run())
+	events, err = readEvents(wf.EventDBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := 0
+	for _, e := range events {
+		if e.Type == EventSchemaVersion {
+			versions++
+		}
+	}
+	if versions != 1 {
+		t.Errorf("expected the schema version to be recorded once, got %d times", versions)
+	}
+}
+
+func TestEventDBMigration(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "EventDBMigration")
+	// an event db from before schema versions, with a crash during the last write
+	old := `{"ts":"2018-02-05T07:49:49Z","job_id":1,"attempt":1,"type":"started"}
+{"ts":"2018-02-05T07:49:50Z","job_id":1,"attempt":1,"type":"finished"}
+{"ts":"2018-02-05T07:49:51Z","job_id":2,"att`
+	if err := ioutil.WriteFile(wf.EventDBPath, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if events, err := readEvents(wf.EventDBPath); err != nil || len(events) != 2 {
+		t.Errorf("expected reading to ignore the incomplete event, got %v: %v", events, err)
+	}
+	db, err := OpenEventDB(wf.EventDBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := db.schemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != eventDBSchemaVersion {
+		t.Errorf("expected the event db to be migrated to version %d, got %d", eventDBSchemaVersion, version)
+	}
+	succeeded, err := db.SucceededJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(succeeded, []int{1}) {
+		t.Errorf("expected the migrated events to be kept, got succeeded jobs %v", succeeded)
+	}
+	raw, err := ioutil.ReadFile(wf.EventDBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), `"att`+"\n") || !strings.HasSuffix(string(raw), "\n") {
+		t.Errorf("expected the incomplete event to be dropped, got:\n%s", raw)
+	}
+
+	newer := fmt.Sprintf(`{"ts":"2030-01-01T00:00:00Z","job_id":0,"type":"schema_version","schema_version":%d}`+"\n",
+		eventDBSchemaVersion+1)
+	if err := ioutil.WriteFile(wf.EventDBPath, []byte(newer), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenEventDB(wf.EventDBPath); err == nil {
+		t.Error("expected an error opening an event db of a newer schema version")
+	}
+}
+
+func TestEventsSince(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "EventsSince")
+	recorded := `{"ts":"2018-02-05T07:49:49Z","job_id":0,"type":"schema_version","schema_version":1}
+{"ts":"2018-02-05T07:49:49Z","job_id":1,"attempt":1,"type":"started"}
+{"ts":"2018-02-05T07:49:50Z","job_id":1,"attempt":1,"type":"finished"}
+{"ts":"2018-02-06T07:00:00Z","job_id":2,"attempt":1,"type":"started"}
+{"ts":"2018-02-06T07:00:30Z","job_id":2,"attempt":1,"type":"failed"}
+`
+	if err := ioutil.WriteFile(wf.EventDBPath, []byte(recorded), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := OpenEventDB(wf.EventDBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	testCases := []struct {
+		name  string
+		since time.Time
+		want  []string
+	}{
+		{"All", time.Time{}, []string{"0 schema_version", "1 started", "1 finished", "2 started", "2 failed"}},
+		{"AtEvent", time.Date(2018, 2, 5, 7, 49, 50, 0, time.UTC), []string{"1 finished", "2 started", "2 failed"}},
+		{"BetweenRuns", time.Date(2018, 2, 6, 0, 0, 0, 0, time.UTC), []string{"2 started", "2 failed"}},
+		{"AfterAll", time.Date(2018, 2, 7, 0, 0, 0, 0, time.UTC), []string{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			events, err := db.EventsSince(tc.since)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, e := range events {
+				got = append(got, fmt.Sprintf("%d %s", e.JobID, e.Type))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected events %v since %v, got %v", tc.want, tc.since, got)
+			}
+		})
+	}
+}
+
+func TestNoEventDB(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "NoEventDB")
+	wf.NoEventDB = true
+	a := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	wf.AddJob(newJob(wf, []string{}, []*Job{a}, []string{}, false, "true"))
+	expectZero(t, wf.Run())
+	if _, ok := wf.eventDB.(discardEvents); !ok {
+		t.Errorf("expected the events to be discarded, got %T", wf.eventDB)
+	}
+	if _, err := os.Stat(wf.EventDBPath); !os.IsNotExist(err) {
+		t.Errorf("expected no event db to be created, got %v", err)
+	}
+	if _, err := os.Stat(wf.WFJsonPath); err != nil {
+		t.Errorf("expected the workflow json to be written: %v", err)
+	}
+}
+
+func TestEventDBLabels(t *testing.T) {
+	defer cleanTestData(t)
+	yamlPath := writeTestYaml(t, "EventDBLabels", `
+workflow_dir: .
+labels:
+  team: data
+  pipeline: nightly
+jobs:
+- name: extract
+  cmd: "true"
+  labels:
+    stage: extract
+- name: load
+  cmd: "true"
+  depends_on: [extract]
+  labels:
+    stage: load
+    team: warehouse
+`)
+	wf, err := workflowFromYaml(yamlPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectZero(t, wf.Run())
+
+	db, err := OpenEventDB(wf.EventDBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	extract, load := wf.Jobs[0], wf.Jobs[1]
+	if extract.Name != "extract" {
+		extract, load = load, extract
+	}
+	testCases := []struct {
+		jobID int
+		want  map[string]string
+	}{
+		{0, map[string]string{"team": "data", "pipeline": "nightly"}},
+		{extract.ID, map[string]string{"team": "data", "pipeline": "nightly", "stage": "extract"}},
+		{load.ID, map[string]string{"team": "warehouse", "pipeline": "nightly", "stage": "load"}},
+	}
+	for _, tc := range testCases {
+		labels, err := db.Labels(tc.jobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(labels, tc.want) {
+			t.Errorf("expected job_id:%d labels %v, got %v", tc.jobID, tc.want, labels)
+		}
+	}
+
+	groups, err := db.EventsByLabel("stage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for stage, j := range map[string]*Job{"extract": extract, "load": load} {
+		events := groups[stage]
+		if len(events) != 2 || events[0].JobID != j.ID || events[1].Type != EventFinished {
+			t.Errorf("expected the started and finished events of %s grouped under stage %s, got %+v", j.Name, stage, events)
+		}
+	}
+}
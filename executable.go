@@ -2,42 +2,37 @@ package main
 
 import (
 	"bytes"
-	"errors"
-	"log"
+	"fmt"
 	"strings"
 	"text/template"
 )
 
-func templateCleanTmpTrap(tmpDir string) (string, error) {
-	if tmpDir == "" {
-		return "", errors.New("Error: tried to create cleanup, no tmpdir")
-	}
-	// uses bash specific logic (pseudosignal EXIT)
-	t := `
-	function cleanTmp {
-	    echo 'GFLOW: removing tmp dir: "{{.TmpDir}}"'
-	    if [[ -d {{.TmpDir}} ]]; then
-	        rm -rf {{.TmpDir}}
-	    fi
-	}
-	trap cleanTmp EXIT
-	`
-	t = strings.Replace(t, "\t", "", -1) // remove leading tabs
-	cleanTmpTemplate, err := template.New("cleanTmp").Parse(t)
-	if err != nil {
-		return "", err
-	}
+// shellCommand execs the words of shell with the command appended, each single quoted for bash
+func shellCommand(shell, command string) string {
+	return argsCmd(append(strings.Fields(shell), command))
+}
 
-	templateResult := bytes.Buffer{}
-	err = cleanTmpTemplate.Execute(&templateResult, struct{ TmpDir string }{tmpDir})
-	if err != nil {
-		return "", err
+// shellQuote single quotes word for bash
+func shellQuote(word string) string {
+	return "'" + strings.Replace(word, "'", `'\''`, -1) + "'"
+}
+
+// shell returns the job's Shell, or else the workflow's
+func (j *Job) shell() string {
+	if j.Shell != "" {
+		return j.Shell
 	}
-	return templateResult.String(), err
+	return j.workflow.Shell
 }
 
+// templateBody returns the job's cmd with its template actions executed,
+// the cmd of a job with Args is used as it is
 func templateBody(j *Job) (string, error) {
-	bodyTemplate, err := template.New("bodyTemplate").Parse(j.Cmd)
+	cmd := j.command()
+	if len(j.Args) > 0 {
+		return cmd, nil
+	}
+	bodyTemplate, err := template.New("bodyTemplate").Parse(cmd)
 	if err != nil {
 		return "", err
 	}
@@ -53,28 +48,28 @@ func templateBody(j *Job) (string, error) {
 	return templateResult.String(), err
 }
 
-func templateExecutable(j *Job) string {
+func templateExecutable(j *Job) (string, error) {
 	shell := "/bin/bash"
 	preamble := "set -eo pipefail"
-
-	traps := ""
-	err := errors.New("")
-	if j.CleanTmp {
-		traps, err = templateCleanTmpTrap(j.pathToTmp())
-		if err != nil {
-			log.Fatal(err)
-		}
+	if j.Umask != nil {
+		// set by the script itself so it applies only to the job's process and its children
+		preamble += fmt.Sprintf("\numask %04o", uint32(*j.Umask))
 	}
 
-	scriptText := "#!{{.Shell}}\n{{.Preamble}}\n{{.Traps}}\n{{.Body}}\n"
+	limits := templateResourceLimits(j.Resources)
+
+	scriptText := "#!{{.Shell}}\n{{.Preamble}}\n{{.Limits}}\n{{.Body}}\n"
 
 	exeTemplate, err := template.New("exe").Parse(scriptText) // TODO: if not endswith \n
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
 	body, err := templateBody(j)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
+	}
+	if jobShell := j.shell(); jobShell != "" && len(j.Args) == 0 {
+		body = shellCommand(jobShell, body)
 	}
 
 	templateResult := bytes.Buffer{}
@@ -82,10 +77,10 @@ func templateExecutable(j *Job) string {
 		Shell    string
 		Body     string
 		Preamble string
-		Traps    string
-	}{shell, body, preamble, traps})
+		Limits   string
+	}{shell, body, preamble, limits})
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
-	return templateResult.String()
+	return templateResult.String(), nil
 }
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os/exec"
+)
+
+// Executor runs one attempt of a job's command script, writing its output to stdout and stderr.
+// It returns the exit code of the command and a non nil error if it did not succeed.
+// When ctx is done the command must be stopped before Run returns
+type Executor interface {
+	Run(ctx context.Context, j *Job, stdout, stderr io.Writer) (int, error)
+}
+
+// LocalExecutor runs jobs as processes on this machine, each in its own process group
+type LocalExecutor struct{}
+
+// Run executes the job's script in its work dir with the job's environment.
+// When ctx is done the process group is sent SIGTERM, then killed after the workflow's grace period.
+// The process runs at the job's Nice
+func (LocalExecutor) Run(ctx context.Context, j *Job, stdout, stderr io.Writer) (int, error) {
+	cmd := exec.CommandContext(ctx, j.pathToExec("exe"))
+	setProcessGroup(cmd, j.workflow.gracePeriod)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Dir = j.workDir()
+	cmd.Env = j.environ()
+	stdin, err := j.openStdin()
+	if err != nil {
+		return -1, err
+	}
+	if stdin != nil {
+		defer stdin.Close()
+		cmd.Stdin = stdin
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return -1, err
+	}
+	if j.Nice != 0 {
+		if err := setNice(cmd, j.Nice); err != nil {
+			j.errorf("Job could not set nice %d: %v", j.Nice, err)
+		}
+	}
+	err = cmd.Wait()
+	if err != nil && ctx.Err() != nil {
+		killProcessGroup(cmd)
+	}
+	return exitCode(err), err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+// fakeExecutor records the jobs it is asked to run instead of running them
+type fakeExecutor struct {
+	mutex *sync.Mutex
+	ran   []*Job
+	fail  map[*Job]bool
+}
+
+func (e *fakeExecutor) Run(ctx context.Context, j *Job, stdout, stderr io.Writer) (int, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.ran = append(e.ran, j)
+	if e.fail[j] {
+		io.WriteString(stderr, "fake failure\n")
+		return 1, errors.New("fake failure")
+	}
+	io.WriteString(stdout, "fake output\n")
+	return 0, nil
+}
+
+func TestExecutor(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "Executor")
+	wf.KeepGoing = true
+	d := newJob(wf, []string{}, []*Job{}, []string{}, false, "echo d")
+	b := newJob(wf, []string{}, []*Job{d}, []string{}, false, "echo b")
+	c := newJob(wf, []string{}, []*Job{d}, []string{}, false, "echo c")
+	a := newJob(wf, []string{}, []*Job{b, c}, []string{}, false, "echo a")
+	failed := newJob(wf, []string{}, []*Job{}, []string{}, false, "echo failed")
+	wf.AddJob(a, failed)
+	executor := &fakeExecutor{mutex: &sync.Mutex{}, fail: map[*Job]bool{failed: true}}
+	wf.Executor = executor
+	if status := wf.Run(); status != ExitJobsFailed {
+		t.Errorf("expected exit status %d, got %d", ExitJobsFailed, status)
+	}
+
+	if len(executor.ran) != 5 {
+		t.Fatalf("expected the executor to run each of the 5 jobs once, ran %d", len(executor.ran))
+	}
+	position := map[*Job]int{}
+	for i, j := range executor.ran {
+		if _, ok := position[j]; ok {
+			t.Errorf("expected job %d to run once", j.ID)
+		}
+		position[j] = i
+	}
+	for _, j := range []*Job{a, b, c} {
+		for _, dep := range j.Dependencies {
+			if position[dep] > position[j] {
+				t.Errorf("expected dependency %d to run before job %d", dep.ID, j.ID)
+			}
+		}
+	}
+	if a.Status != StatusSucceeded || failed.Status != StatusFailed || failed.ExitCode != 1 {
+		t.Errorf("expected statuses from the executor, got %s and %s exit code %d", a.Status, failed.Status, failed.ExitCode)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// explanation is what a job would do if the workflow ran now and why
+type explanation struct {
+	decision string
+	reason   string
+}
+
+// Decisions of an explanation
+const (
+	explainRun  = "run"
+	explainSkip = "skip"
+	explainWait = "wait"
+	explainFail = "fail"
+)
+
+// explain decides, for each of the jobs in the order they are scheduled, whether it would run,
+// be skipped or wait for a dependency that runs first, with the checks runJob makes.
+// A job waiting for a dependency is only decided once the dependency has run
+func (w *Workflow) explain(jobs []*Job) map[*Job]explanation {
+	err := w.loadSecrets()
+	if err != nil {
+		w.logger.Errorf(0, "Failed loading secrets: %v", err)
+	}
+	err = w.prepareRecent(jobs)
+	if err != nil {
+		w.logger.Errorf(0, "Failed reading previous runs: %v", err)
+	}
+	explained := map[*Job]explanation{}
+	for _, j := range jobs {
+		explained[j] = j.explain(explained)
+	}
+	return explained
+}
+
+// explain returns what the job would do given the explanations of its dependencies
+func (j *Job) explain(explained map[*Job]explanation) explanation {
+	for _, d := range j.Dependencies {
+		if e, ok := explained[d]; ok && (e.decision == explainRun || e.decision == explainWait) {
+			return explanation{explainWait, fmt.Sprintf("pending dependency job_id:%d", d.ID)}
+		}
+	}
+	ok, err := j.evalWhen()
+	if err != nil {
+		return explanation{explainFail, err.Error()}
+	}
+	if !ok {
+		return explanation{explainSkip, "condition false: " + j.When}
+	}
+	if !j.succeededAt.IsZero() {
+		return explanation{explainSkip, fmt.Sprintf("succeeded within %v", j.SucceededWithin.Duration)}
+	}
+	if len(j.Outputs) == 0 {
+		return explanation{explainRun, "no outputs declared"}
+	}
+	stale, err := j.staleOutput(time.Time{})
+	if err != nil {
+		return explanation{explainRun, "could not check outputs: " + err.Error()}
+	}
+	if stale == "" {
+		return explanation{explainSkip, "up to date, outputs are newer than its inputs"}
+	}
+	if j.hasOutputRefs() {
+		return explanation{explainRun, stale + ", cmd references outputs of its dependencies"}
+	}
+	key, err := j.cacheKey()
+	if err != nil || key == "" {
+		return explanation{explainRun, stale}
+	}
+	if cached, _ := fileExists(j.workflow.pathToCache(key)); cached {
+		return explanation{explainSkip, stale + ", outputs in cache"}
+	}
+	return explanation{explainRun, stale + ", no cache entry"}
+}
+
+// printExplanations writes what each of the jobs would do and why, in the order they are scheduled
+func (w *Workflow) printExplanations(jobs []*Job) {
+	explained := w.explain(jobs)
+	fmt.Fprintf(w.stdout, "Explain: %d jobs\n", len(jobs))
+	for _, j := range jobs {
+		fmt.Fprintf(w.stdout, "job_id:%d %s: %s\n", j.ID, explained[j].decision, explained[j].reason)
+	}
+}
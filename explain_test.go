@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExplain(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "Explain")
+	wf.DryRun = true
+	wf.Explain = true
+	out := &bytes.Buffer{}
+	wf.stdout = out
+	past := time.Now().Add(-time.Hour)
+	for _, f := range []string{"in.txt", "a.txt", "b.txt", "in2.txt"} {
+		if err := ioutil.WriteFile(wf.pathToWDir(f), []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chtimes(wf.pathToWDir("in.txt"), past, past); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(wf.pathToWDir("b.txt"), past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	upToDate := newJob(wf, []string{}, []*Job{}, []string{"a.txt"}, false, "cat in.txt > a.txt")
+	upToDate.Inputs = []string{"in.txt"}
+	stale := newJob(wf, []string{}, []*Job{}, []string{"b.txt"}, false, "cat in2.txt > b.txt")
+	stale.Inputs = []string{"in2.txt"}
+	missing := newJob(wf, []string{}, []*Job{upToDate}, []string{"c.txt"}, false, "cat a.txt > c.txt")
+	waiting := newJob(wf, []string{}, []*Job{stale}, []string{}, false, "cat b.txt")
+	conditional := newJob(wf, []string{}, []*Job{upToDate}, []string{}, false, "cat a.txt")
+	conditional.When = "exists:nothing.txt"
+	wf.AddJob(missing, waiting, conditional)
+	expectZero(t, wf.Run())
+
+	wants := []string{
+		fmt.Sprintf("job_id:%d skip: up to date, outputs are newer than its inputs", upToDate.ID),
+		fmt.Sprintf("job_id:%d run: output %s is older than %s", stale.ID, wf.pathToWDir("b.txt"), wf.pathToWDir("in2.txt")),
+		fmt.Sprintf("job_id:%d run: missing output: %s", missing.ID, wf.pathToWDir("c.txt")),
+		fmt.Sprintf("job_id:%d wait: pending dependency job_id:%d", waiting.ID, stale.ID),
+		fmt.Sprintf("job_id:%d skip: condition false: exists:nothing.txt", conditional.ID),
+	}
+	if !strings.HasPrefix(out.String(), "Explain: 5 jobs\n") {
+		t.Errorf("expected explanations of 5 jobs, got:\n%s", out.String())
+	}
+	for _, want := range wants {
+		if !strings.Contains(out.String(), want+"\n") {
+			t.Errorf("expected explanation '%s', got:\n%s", want, out.String())
+		}
+	}
+	if _, err := os.Stat(wf.pathToWDir("c.txt")); !os.IsNotExist(err) {
+		t.Error("expected explaining a dry run not to run any job")
+	}
+}
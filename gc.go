@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// orphans returns the outputs and artifacts left in the workflow dir by jobs that are no longer
+// in the workflow. Outputs are those recorded at OutputsPath by previous runs, or declared by the
+// jobs of the last run in the workflow JSON, which no current job declares. Only outputs within the
+// workflow dir are returned, and never one containing or within the output of a current job.
+// Artifacts are the dirs in the artifacts dir of jobs that no longer collect artifacts
+func (w *Workflow) orphans() ([]string, error) {
+	declared := w.declaredOutputs()
+	collecting := map[string]bool{}
+	for _, j := range w.allJobs() {
+		if len(j.Artifacts) > 0 {
+			collecting[j.label()] = true
+		}
+	}
+
+	recorded, err := readOutputs(w.OutputsPath)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := readWorkflowJSON(w.WFJsonPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if previous != nil {
+		for _, j := range previous.allJobs() {
+			j.workflow = w
+			for _, o := range j.Outputs {
+				recorded = append(recorded, j.pathToOutput(o))
+			}
+		}
+	}
+	orphans := map[string]bool{}
+	for _, p := range recorded {
+		rel, err := filepath.Rel(w.WorkflowDir, p)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") || overlaps(p, declared) {
+			continue
+		}
+		if exists, _ := fileExists(p); exists {
+			orphans[p] = true
+		}
+	}
+	entries, err := ioutil.ReadDir(w.ArtifactsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !collecting[e.Name()] {
+			orphans[path.Join(w.ArtifactsDir, e.Name())] = true
+		}
+	}
+
+	paths := []string{}
+	for p := range orphans {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// gc removes the orphaned outputs and artifacts of jobs no longer in the workflow, writing each
+// path it removes to out. With dryRun set the paths are only listed
+func (w *Workflow) gc(out io.Writer, dryRun bool) error {
+	orphans, err := w.orphans()
+	if err != nil {
+		return err
+	}
+	for _, p := range orphans {
+		if dryRun {
+			fmt.Fprintf(out, "would remove %s\n", p)
+			continue
+		}
+		err := os.RemoveAll(p)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "removed %s\n", p)
+	}
+	return nil
+}
+
+// declaredOutputs returns the paths of the outputs the jobs of the workflow declare
+func (w *Workflow) declaredOutputs() map[string]bool {
+	declared := map[string]bool{}
+	for _, j := range w.allJobs() {
+		for _, o := range j.Outputs {
+			declared[j.pathToOutput(o)] = true
+		}
+	}
+	return declared
+}
+
+// overlaps reports whether p is a declared output, or contains or is within one
+func overlaps(p string, declared map[string]bool) bool {
+	for d := range declared {
+		if within(d, p) || within(p, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordOutputs adds the outputs declared by the workflow's jobs to those recorded at OutputsPath
+// by previous runs. The record is replaced whole so a run interrupted while recording leaves the previous one
+func (w *Workflow) recordOutputs() error {
+	recorded, err := readOutputs(w.OutputsPath)
+	if err != nil {
+		return err
+	}
+	outputs := w.declaredOutputs()
+	for _, p := range recorded {
+		outputs[p] = true
+	}
+	paths := []string{}
+	for p := range outputs {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	b, err := json.MarshalIndent(paths, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := w.OutputsPath + ".tmp"
+	err = ioutil.WriteFile(tmp, b, w.fileMode())
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.OutputsPath)
+}
+
+// readOutputs reads the outputs recorded at path. A missing record has none
+func readOutputs(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	err = json.Unmarshal(b, &paths)
+	if err != nil {
+		return nil, fmt.Errorf("reading recorded outputs: %v", err)
+	}
+	return paths, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGC(t *testing.T) {
+	defer cleanTestData(t)
+	yamlPath := writeTestYaml(t, "GC", `
+workflow_dir: .
+jobs:
+- name: build
+  cmd: echo built > build.out
+  outputs: [build.out]
+  artifacts: [build.out]
+- name: docs
+  cmd: echo docs > docs.out
+  outputs: [docs.out]
+  artifacts: [docs.out]
+`)
+	wf, err := workflowFromYaml(yamlPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectZero(t, wf.Run())
+
+	writeTestYaml(t, "GC", `
+workflow_dir: .
+jobs:
+- name: build
+  cmd: echo built > build.out
+  outputs: [build.out]
+  artifacts: [build.out]
+`)
+	wf, err = workflowFromYaml(yamlPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphans := []string{wf.pathToWDir("docs.out"), wf.ArtifactsDir + "/docs"}
+	kept := []string{wf.pathToWDir("build.out"), wf.ArtifactsDir + "/build"}
+
+	out := &bytes.Buffer{}
+	if err := wf.gc(out, true); err != nil {
+		t.Fatal(err)
+	}
+	want := "would remove " + orphans[1] + "\nwould remove " + orphans[0] + "\n"
+	if out.String() != want {
+		t.Errorf("expected the dry run to list %q, got %q", want, out.String())
+	}
+	for _, p := range append(orphans, kept...) {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("expected the dry run to keep %s: %v", p, err)
+		}
+	}
+
+	out.Reset()
+	if err := wf.gc(out, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(out.String(), "removed "); got != len(orphans) {
+		t.Errorf("expected %d paths removed, got %q", len(orphans), out.String())
+	}
+	for _, p := range orphans {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %v", p, err)
+		}
+	}
+	for _, p := range kept {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("expected %s of a current job to be kept: %v", p, err)
+		}
+	}
+}
+
+func TestGCAfterRun(t *testing.T) {
+	defer cleanTestData(t)
+	yamlPath := writeTestYaml(t, "GCAfterRun", `
+workflow_dir: .
+jobs:
+- name: build
+  cmd: echo built > build.out
+  outputs: [build.out]
+- name: docs
+  cmd: echo docs > docs.out
+  outputs: [docs.out]
+`)
+	wf, err := workflowFromYaml(yamlPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectZero(t, wf.Run())
+
+	writeTestYaml(t, "GCAfterRun", `
+workflow_dir: .
+jobs:
+- name: build
+  cmd: echo built > build.out
+  outputs: [build.out]
+`)
+	wf, err = workflowFromYaml(yamlPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectZero(t, wf.Run())
+
+	out := &bytes.Buffer{}
+	if err := wf.gc(out, false); err != nil {
+		t.Fatal(err)
+	}
+	if want := "removed " + wf.pathToWDir("docs.out") + "\n"; out.String() != want {
+		t.Errorf("expected the output of the removed job to be removed once the new spec ran, want %q, got %q", want, out.String())
+	}
+	if _, err := os.Stat(wf.pathToWDir("build.out")); err != nil {
+		t.Errorf("expected the output of a current job to be kept: %v", err)
+	}
+}
+
+func TestGCNestedOutput(t *testing.T) {
+	defer cleanTestData(t)
+	yamlPath := writeTestYaml(t, "GCNestedOutput", `
+workflow_dir: .
+jobs:
+- name: build
+  cmd: mkdir -p out && echo a > out/a.txt
+  outputs: [out]
+`)
+	wf, err := workflowFromYaml(yamlPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectZero(t, wf.Run())
+
+	writeTestYaml(t, "GCNestedOutput", `
+workflow_dir: .
+jobs:
+- name: build
+  cmd: mkdir -p out && echo a > out/a.txt
+  outputs: [out/a.txt]
+`)
+	wf, err = workflowFromYaml(yamlPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	if err := wf.gc(out, false); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "" {
+		t.Errorf("expected nothing removed, got %q", out.String())
+	}
+	if _, err := os.Stat(wf.pathToWDir("out", "a.txt")); err != nil {
+		t.Errorf("expected the output of a current job within an old output to be kept: %v", err)
+	}
+}
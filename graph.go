@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Graph formats printed by the graph command
+const (
+	GraphFormatDOT  = "dot"
+	GraphFormatJSON = "json"
+)
+
+const (
+	unvisited int = iota
+	visiting
+	visited
+)
+
+// sortJobs topologically sorts every job reachable from the workflow,
+// dependencies before the jobs that depend on them. If the dependency
+// graph contains a cycle an error naming the jobs in the cycle is returned.
+func (w *Workflow) sortJobs() ([]*Job, error) {
+	state := map[*Job]int{}
+	sorted := []*Job{}
+	stack := []*Job{}
+
+	var visit func(j *Job) error
+	visit = func(j *Job) error {
+		switch state[j] {
+		case visited:
+			return nil
+		case visiting:
+			return cycleError(stack, j)
+		}
+		state[j] = visiting
+		stack = append(stack, j)
+		for _, d := range j.Dependencies {
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[j] = visited
+		sorted = append(sorted, j)
+		return nil
+	}
+
+	for _, j := range w.Jobs {
+		if err := visit(j); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+func cycleError(stack []*Job, j *Job) error {
+	start := 0
+	for i, s := range stack {
+		if s == j {
+			start = i
+			break
+		}
+	}
+	names := []string{}
+	for _, s := range append(stack[start:], j) {
+		names = append(names, s.label())
+	}
+	return fmt.Errorf("dependency cycle: %s", strings.Join(names, " -> "))
+}
+
+// Validate checks the workflow can be run, returning an error
+// describing the problem if the jobs' dependencies contain a cycle,
+// jobs that may run concurrently write the same output
+// or the workflow dir cannot be written
+func (w *Workflow) Validate() error {
+	sorted, err := w.sortJobs()
+	if err != nil {
+		return err
+	}
+	err = outputConflict(sorted)
+	if err != nil {
+		return err
+	}
+	return w.checkWritable()
+}
+
+// outputConflict returns an error naming the first two jobs whose Outputs overlap,
+// the same path or one within the other, when neither depends on the other
+func outputConflict(sorted []*Job) error {
+	ancestors := map[*Job]map[*Job]bool{}
+	for _, j := range sorted {
+		ancestors[j] = map[*Job]bool{}
+		for _, d := range j.Dependencies {
+			ancestors[j][d] = true
+			for a := range ancestors[d] {
+				ancestors[j][a] = true
+			}
+		}
+	}
+	for i, a := range sorted {
+		for _, b := range sorted[i+1:] {
+			if ancestors[a][b] || ancestors[b][a] {
+				continue
+			}
+			for _, outA := range a.Outputs {
+				for _, outB := range b.Outputs {
+					pathA, pathB := a.pathToOutput(outA), b.pathToOutput(outB)
+					if within(pathA, pathB) || within(pathB, pathA) {
+						return fmt.Errorf("jobs %s and %s both write output %s and do not depend on each other",
+							a.label(), b.label(), pathA)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// allJobs returns every job reachable from the workflow ordered by id,
+// unlike sortJobs it succeeds when the dependencies contain a cycle
+func (w *Workflow) allJobs() []*Job {
+	seen := map[*Job]bool{}
+	jobs := []*Job{}
+	var visit func(j *Job)
+	visit = func(j *Job) {
+		if seen[j] {
+			return
+		}
+		seen[j] = true
+		jobs = append(jobs, j)
+		for _, d := range j.Dependencies {
+			visit(d)
+		}
+	}
+	for _, j := range w.Jobs {
+		visit(j)
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].ID < jobs[b].ID })
+	return jobs
+}
+
+// onlyJobs narrows the sorted jobs to the jobs selected by only, comma separated job IDs
+// or glob patterns matching job Names such as build-*, and the jobs they transitively depend on,
+// keeping their order. Every pattern must select at least one job
+func onlyJobs(sorted []*Job, only string) ([]*Job, error) {
+	targets := []*Job{}
+	for _, pattern := range strings.Split(only, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid job pattern '%s': %v", pattern, err)
+		}
+		matched := false
+		for _, j := range sorted {
+			if ok, _ := path.Match(pattern, j.Name); (ok && j.Name != "") || strconv.Itoa(j.ID) == pattern {
+				targets = append(targets, j)
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no job named '%s'", pattern)
+		}
+	}
+	return withDependencies(sorted, targets), nil
+}
+
+// withDependencies narrows the sorted jobs to the targets and the jobs they transitively
+// depend on, keeping their order
+func withDependencies(sorted []*Job, targets []*Job) []*Job {
+	closure := map[*Job]bool{}
+	var visit func(j *Job)
+	visit = func(j *Job) {
+		if closure[j] {
+			return
+		}
+		closure[j] = true
+		for _, d := range j.Dependencies {
+			visit(d)
+		}
+	}
+	for _, target := range targets {
+		visit(target)
+	}
+
+	jobs := []*Job{}
+	for _, j := range sorted {
+		if closure[j] {
+			jobs = append(jobs, j)
+		}
+	}
+	return jobs
+}
+
+// ToDOT renders the workflow's jobs as a Graphviz digraph, with an edge
+// from each dependency to the job depending on it
+func (w *Workflow) ToDOT() string {
+	b := &strings.Builder{}
+	b.WriteString("digraph workflow {\n")
+	jobs := w.allJobs()
+	for _, j := range jobs {
+		fmt.Fprintf(b, "  %d [label=%s];\n", j.ID, strconv.Quote(fmt.Sprintf("%d: %s", j.ID, j.Cmd)))
+	}
+	for _, j := range jobs {
+		for _, d := range j.Dependencies {
+			fmt.Fprintf(b, "  %d -> %d;\n", d.ID, j.ID)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// graphSchemaVersion is bumped whenever a field of the json graph changes meaning or is removed
+const graphSchemaVersion = 1
+
+// graphNode is a job of the json graph
+type graphNode struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Cmd  string `json:"cmd"`
+}
+
+// graphEdge is a dependency of the json graph, To depends on From
+type graphEdge struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+type graph struct {
+	SchemaVersion int         `json:"schema_version"`
+	Nodes         []graphNode `json:"nodes"`
+	Edges         []graphEdge `json:"edges"`
+}
+
+// GraphJSON renders the workflow's jobs as json for other tools: a node for each job in ID order
+// and an edge from each dependency to the job depending on it, ordered by the ids they connect
+func (w *Workflow) GraphJSON() ([]byte, error) {
+	g := graph{SchemaVersion: graphSchemaVersion, Nodes: []graphNode{}, Edges: []graphEdge{}}
+	for _, j := range w.allJobs() {
+		g.Nodes = append(g.Nodes, graphNode{j.ID, j.Name, j.Cmd})
+		for _, d := range j.Dependencies {
+			g.Edges = append(g.Edges, graphEdge{d.ID, j.ID})
+		}
+	}
+	sort.Slice(g.Edges, func(a, b int) bool {
+		if g.Edges[a].From != g.Edges[b].From {
+			return g.Edges[a].From < g.Edges[b].From
+		}
+		return g.Edges[a].To < g.Edges[b].To
+	})
+	return json.MarshalIndent(g, "", "  ")
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestToDOT(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "ToDOT")
+	a := newJob(wf, []string{}, []*Job{}, []string{}, false, "echo a > a.txt")
+	b := newJob(wf, []string{}, []*Job{a}, []string{}, false, `grep "a" a.txt`)
+	c := newJob(wf, []string{}, []*Job{a, b}, []string{}, false, "echo c")
+	wf.AddJob(c)
+
+	want := `digraph workflow {
+  1 [label="1: echo a > a.txt"];
+  2 [label="2: grep \"a\" a.txt"];
+  3 [label="3: echo c"];
+  1 -> 2;
+  1 -> 3;
+  2 -> 3;
+}
+`
+	if got := wf.ToDOT(); got != want {
+		t.Errorf("expected dot:\n%s\ngot:\n%s", want, got)
+	}
+
+	// cycles still render
+	a.AddDependency(c)
+	want = `digraph workflow {
+  1 [label="1: echo a > a.txt"];
+  2 [label="2: grep \"a\" a.txt"];
+  3 [label="3: echo c"];
+  3 -> 1;
+  1 -> 2;
+  1 -> 3;
+  2 -> 3;
+}
+`
+	if got := wf.ToDOT(); got != want {
+		t.Errorf("expected dot with a cycle:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestGraphJSON(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "GraphJSON")
+	a := newJob(wf, []string{}, []*Job{}, []string{}, false, "echo a > a.txt")
+	b := newJob(wf, []string{}, []*Job{a}, []string{}, false, "cat a.txt")
+	c := newJob(wf, []string{}, []*Job{b, a}, []string{}, false, "echo c")
+	a.Name = "a"
+	wf.AddJob(c)
+
+	out, err := wf.GraphJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"schema_version": 1.0,
+		"nodes": []interface{}{
+			map[string]interface{}{"id": 1.0, "name": "a", "cmd": "echo a > a.txt"},
+			map[string]interface{}{"id": 2.0, "name": "", "cmd": "cat a.txt"},
+			map[string]interface{}{"id": 3.0, "name": "", "cmd": "echo c"},
+		},
+		"edges": []interface{}{
+			map[string]interface{}{"from": 1.0, "to": 2.0},
+			map[string]interface{}{"from": 1.0, "to": 3.0},
+			map[string]interface{}{"from": 2.0, "to": 3.0},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected graph json %v, got:\n%s", want, out)
+	}
+}
+
+func TestOnlyJob(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "OnlyJob")
+	a := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	b := newJob(wf, []string{}, []*Job{a}, []string{}, false, "true")
+	c := newJob(wf, []string{}, []*Job{b}, []string{}, false, "true")
+	d := newJob(wf, []string{}, []*Job{a}, []string{}, false, "true")
+	e := newJob(wf, []string{}, []*Job{c, d}, []string{}, false, "true")
+	f := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	c.Name = "c"
+	wf.AddJob(e, f)
+	wf.Only = "c"
+	expectZero(t, wf.Run())
+
+	events := jobEvents(t, wf)
+	for _, j := range []*Job{a, b, c} {
+		if j.Status != StatusSucceeded || events[j.ID] == nil {
+			t.Errorf("expected job %d in the closure of c to run, got %s", j.ID, j.Status)
+		}
+	}
+	for _, j := range []*Job{d, e, f} {
+		if j.Attempts != 0 || events[j.ID] != nil {
+			t.Errorf("expected job %d outside the closure of c not to run", j.ID)
+		}
+	}
+
+	wf.Only = "missing"
+	if status := wf.Run(); status != ExitInvalidWorkflow {
+		t.Errorf("expected exit status %d for an unknown job, got %d", ExitInvalidWorkflow, status)
+	}
+}
+
+func TestOnlyJobGlob(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "OnlyJobGlob")
+	setup := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	buildA := newJob(wf, []string{}, []*Job{setup}, []string{}, false, "true")
+	buildB := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	testA := newJob(wf, []string{}, []*Job{buildA}, []string{}, false, "true")
+	lint := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	deploy := newJob(wf, []string{}, []*Job{testA}, []string{}, false, "true")
+	unnamed := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	setup.Name, buildA.Name, buildB.Name = "setup", "build-a", "build-b"
+	testA.Name, lint.Name, deploy.Name = "test-a", "lint", "deploy"
+	wf.AddJob(buildB, lint, deploy, unnamed)
+	wf.Only = "build-*, lint"
+	expectZero(t, wf.Run())
+
+	for _, j := range []*Job{setup, buildA, buildB, lint} {
+		if j.Status != StatusSucceeded || j.Attempts != 1 {
+			t.Errorf("expected job %s selected by the patterns or a dependency to run, got %s", j.label(), j.Status)
+		}
+	}
+	for _, j := range []*Job{testA, deploy, unnamed} {
+		if j.Attempts != 0 {
+			t.Errorf("expected job %s not selected by the patterns not to run", j.label())
+		}
+	}
+
+	for _, only := range []string{"build-*,nothing-*", "build-["} {
+		wf := testWorkflow(t, "OnlyJobGlob")
+		j := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+		j.Name = "build-a"
+		wf.AddJob(j)
+		wf.Only = only
+		if status := wf.Run(); status != ExitInvalidWorkflow {
+			t.Errorf("expected exit status %d for only '%s', got %d", ExitInvalidWorkflow, only, status)
+		}
+	}
+}
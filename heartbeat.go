@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// errJobStalled is returned when a job with a Heartbeat wrote no output for that long
+var errJobStalled = errors.New("no output (stalled)")
+
+// heartbeat records when a job last wrote to its stdout or stderr
+type heartbeat struct {
+	last int64
+}
+
+func newHeartbeat() *heartbeat {
+	return &heartbeat{last: time.Now().UnixNano()}
+}
+
+func (h *heartbeat) Write(b []byte) (int, error) {
+	atomic.StoreInt64(&h.last, time.Now().UnixNano())
+	return len(b), nil
+}
+
+// idle returns how long it has been since the job last wrote output
+func (h *heartbeat) idle() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&h.last)))
+}
+
+// watchHeartbeat cancels the attempt with errJobStalled once h has seen no output for interval,
+// until ctx is done
+func watchHeartbeat(ctx context.Context, cancel context.CancelCauseFunc, h *heartbeat, interval time.Duration) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		idle := h.idle()
+		if idle >= interval {
+			cancel(errJobStalled)
+			return
+		}
+		timer.Reset(interval - idle)
+	}
+}
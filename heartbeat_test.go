@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeartbeat(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "Heartbeat")
+	wf.KeepGoing = true
+	wf.gracePeriod = 100 * time.Millisecond
+	stalled := newJob(wf, []string{}, []*Job{}, []string{}, false, "echo started; sleep 30")
+	stalled.Heartbeat = Duration{300 * time.Millisecond}
+	alive := newJob(wf, []string{}, []*Job{}, []string{}, false,
+		"for i in $(seq 1 10); do echo $i >&2; sleep 0.1; done")
+	alive.Heartbeat = Duration{500 * time.Millisecond}
+	wf.AddJob(stalled, alive)
+
+	start := time.Now()
+	if status := wf.Run(); status != ExitJobsFailed {
+		t.Errorf("expected exit %d, wf exited %d", ExitJobsFailed, status)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected the stalled job to be killed, took %v", elapsed)
+	}
+	if stalled.Status != StatusFailed || stalled.Reason != "no output (stalled)" {
+		t.Errorf("expected the job without output to fail as stalled, got %s: %s", stalled.Status, stalled.Reason)
+	}
+	if failures := wf.failedJobs.List(); len(failures) != 1 || failures[0].Reason != FailureStalled {
+		t.Errorf("expected a single %s failure, got %v", FailureStalled, failures)
+	}
+	if alive.Status != StatusSucceeded {
+		t.Errorf("expected the job writing output more often than its heartbeat to succeed, got %s: %s",
+			alive.Status, alive.Reason)
+	}
+}
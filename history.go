@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// historySize is how many of the most recent runs the history of a workflow keeps
+const historySize = 50
+
+// runRecord summarizes one run of a workflow in its history
+type runRecord struct {
+	StartedAt  time.Time `json:"started_at"`
+	ExitStatus int       `json:"exit_status"`
+	Duration   Duration  `json:"duration"`
+}
+
+// exitStatusNames are shown for the exit statuses in the history
+var exitStatusNames = map[int]string{
+	ExitSuccess:         "success",
+	ExitJobsFailed:      "failed",
+	ExitInvalidWorkflow: "invalid",
+	ExitInterrupted:     "interrupted",
+	ExitTimeout:         "timeout",
+}
+
+// readHistory reads the runs recorded in the history at path, oldest first.
+// A missing history has no runs
+func readHistory(path string) ([]runRecord, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return []runRecord{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	runs := []runRecord{}
+	err = json.Unmarshal(b, &runs)
+	if err != nil {
+		return nil, fmt.Errorf("reading history: %v", err)
+	}
+	return runs, nil
+}
+
+// recordHistory appends a run to the workflow's history, dropping the oldest runs beyond historySize.
+// The history is replaced whole so a run interrupted while recording leaves the previous history
+func (w *Workflow) recordHistory(start time.Time, exitStatus int) error {
+	runs, err := readHistory(w.HistoryPath)
+	if err != nil {
+		return err
+	}
+	runs = append(runs, runRecord{start, exitStatus, Duration{time.Since(start)}})
+	if len(runs) > historySize {
+		runs = runs[len(runs)-historySize:]
+	}
+	b, err := json.MarshalIndent(runs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := w.HistoryPath + ".tmp"
+	err = ioutil.WriteFile(tmp, b, w.fileMode())
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.HistoryPath)
+}
+
+// printHistory writes a table of the workflow's recorded runs, oldest first.
+// With since set, only the runs started at or after it are listed
+func (w *Workflow) printHistory(out io.Writer, since time.Time) error {
+	runs, err := readHistory(w.HistoryPath)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STARTED\tEXIT STATUS\tDURATION")
+	for _, r := range runs {
+		if r.StartedAt.Before(since) {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d (%s)\t%v\n", r.StartedAt.Format(time.RFC3339), r.ExitStatus,
+			exitStatusNames[r.ExitStatus], r.Duration.Duration)
+	}
+	return tw.Flush()
+}
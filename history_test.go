@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	defer cleanTestData(t)
+	historyWorkflow := func() *Workflow {
+		wf := testWorkflow(t, "History")
+		wf.AddJob(newJob(wf, []string{}, []*Job{}, []string{}, false, "[[ -f fixed ]]"))
+		return wf
+	}
+	wf := historyWorkflow()
+	expectNonZero(t, wf.Run())
+	if err := ioutil.WriteFile(wf.pathToWDir("fixed"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	wf = historyWorkflow()
+	expectZero(t, wf.Run())
+
+	loaded, err := loadWorkflowJSON(wf.WorkflowDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs, err := readHistory(loaded.HistoryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].ExitStatus != ExitJobsFailed || runs[1].ExitStatus != ExitSuccess {
+		t.Fatalf("expected a failed then a successful run, got %+v", runs)
+	}
+	if !runs[0].StartedAt.Before(runs[1].StartedAt) || runs[1].Duration.Duration <= 0 {
+		t.Errorf("expected runs in the order they started with their durations, got %+v", runs)
+	}
+
+	out := &bytes.Buffer{}
+	if err := loaded.printHistory(out, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[1], "1 (failed)") || !strings.Contains(lines[2], "0 (success)") {
+		t.Errorf("expected a header and a line per run, got %q", out.String())
+	}
+}
+
+func TestHistoryPruned(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "HistoryPruned")
+	if err := wf.initWorkflow(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < historySize+3; i++ {
+		if err := wf.recordHistory(time.Now(), i%2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runs, err := readHistory(wf.HistoryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != historySize || runs[0].ExitStatus != 1 {
+		t.Errorf("expected the %d most recent runs, got %d starting with exit status %d", historySize, len(runs), runs[0].ExitStatus)
+	}
+}
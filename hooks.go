@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"sync/atomic"
+)
+
+// Hooks are bash commands run in the workflow dir at points of a run, with the workflow dir
+// in GFLOW_WORKFLOW_DIR, the id of the run in GFLOW_RUN_ID and the hook in GFLOW_HOOK.
+// OnStart runs before any job starts, OnJobComplete once each job is done with its GFLOW_JOB_ID, GFLOW_JOB_NAME, GFLOW_JOB_STATUS
+// and GFLOW_EXIT_CODE, and OnFinish once the run is done with its GFLOW_EXIT_STATUS.
+// A failing hook is logged, with FailOnError set it also fails the workflow: a failing OnStart
+// stops the run before any job starts, otherwise the run exits ExitJobsFailed if it would have succeeded
+type Hooks struct {
+	OnStart       string `json:"on_start,omitempty"`
+	OnJobComplete string `json:"on_job_complete,omitempty"`
+	OnFinish      string `json:"on_finish,omitempty"`
+	FailOnError   bool   `json:"fail_on_error,omitempty"`
+}
+
+// Hook names set in GFLOW_HOOK
+const (
+	hookOnStart       = "on_start"
+	hookOnJobComplete = "on_job_complete"
+	hookOnFinish      = "on_finish"
+)
+
+// runHook runs the hook command cmd named name with env added to its environment,
+// its output is written to the workflow's stdout and stderr. It reports whether the hook succeeded
+func (w *Workflow) runHook(name, cmd string, env ...string) bool {
+	if cmd == "" {
+		return true
+	}
+	c := exec.Command("/bin/bash", "-c", cmd)
+	c.Dir = w.WorkflowDir
+	c.Env = append(append(os.Environ(), "GFLOW_WORKFLOW_DIR="+w.WorkflowDir, "GFLOW_RUN_ID="+w.runID, "GFLOW_HOOK="+name), env...)
+	c.Stdout, c.Stderr = w.stdout, w.stderr
+	err := c.Run()
+	if err == nil {
+		return true
+	}
+	w.logger.Errorf(0, "Workflow %s hook failed: %v", name, err)
+	if w.Hooks.FailOnError {
+		atomic.StoreInt32(&w.hookFailed, 1)
+	}
+	return false
+}
+
+// runJobCompleteHook runs the OnJobComplete hook for the job once it is done
+func (j *Job) runJobCompleteHook() {
+	j.workflow.runHook(hookOnJobComplete, j.workflow.Hooks.OnJobComplete,
+		"GFLOW_JOB_ID="+strconv.Itoa(j.ID), "GFLOW_JOB_NAME="+j.Name,
+		"GFLOW_JOB_STATUS="+j.Status, "GFLOW_EXIT_CODE="+strconv.Itoa(j.ExitCode))
+}
+
+// hooksFailed reports whether a hook failed with FailOnError set
+func (w *Workflow) hooksFailed() bool {
+	return atomic.LoadInt32(&w.hookFailed) == 1
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "Hooks")
+	wf.Hooks = Hooks{
+		OnStart:       `echo "$GFLOW_HOOK $GFLOW_WORKFLOW_DIR" >> hooks.log`,
+		OnJobComplete: `echo "$GFLOW_HOOK $GFLOW_JOB_ID $GFLOW_JOB_NAME $GFLOW_JOB_STATUS $GFLOW_EXIT_CODE" >> hooks.log`,
+		OnFinish:      `echo "$GFLOW_HOOK $GFLOW_EXIT_STATUS" >> hooks.log`,
+	}
+	build := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	build.Name = "build"
+	test := newJob(wf, []string{}, []*Job{build}, []string{}, false, "exit 2")
+	wf.AddJob(test)
+	expectNonZero(t, wf.Run())
+
+	b, err := ioutil.ReadFile(wf.pathToWDir("hooks.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"on_start " + wf.WorkflowDir,
+		fmt.Sprintf("on_job_complete %d build succeeded 0", build.ID),
+		fmt.Sprintf("on_job_complete %d  failed 2", test.ID),
+		fmt.Sprintf("on_finish %d", ExitJobsFailed),
+	}
+	if got := strings.Split(strings.TrimSpace(string(b)), "\n"); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("expected the hooks to run with their env\n%q, got\n%q", want, got)
+	}
+}
+
+func TestFailingHooks(t *testing.T) {
+	defer cleanTestData(t)
+	testCases := []struct {
+		name        string
+		hooks       Hooks
+		expected    int
+		expectedRan bool
+	}{
+		{"OnStart", Hooks{OnStart: "false"}, ExitSuccess, true},
+		{"OnStartFailOnError", Hooks{OnStart: "false", FailOnError: true}, ExitJobsFailed, false},
+		{"OnJobCompleteFailOnError", Hooks{OnJobComplete: "false", FailOnError: true}, ExitJobsFailed, true},
+		{"OnFinish", Hooks{OnFinish: "false"}, ExitSuccess, true},
+		{"OnFinishFailOnError", Hooks{OnFinish: "false", FailOnError: true}, ExitJobsFailed, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wf := testWorkflow(t, "FailingHooks"+tc.name)
+			wf.Hooks = tc.hooks
+			j := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+			wf.AddJob(j)
+			if status := wf.Run(); status != tc.expected {
+				t.Errorf("expected exit %d, wf exited %d", tc.expected, status)
+			}
+			if ran := j.Attempts > 0; ran != tc.expectedRan {
+				t.Errorf("expected the job to have run: %v, attempts: %d", tc.expectedRan, j.Attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+
+	"github.com/ghodss/yaml"
+)
+
+// includeJobs appends the jobs of each file the spec includes, and of the files they include,
+// to the spec's jobs. Included files are relative to the dir of the file including them and only
+// their jobs and includes are used. A job name declared in more than one file is an error
+func includeJobs(spec *Workflow, dir string) error {
+	names := map[string]string{}
+	for _, name := range jobNames(spec.Jobs) {
+		names[name] = "the workflow yaml"
+	}
+	included := map[string]bool{}
+	var include func(files []string, dir string) error
+	include = func(files []string, dir string) error {
+		for _, f := range files {
+			if !path.IsAbs(f) {
+				f = path.Join(dir, f)
+			}
+			abs, err := filepath.Abs(f)
+			if err != nil {
+				return err
+			}
+			if included[abs] {
+				continue
+			}
+			included[abs] = true
+			yamlBytes, err := ioutil.ReadFile(f)
+			if err != nil {
+				return fmt.Errorf("error reading included yaml: %v", err)
+			}
+			var inc Workflow
+			err = yaml.Unmarshal(yamlBytes, &inc)
+			if err != nil {
+				return fmt.Errorf("error unmarshalling included yaml %s: %v", f, err)
+			}
+			for _, name := range jobNames(inc.Jobs) {
+				if other, ok := names[name]; ok {
+					return fmt.Errorf("job name '%s' in included yaml %s is also declared in %s", name, f, other)
+				}
+				names[name] = f
+			}
+			spec.Jobs = append(spec.Jobs, inc.Jobs...)
+			err = include(inc.Include, path.Dir(f))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return include(spec.Include, dir)
+}
+
+// jobNames returns the names of the jobs, and of their nested dependencies, declared with a cmd
+func jobNames(jobs []*Job) []string {
+	names := []string{}
+	for _, j := range jobs {
+		if j.Name != "" && j.Cmd != "" {
+			names = append(names, j.Name)
+		}
+		names = append(names, jobNames(j.Dependencies)...)
+	}
+	return names
+}
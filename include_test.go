@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestIncludeJobs(t *testing.T) {
+	defer cleanTestData(t)
+	yamlPath := writeTestYaml(t, "IncludeJobs", `
+workflow_dir: .
+include: [shared/jobs.yaml]
+jobs:
+- name: deploy
+  cmd: echo deploy
+  depends_on: [test]
+`)
+	dir := path.Dir(yamlPath)
+	shared := map[string]string{
+		"shared/jobs.yaml": `
+include: [lint.yaml]
+jobs:
+- name: build
+  cmd: echo build
+- name: test
+  cmd: echo test
+  depends_on: [build, lint]
+`,
+		"shared/lint.yaml": `
+jobs:
+- name: lint
+  cmd: echo lint
+`,
+		"collision.yaml": `
+jobs:
+- name: deploy
+  cmd: echo deploy again
+`,
+	}
+	for name, content := range shared {
+		if err := writeFile(path.Join(dir, name), content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wf, err := workflowFromYaml(yamlPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]*Job{}
+	names := []string{}
+	for _, j := range wf.allJobs() {
+		byName[j.Name] = j
+		names = append(names, j.Name)
+	}
+	sort.Strings(names)
+	if want := []string{"build", "deploy", "lint", "test"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected the merged jobs %v, got %v", want, names)
+	}
+	test := byName["test"]
+	if len(byName["deploy"].Dependencies) != 1 || byName["deploy"].Dependencies[0] != test {
+		t.Error("expected deploy to depend on the included test job")
+	}
+	if len(test.Dependencies) != 2 || test.Dependencies[0] != byName["build"] || test.Dependencies[1] != byName["lint"] {
+		t.Error("expected test to depend on build and on lint from the nested include")
+	}
+	expectZero(t, wf.Run())
+
+	_, err = workflowFromYaml(writeTestYaml(t, "IncludeJobs", `
+workflow_dir: .
+include: [collision.yaml]
+jobs:
+- name: deploy
+  cmd: echo deploy
+`), "")
+	if err == nil || !strings.Contains(err.Error(), "job name 'deploy'") {
+		t.Errorf("expected an error including a job with the same name, got %v", err)
+	}
+}
+
+func writeFile(p, content string) error {
+	if err := os.MkdirAll(path.Dir(p), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, []byte(content), 0644)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+)
+
+// starterYaml is the workflow.yaml written by gflow init, %s is the workflow dir
+const starterYaml = `# gflow workflow, run it with: gflow run -f workflow.yaml
+workflow_dir: %s
+jobs:
+- name: hello
+  cmd: echo hello > hello.txt
+  outputs: [hello.txt]
+- name: shout
+  cmd: tr a-z A-Z < hello.txt > shout.txt
+  inputs: [hello.txt]
+  outputs: [shout.txt]
+  depends_on: [hello]
+`
+
+// init writes a starter workflow.yaml to the workflow dir and creates its .gflow dirs.
+// An existing workflow.yaml is only replaced with Force set
+func (c *Command) init() int {
+	err := writeStarterWorkflow(c.WorkflowDir, c.Force)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return ExitUsage
+	}
+	fmt.Println("Wrote", path.Join(c.WorkflowDir, "workflow.yaml"))
+	return ExitSuccess
+}
+
+func writeStarterWorkflow(dir string, force bool) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	yamlPath := path.Join(absDir, "workflow.yaml")
+	exists, err := fileExists(yamlPath)
+	if err != nil {
+		return err
+	}
+	if exists && !force {
+		return fmt.Errorf("%s already exists, use -force to overwrite it", yamlPath)
+	}
+	// newWorkflow creates the workflow dir and its .gflow dirs
+	_, err = newWorkflow(absDir)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(yamlPath, []byte(fmt.Sprintf(starterYaml, absDir)), defaultFileMode)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestInitStarterWorkflow(t *testing.T) {
+	defer cleanTestData(t)
+	dir := path.Join(OutputDir, "InitStarterWorkflow")
+	c, err := InitFlags([]string{"init", dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := c.Execute(); status != 0 {
+		t.Fatalf("expected init to succeed, exited %d", status)
+	}
+
+	yamlPath := path.Join(dir, "workflow.yaml")
+	wf, err := workflowFromYaml(yamlPath, "")
+	if err != nil {
+		t.Fatalf("expected the starter workflow to load: %v", err)
+	}
+	names := []string{}
+	for _, j := range wf.allJobs() {
+		names = append(names, j.Name)
+	}
+	sort.Strings(names)
+	if want := []string{"hello", "shout"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected starter jobs %v, got %v", want, names)
+	}
+	for _, d := range []string{wf.ExecDir, wf.LogDir} {
+		if info, err := os.Stat(d); err != nil || !info.IsDir() {
+			t.Errorf("expected init to create %s: %v", d, err)
+		}
+	}
+	expectZero(t, wf.Run())
+
+	if err := ioutil.WriteFile(yamlPath, []byte("# mine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if status := c.Execute(); status == 0 {
+		t.Error("expected init to refuse to overwrite an existing workflow.yaml")
+	}
+	if mine, _ := ioutil.ReadFile(yamlPath); string(mine) != "# mine\n" {
+		t.Errorf("expected the existing workflow.yaml to be kept, got %q", string(mine))
+	}
+	c.Force = true
+	if status := c.Execute(); status != 0 {
+		t.Errorf("expected init -force to overwrite the workflow.yaml, exited %d", status)
+	}
+}
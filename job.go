@@ -1,42 +1,197 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"os/exec"
 	"path"
+	"runtime"
 	"strconv"
 	"sync"
+	"time"
+)
+
+// Job statuses, recorded in the workflow JSON once the workflow has run
+const (
+	StatusPending     = "pending"
+	StatusSucceeded   = "succeeded"
+	StatusFailed      = "failed"
+	StatusSkipped     = "skipped"
+	StatusInterrupted = "interrupted"
+	// StatusCancelled is a running job stopped because another job failed with the workflow's FailFast set
+	StatusCancelled = "cancelled"
+	// StatusFailedAllowed is a job with AllowFailure set that failed, without failing the workflow
+	StatusFailedAllowed = "failed_allowed"
 )
 
 // The Job type abstracts the execution of an executable.
 // A bash script is written to the filesystem for execution
-// the process is waited on to return, then dependent jobs are run.
-// If a job fails, dependent jobs will not execute
+// once every job in Dependencies has succeeded, then the process is waited on to return.
+// If a job fails or is skipped, dependent jobs are skipped and will not execute
 type Job struct {
 	workflow *Workflow
+	done     chan struct{}
 
-	ID           int      `json:"id"`
+	succeededPreviously bool
+	conditionFalse      bool
+	succeededRecently   bool
+	succeededAt         time.Time
+	unselected          bool
+	matrixVars          map[string]string
+	matrixName          string
+	stdinJob            *Job
+	afterJobs           []*Job
+	output              string
+	outputErr           error
+	resolvedCmd         string
+
+	ID   int    `json:"id"`
+	Name string `json:"name,omitempty"`
+	// DependsOn names the jobs it depends on in yaml, alongside nested jobs
+	DependsOn []string `json:"depends_on,omitempty"`
+	// After names jobs to start after once they have finished, the job is not skipped if they fail
+	After []string `json:"after,omitempty"`
+	// Matrix expands the job into a job for each combination of its values
+	Matrix map[string][]string `json:"matrix,omitempty"`
+	// Stage starts the job once all jobs of the workflow's previous stage have succeeded
+	Stage string `json:"stage,omitempty"`
+	// Tags label the job for selecting the jobs a workflow runs
+	Tags []string `json:"tags,omitempty"`
+	// Labels are recorded in the event DB with each of the job's events, over the workflow's Labels
+	Labels map[string]string `json:"labels,omitempty"`
+	// Directories are created in the workflow dir before the job executes
 	Directories  []string `json:"directories"`
 	Dependencies []*Job   `json:"dependencies"`
-	Outputs      []string `json:"outputs"`
-	CleanTmp     bool     `json:"clean_tmp"`
-	Cmd          string   `json:"cmd"`
+	// Capture, stdout or file:PATH, captures the output its dependents reference as ${jobs.NAME.output}
+	Capture string `json:"capture,omitempty"`
+	// Lock lets only one of the jobs with the same Lock execute at a time, held until all attempts are done
+	Lock string `json:"lock,omitempty"`
+	// Outputs must exist once the job exits zero, and not be empty with OutputsNonEmpty set
+	// Outputs newer than all of the Inputs leave the job up to date and not run again
+	Outputs []string `json:"outputs"`
+	Inputs  []string `json:"inputs,omitempty"`
+	// Artifacts globs are copied to .gflow/artifacts/<name> once the job succeeds, a glob matching nothing fails it
+	Artifacts       []string `json:"artifacts,omitempty"`
+	OutputsNonEmpty bool     `json:"outputs_non_empty,omitempty"`
+	// CleanTmp removes the job's tmp dir once it finishes, otherwise it is left for inspection
+	CleanTmp bool   `json:"clean_tmp"`
+	Cmd      string `json:"cmd"`
+	// Args are set by a cmd given in yaml as a list. The job script execs them each shell-quoted,
+	// so none is interpreted by the shell
+	Args []string `json:"args,omitempty"`
+	// StdinFrom names a job whose stdout log is the job's stdin, the job depends on it
+	StdinFrom string `json:"stdin_from,omitempty"`
+	// Shell runs the cmd instead of the workflow's Shell
+	Shell string `json:"shell,omitempty"`
+	// OnExit runs once a job that executed has finished, whether or not it succeeded
+	OnExit string `json:"on_exit,omitempty"`
+	// AllowFailure marks a failed job failed_allowed, it does not fail the workflow and its dependents still run
+	AllowFailure bool `json:"allow_failure,omitempty"`
+	// When is a condition that skips the job if false, its dependents still run
+	When string `json:"when,omitempty"`
+	// Image runs the job in a docker container of that image
+	Image string `json:"image,omitempty"`
+	// Host, "host" or "user@host", runs the job over ssh configured by the workflow's SSH
+	Host string `json:"host,omitempty"`
+	// WorkDir is where the command runs, relative to the workflow dir, and what relative Outputs resolve against
+	WorkDir string            `json:"work_dir,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	// Secrets are added to the workflow Secrets set in the job's environment
+	Secrets []string `json:"secrets,omitempty"`
+	// Timeout kills and fails a job running longer than it
+	Timeout Duration `json:"timeout"`
+	// Heartbeat kills and fails as stalled a job writing nothing to stdout or stderr for that long
+	Heartbeat Duration `json:"heartbeat"`
+	// SucceededWithin skips the job if a job of the same configuration succeeded less than that long ago
+	SucceededWithin Duration `json:"skip_if_succeeded_within"`
+	// Resources limits fail the job when exceeded, only enforced on Linux
+	Resources *Resources `json:"resources,omitempty"`
+	// Priority starts jobs waiting for the workflow's MaxParallel slots highest first
+	Priority int `json:"priority,omitempty"`
+	// Nice is the niceness of a local process, from -20 to 19, values out of range are clamped
+	Nice int `json:"nice,omitempty"`
+	// Umask, such as "0027", is what the command creates files with instead of gflow's
+	Umask *Mode `json:"umask,omitempty"`
+	// Retries is how many more times a failed job is retried, at most the workflow's MaxRetriesCap,
+	// waiting RetryDelay between attempts
+	// With RetryExitCodes set only an attempt exiting with one of those codes is retried
+	Retries        int      `json:"retries"`
+	RetryDelay     Duration `json:"retry_delay"`
+	RetryBackoff   string   `json:"retry_backoff,omitempty"`
+	RetryMaxDelay  Duration `json:"retry_max_delay"`
+	RetryJitter    bool     `json:"retry_jitter,omitempty"`
+	RetryExitCodes []int    `json:"retry_on_exit_codes,omitempty"`
+	// Restart is one of the Restart policies
+	Restart     string `json:"restart,omitempty"`
+	MaxRestarts int    `json:"max_restarts,omitempty"`
+	// StdoutLog and StderrLog get the stdout and stderr of every attempt
+	StdoutLog string `json:"stdout_log,omitempty"`
+	StderrLog string `json:"stderr_log,omitempty"`
+	// TmpDir is .gflow/tmp/job_<ID>, set in the job's environment as GFLOW_TMP and emptied before each attempt
+	TmpDir   string `json:"tmp_dir,omitempty"`
+	Attempts int    `json:"attempts,omitempty"`
+	// ExitCode, StartedAt and FinishedAt are only written by the job's own goroutine and read once it is done
+	ExitCode   int        `json:"exit_code"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Duration   Duration   `json:"duration"`
+	Status     string     `json:"status,omitempty"`
+	Reason     string     `json:"reason,omitempty"`
 }
 
 func newJob(wf *Workflow, dirs []string, deps []*Job, outputs []string, clean bool, cmd string) *Job {
-	JobID := wf.incrementCurrentJobID()
-	job := &Job{wf, JobID, dirs, deps, outputs, clean, cmd}
-	job.Cmd = templateExecutable(job)
+	job := &Job{
+		workflow:     wf,
+		ID:           wf.incrementCurrentJobID(),
+		Directories:  dirs,
+		Dependencies: deps,
+		Outputs:      outputs,
+		CleanTmp:     clean,
+		Cmd:          cmd,
+	}
 	return job
 }
 
 func (j *Job) initJob() error {
-	j.createJobDirs()
-	j.writeCommandScript()
-	err := j.createDirectories()
-	return err
+	j.done = make(chan struct{})
+	j.Status = StatusPending
+	j.Attempts = 0
+	j.Reason = ""
+	j.ExitCode = 0
+	j.StartedAt, j.FinishedAt = nil, nil
+	j.Duration = Duration{}
+	j.succeededPreviously = false
+	j.conditionFalse = false
+	j.succeededRecently = false
+	j.resolvedCmd = ""
+	j.StdoutLog = j.pathToOutLog()
+	j.StderrLog = j.pathToErrLog()
+	j.TmpDir = j.pathToTmp()
+	if nice := clampNice(j.Nice); nice != j.Nice {
+		j.infof("Job Nice Clamped: %d is out of range, using %d", j.Nice, nice)
+		j.Nice = nice
+	}
+	err := j.createJobDirs()
+	if err != nil {
+		return err
+	}
+	err = j.writeCommandScript()
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(j.workDir(), j.workflow.dirMode())
+}
+
+// label names the job in messages, by its Name if it has one or else its ID
+func (j *Job) label() string {
+	if j.Name != "" {
+		return j.Name
+	}
+	return strconv.Itoa(j.ID)
 }
 
 // AddDependency adds a job dependency the current job instance
@@ -44,36 +199,97 @@ func (j *Job) AddDependency(deps ...*Job) {
 	j.Dependencies = append(j.Dependencies, deps...)
 }
 
+// dependsOn reports whether d is one of the job's direct dependencies
+func (j *Job) dependsOn(d *Job) bool {
+	for _, dep := range j.Dependencies {
+		if dep == d {
+			return true
+		}
+	}
+	return false
+}
+
+// isAfter reports whether d is a dependency only because the job is After it
+func (j *Job) isAfter(d *Job) bool {
+	for _, dep := range j.afterJobs {
+		if dep == d {
+			return true
+		}
+	}
+	return false
+}
+
+// openStdin opens the stdout log of the job named by StdinFrom to be the job's stdin,
+// it returns nil if the job has no StdinFrom
+func (j *Job) openStdin() (*os.File, error) {
+	if j.stdinJob == nil {
+		return nil, nil
+	}
+	return os.Open(j.stdinJob.StdoutLog)
+}
+
 func (j *Job) pathToExec(s ...string) string {
 	jobExecDir := []string{j.workflow.ExecDir, strconv.Itoa(j.ID)}
 	return path.Join(append(jobExecDir, s...)...)
 }
 
-func (j *Job) pathToLog(s ...string) string {
-	jobLogDir := []string{j.workflow.LogDir, strconv.Itoa(j.ID)}
-	return path.Join(append(jobLogDir, s...)...)
-}
-
 func (j *Job) pathToTmp(s ...string) string {
-	jobTmpDir := []string{j.workflow.TmpDir, strconv.Itoa(j.ID)}
+	jobTmpDir := []string{j.workflow.TmpDir, "job_" + strconv.Itoa(j.ID)}
 	return path.Join(append(jobTmpDir, s...)...)
 }
 
+// workDir is the absolute path the job's command runs in
+func (j *Job) workDir() string {
+	if path.IsAbs(j.WorkDir) {
+		return j.WorkDir
+	}
+	return j.workflow.pathToWDir(j.WorkDir)
+}
+
+// pathToOutput resolves an output path relative to the job's working directory
+func (j *Job) pathToOutput(output string) string {
+	if path.IsAbs(output) {
+		return output
+	}
+	return path.Join(j.workDir(), output)
+}
+
+// cleanTmp removes the job's tmp dir once it has finished, if CleanTmp is set
+func (j *Job) cleanTmp() {
+	if !j.CleanTmp {
+		return
+	}
+	err := os.RemoveAll(j.pathToTmp())
+	if err != nil {
+		j.errorf("Failed removing tmp dir: %v", err)
+	}
+}
+
 func (j *Job) pathToOutLog() string {
-	return j.pathToLog("stdout.log")
+	return path.Join(j.workflow.LogDir, "job_"+strconv.Itoa(j.ID)+".stdout.log")
 }
 
 func (j *Job) pathToErrLog() string {
-	return j.pathToLog("stderr.log")
+	return path.Join(j.workflow.LogDir, "job_"+strconv.Itoa(j.ID)+".stderr.log")
 }
 
-func (j *Job) createJobDirs() {
-	for _, d := range []string{j.pathToLog(), j.pathToExec(), j.pathToTmp()} {
-		err := os.MkdirAll(d, 0755)
+// resetTmp empties the job's tmp dir
+func (j *Job) resetTmp() error {
+	err := os.RemoveAll(j.pathToTmp())
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(j.pathToTmp(), j.workflow.dirMode())
+}
+
+func (j *Job) createJobDirs() error {
+	for _, d := range []string{j.workflow.LogDir, j.pathToExec(), j.pathToTmp()} {
+		err := os.MkdirAll(d, j.workflow.dirMode())
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 	}
+	return nil
 }
 
 func fileExists(path string) (exists bool, err error) {
@@ -84,40 +300,53 @@ func fileExists(path string) (exists bool, err error) {
 	return err == nil, nil
 }
 
-func (j *Job) createDirectories() (err error) {
+// createDirectories creates the job's Directories in the workflow dir
+func (j *Job) createDirectories() error {
 	for _, d := range j.Directories {
 		d = path.Join(j.workflow.WorkflowDir, d)
-		exists, err := fileExists(d)
+		info, err := os.Stat(d)
 		switch {
-		case err != nil:
-			log.Printf("Failed to stat dir '%s' job_id:%d error:'%s'", d, j.ID, err.Error())
-			return err
-		case exists:
-			return nil
-		default:
-			log.Println("creating: ", d)
-			err = os.MkdirAll(d, 0755)
-			if err != nil {
-				return err
-			}
+		case err == nil && !info.IsDir():
+			return fmt.Errorf("could not create directory %s: a file exists at its path", d)
+		case err == nil:
+			continue
+		case !os.IsNotExist(err):
+			return fmt.Errorf("could not create directory %s: %v", d, err)
+		}
+		j.infof("creating: %s", d)
+		err = os.MkdirAll(d, j.workflow.dirMode())
+		if err != nil {
+			return fmt.Errorf("could not create directory %s: %v", d, err)
 		}
 	}
-	return
+	return nil
 }
 
-func (j *Job) writeCommandScript() {
-	err := ioutil.WriteFile(j.pathToExec("exe"), []byte(j.Cmd), 0755)
+func (j *Job) writeCommandScript() error {
+	if j.Retries > j.retries() {
+		j.infof("Warning: %d retries requested, capped at the workflow's max of %d", j.Retries, j.retries())
+	}
+	if j.Resources != nil && !resourceLimitsSupported {
+		j.infof("Warning: resource limits are not supported on %s and will be ignored", runtime.GOOS)
+	}
+	script, err := templateExecutable(j)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	err = ioutil.WriteFile(j.pathToExec("exe"), []byte(script), j.workflow.execMode())
+	if err == nil {
+		j.debugf("Wrote script %s", j.pathToExec("exe"))
+	}
+	return err
 }
 
 func (j *Job) openLogs() (outLog, errLog *os.File, err error) {
-	outLog, err = os.Create(j.pathToOutLog())
+	create := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	outLog, err = os.OpenFile(j.pathToOutLog(), create, j.workflow.fileMode())
 	if err != nil {
 		return nil, nil, err
 	}
-	errLog, err = os.Create(j.pathToErrLog())
+	errLog, err = os.OpenFile(j.pathToErrLog(), create, j.workflow.fileMode())
 	if err != nil {
 		return outLog, nil, err
 	}
@@ -128,20 +357,98 @@ func (j *Job) checkOutputs() bool {
 	if len(j.Outputs) == 0 {
 		return false
 	}
+	stale, err := j.staleOutput(time.Time{})
+	if err != nil {
+		j.errorf("Failed checking outputs error:'%s'", err.Error())
+		return false
+	}
+	return stale == ""
+}
+
+// missingOutput returns the first declared output that does not exist,
+// or is empty when OutputsNonEmpty is set, describing why it is missing
+func (j *Job) missingOutput() (string, error) {
 	for _, f := range j.Outputs {
-		exists, err := fileExists(f)
+		f = j.pathToOutput(f)
+		info, err := os.Stat(f)
+		switch {
+		case os.IsNotExist(err):
+			return "missing output: " + f, nil
+		case err != nil:
+			return "", err
+		case j.OutputsNonEmpty && info.Size() == 0 && !info.IsDir():
+			return "empty output: " + f, nil
+		}
+	}
+	return "", nil
+}
+
+// staleOutput returns why the job's outputs are out of date: an output is missing,
+// or older than one of the job's Inputs, the stdout log it reads as its stdin or than since.
+// Up to date outputs return ""
+func (j *Job) staleOutput(since time.Time) (string, error) {
+	missing, err := j.missingOutput()
+	if err != nil || missing != "" {
+		return missing, err
+	}
+	newest := since
+	newestName := "the last run"
+	for _, f := range j.Inputs {
+		f = j.pathToOutput(f)
+		info, err := os.Stat(f)
+		switch {
+		case os.IsNotExist(err):
+			return "missing input: " + f, nil
+		case err != nil:
+			return "", err
+		case info.ModTime().After(newest):
+			newest, newestName = info.ModTime(), f
+		}
+	}
+	if j.stdinJob != nil {
+		info, err := os.Stat(j.stdinJob.StdoutLog)
+		if err == nil && info.ModTime().After(newest) {
+			newest, newestName = info.ModTime(), j.stdinJob.StdoutLog
+		}
+	}
+	for _, f := range j.Outputs {
+		f = j.pathToOutput(f)
+		info, err := os.Stat(f)
 		if err != nil {
-			log.Printf("Failed to stat file '%s' job_id:%d error:'%s'", f, j.ID, err.Error())
-			return false
+			return "", err
+		}
+		if info.ModTime().Before(newest) {
+			return fmt.Sprintf("output %s is older than %s", f, newestName), nil
 		}
-		return exists
 	}
-	return true
+	return "", nil
 }
 
+// Reasons a job is recorded in failedJobs
+const (
+	FailureNonzeroExit       = "nonzero exit"
+	FailureTimeout           = "timeout"
+	FailureStalled           = "stalled"
+	FailureMissingOutput     = "missing output"
+	FailureResourceLimit     = "resource limit"
+	FailureSignal            = "killed by signal"
+	FailureSkippedDependency = "skipped dependency"
+	FailureError             = "error"
+)
+
+// jobFailure records a job that failed, or was skipped because a dependency did not succeed
+type jobFailure struct {
+	Job       *Job
+	Reason    string
+	Detail    string
+	ExitCode  int
+	StderrLog string
+}
+
+// failedJobs collects the failures of jobs, which are added concurrently as jobs finish
 type failedJobs struct {
-	jobs  []*Job
-	mutex *sync.Mutex
+	failures []jobFailure
+	mutex    *sync.Mutex
 }
 
 func newFailedJobs() *failedJobs {
@@ -150,49 +457,464 @@ func newFailedJobs() *failedJobs {
 	return fj
 }
 
-func (fj *failedJobs) add(job *Job) {
+// Add records the job as failed for reason, with its exit code, Reason and stderr log
+func (fj *failedJobs) Add(job *Job, reason string) {
+	fj.mutex.Lock()
+	defer fj.mutex.Unlock()
+	fj.failures = append(fj.failures, jobFailure{job, reason, job.Reason, job.ExitCode, job.StderrLog})
+}
+
+// List returns the failures recorded so far, in the order they were added
+func (fj *failedJobs) List() []jobFailure {
 	fj.mutex.Lock()
-	fj.jobs = append(fj.jobs, job)
-	fj.mutex.Unlock()
+	defer fj.mutex.Unlock()
+	return append([]jobFailure{}, fj.failures...)
+}
+
+func (j *Job) recordEvent(eventType string) {
+	e := Event{JobID: j.ID, Attempt: j.Attempts, Type: eventType, RunID: j.workflow.runID, Labels: j.labels()}
+	switch eventType {
+	case EventStarted:
+		e.StdoutLog, e.StderrLog = j.StdoutLog, j.StderrLog
+	case EventFinished:
+		e.JobHash = j.configHash()
+	}
+	err := j.workflow.eventDB.record(e)
+	if err != nil {
+		j.errorf("Failed recording event '%s' error:'%s'", eventType, err.Error())
+		return
+	}
+	j.debugf("Recorded event '%s'", eventType)
+}
+
+// labels returns the workflow's Labels overridden by the job's own
+func (j *Job) labels() map[string]string {
+	if len(j.workflow.Labels) == 0 && len(j.Labels) == 0 {
+		return nil
+	}
+	labels := map[string]string{}
+	for k, v := range j.workflow.Labels {
+		labels[k] = v
+	}
+	for k, v := range j.Labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// waitForDependencies blocks until every dependency has returned,
+// returning the first dependency that did not succeed, or fail with AllowFailure set,
+// other than those the job is only After,
+// or nil if they all did.
+// Dependencies not selected to run are not waited on
+func (j *Job) waitForDependencies() *Job {
+	var unsuccessful *Job
+	for _, d := range j.Dependencies {
+		if d.unselected {
+			continue
+		}
+		<-d.done
+		ok := d.Status == StatusSucceeded || d.Status == StatusFailedAllowed || d.conditionFalse || d.succeededRecently
+		if !ok && !j.isAfter(d) && unsuccessful == nil {
+			unsuccessful = d
+		}
+	}
+	return unsuccessful
+}
+
+// acquireSlot blocks until the workflow allows another job to execute,
+// returning a func releasing the slot, or until ctx is cancelled
+func (j *Job) acquireSlot(ctx context.Context) (func(), error) {
+	slots := j.workflow.slots
+	if slots == nil {
+		return func() {}, nil
+	}
+	j.verbosef("Job Queued: waiting for one of %d slots", j.workflow.MaxParallel)
+	return slots.acquire(ctx, j)
 }
 
-func (j *Job) runJob(wg *sync.WaitGroup) {
+// acquireLock blocks until no other job holding the job's Lock executes,
+// returning a func releasing the lock, or until ctx is cancelled
+func (j *Job) acquireLock(ctx context.Context) (func(), error) {
+	if j.Lock == "" {
+		return func() {}, nil
+	}
+	j.verbosef("Job Queued: waiting for lock '%s'", j.Lock)
+	return j.workflow.locks[j.Lock].acquire(ctx, j)
+}
+
+func (j *Job) runJob(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
+	defer close(j.done)
+	defer j.capture()
+	defer j.cleanTmp()
+	defer j.workflow.metrics.jobFinished(j)
+	defer func() { j.workflow.states.update(j, j.Status) }()
+	defer func() {
+		if j.Status == StatusFailed {
+			j.workflow.stopScheduling()
+			j.notifyFailed()
+		}
+	}()
+	defer j.runJobCompleteHook()
+
+	if j.succeededPreviously {
+		j.verbosef("Job Not Rerun: succeeded in a previous run")
+		j.Status = StatusSucceeded
+		return
+	}
+	if len(j.Dependencies) > 0 {
+		j.verbosef("Job Waiting: for %d dependencies", len(j.Dependencies))
+	}
+	unsuccessful := j.waitForDependencies()
+	if ctx.Err() != nil {
+		j.skipUnstarted(ctx)
+		return
+	}
+	if unsuccessful != nil {
+		j.infof("Job Skipped: dependency job_id:%d %s", unsuccessful.ID, unsuccessful.Status)
+		j.Status = StatusSkipped
+		j.Reason = fmt.Sprintf("dependency job_id:%d %s", unsuccessful.ID, unsuccessful.Status)
+		j.recordEvent(EventSkipped)
+		j.workflow.failedJobs.Add(j, FailureSkippedDependency)
+		return
+	}
+	if j.workflow.schedulingStopped() {
+		j.skipStopped()
+		return
+	}
+	err := j.resolveOutputs()
+	if err != nil {
+		j.errorf("Job Failed: %v", err)
+		j.Status = StatusFailed
+		j.Reason = err.Error()
+		j.workflow.failedJobs.Add(j, FailureError)
+		return
+	}
+	ok, err := j.evalWhen()
+	if err != nil {
+		j.errorf("Job Failed: %v", err)
+		j.Status = StatusFailed
+		j.Reason = err.Error()
+		j.workflow.failedJobs.Add(j, FailureError)
+		return
+	}
+	if !ok {
+		j.infof("Job Skipped: condition false: %s", j.When)
+		j.Status = StatusSkipped
+		j.Reason = "condition false: " + j.When
+		j.conditionFalse = true
+		j.recordEvent(EventSkipped)
+		return
+	}
+	if !j.succeededAt.IsZero() {
+		ago := time.Since(j.succeededAt).Round(time.Second)
+		j.infof("Job Skipped: succeeded %v ago, within %v", ago, j.SucceededWithin.Duration)
+		j.Status = StatusSkipped
+		j.Reason = fmt.Sprintf("succeeded %v ago", ago)
+		j.succeededRecently = true
+		j.recordEvent(EventSkipped)
+		return
+	}
 	if j.checkOutputs() {
+		j.verbosef("Job Up To Date: outputs are newer than its inputs")
+		j.Status = StatusSucceeded
+		return
+	}
+	cacheKey, restored := j.restoreCache()
+	if restored {
+		j.Status = StatusSucceeded
+		return
+	}
+
+	unlock, err := j.acquireLock(j.workflow.scheduling)
+	if err != nil {
+		j.skipUnstarted(ctx)
+		return
+	}
+	defer unlock()
+	release, err := j.acquireSlot(j.workflow.scheduling)
+	if err != nil {
+		j.skipUnstarted(ctx)
+		return
+	}
+	defer release()
+	if j.workflow.schedulingStopped() {
+		j.skipStopped()
 		return
 	}
 
 	outLog, errLog, err := j.openLogs()
 	if err != nil {
-		log.Fatal(err)
+		j.errorf("Job Failed: could not open logs: %v", err)
+		j.Status = StatusFailed
+		j.Reason = "could not open logs: " + err.Error()
+		j.workflow.failedJobs.Add(j, FailureError)
+		return
 	}
 
 	defer outLog.Close()
 	defer errLog.Close()
+	defer j.runOnExit(outLog, errLog)
 
-	depWg := &sync.WaitGroup{}
-	cmd := exec.Command(j.pathToExec("exe"))
+	err = j.createDirectories()
+	if err != nil {
+		j.errorf("Job Failed: %v", err)
+		j.Status = StatusFailed
+		j.Reason = err.Error()
+		j.workflow.failedJobs.Add(j, FailureError)
+		return
+	}
 
-	cmd.Stdout = outLog
-	cmd.Stderr = errLog
-	cmd.Dir = j.workflow.WorkflowDir
+	for {
+		j.Attempts++
+		err = j.runAttempt(ctx, outLog, errLog)
+		if err == nil && j.restartsOnSuccess() {
+			delay := j.retryDelay(j.Attempts)
+			j.infof("Job Restarting: attempt %d succeeded, restarting in %v", j.Attempts, delay)
+			select {
+			case <-j.workflow.after(delay):
+				continue
+			case <-ctx.Done():
+				err = errJobInterrupted
+			}
+		}
+		if err == nil {
+			j.infof("Job Succeeded")
+			j.Status = StatusSucceeded
+			j.storeCache(cacheKey)
+			return
+		}
+		if j.Attempts > j.retries() || err == errJobInterrupted {
+			break
+		}
+		if !j.retryable() {
+			j.infof("Job Not Retried: exit code %d is not in retry_on_exit_codes", j.ExitCode)
+			break
+		}
+		delay := j.retryDelay(j.Attempts)
+		j.errorf("Job attempt %d failed, retrying in %v: %v", j.Attempts, delay, err)
+		select {
+		case <-j.workflow.after(delay):
+		case <-ctx.Done():
+			err = errJobInterrupted
+		}
+		if err == errJobInterrupted {
+			break
+		}
+	}
 
-	err = cmd.Run()
+	if err == errJobInterrupted && cancelledFast(ctx) {
+		j.errorf("Job Cancelled: another job failed")
+		j.Status = StatusCancelled
+		j.Reason = "cancelled: another job failed"
+		return
+	}
+	if err == errJobInterrupted {
+		j.errorf("Job Interrupted")
+		j.Status = StatusInterrupted
+		if ctx.Err() == context.DeadlineExceeded {
+			j.Reason = "workflow timeout"
+		}
+		return
+	}
+	reason := FailureNonzeroExit
+	j.Reason = err.Error()
 	switch {
-	case err == nil:
-		log.Println("Job Succeeded: job_id:", j.ID)
+	case err == errJobTimeout:
+		j.errorf("Job Failed: timeout: %v", err)
+		reason = FailureTimeout
+		j.Reason = "timeout"
+	case err == errJobStalled:
+		j.errorf("Job Failed: no output for %v (stalled)", j.Heartbeat.Duration)
+		reason = FailureStalled
+	case isOutputError(err):
+		j.errorf("Job Failed: %v", err)
+		reason = FailureMissingOutput
+	case isResourceLimitError(err):
+		j.errorf("Job Failed: %v", err)
+		reason = FailureResourceLimit
+	case isImageError(err), isSSHError(err):
+		j.errorf("Job Failed: %v", err)
+		reason = FailureError
+	case exitSignal(err) != "":
+		j.Reason = "killed by signal " + exitSignal(err)
+		j.errorf("Job Failed: %s", j.Reason)
+		reason = FailureSignal
 	case j.checkOutputs() == false:
-		log.Println("Job Failed: outputs do not exist: job_id:", j.ID, err)
-		j.workflow.failedJobs.add(j)
+		j.errorf("Job Failed: outputs do not exist: %v", err)
 	default:
-		log.Println("Job Failed: job_id:", j.ID, err)
-		j.workflow.failedJobs.add(j)
+		j.errorf("Job Failed: %v", err)
+	}
+	j.Status = StatusFailed
+	if j.retries() > 0 && j.Attempts > j.retries() {
+		j.errorf("Job retries exhausted after %d attempts", j.Attempts)
+		j.recordEvent(EventRetriesExhausted)
 	}
+	if j.AllowFailure {
+		j.infof("Job Failure Allowed: %s", reason)
+		j.Status = StatusFailedAllowed
+		return
+	}
+	j.workflow.failedJobs.Add(j, reason)
+}
 
-	for _, d := range j.Dependencies {
-		d.initJob()
-		depWg.Add(1)
-		go d.runJob(wg)
+// skipStopped skips a job that had not started when another job failed
+func (j *Job) skipStopped() {
+	j.infof("Job Skipped: another job failed")
+	j.Status = StatusSkipped
+	j.Reason = "another job failed"
+	j.recordEvent(EventSkipped)
+}
+
+// skipUnstarted skips a job that had not started when the workflow stopped starting jobs,
+// because another job failed or the workflow was interrupted or ran past its Timeout
+func (j *Job) skipUnstarted(ctx context.Context) {
+	if ctx.Err() == nil || cancelledFast(ctx) {
+		j.skipStopped()
+		return
+	}
+	j.Reason = "workflow interrupted"
+	if ctx.Err() == context.DeadlineExceeded {
+		j.Reason = "workflow timeout"
+	}
+	j.infof("Job Skipped: %s", j.Reason)
+	j.Status = StatusSkipped
+	j.recordEvent(EventSkipped)
+}
+
+// runOnExit runs the job's OnExit command with bash in the job's work dir, appending
+// its output to the job's logs. GFLOW_EXIT_CODE and GFLOW_JOB_STATUS give the outcome of the job.
+// A failing hook is logged, it does not change the job's status
+func (j *Job) runOnExit(outLog, errLog io.Writer) {
+	if j.OnExit == "" {
+		return
+	}
+	cmd := exec.Command("/bin/bash", "-c", j.OnExit)
+	cmd.Dir = j.workDir()
+	cmd.Env = append(j.environ(), "GFLOW_EXIT_CODE="+strconv.Itoa(j.ExitCode), "GFLOW_JOB_STATUS="+j.Status)
+	cmd.Stdout, cmd.Stderr = outLog, errLog
+	err := cmd.Run()
+	if err != nil {
+		j.errorf("Job on_exit hook failed: %v", err)
+	}
+}
+
+var (
+	errJobTimeout     = errors.New("job timed out")
+	errJobInterrupted = errors.New("job interrupted")
+)
+
+// exitCode returns the exit code of a command that returned err,
+// -1 if it did not exit normally
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+func isOutputError(err error) bool {
+	_, ok := err.(*outputError)
+	return ok
+}
+
+// outputError is returned when a job exits zero without producing its declared outputs or artifacts
+type outputError struct {
+	error
+}
+
+// executor returns the Executor for the job, docker if it has an Image and ssh if it has a Host
+func (j *Job) executor() Executor {
+	if j.Image != "" {
+		return DockerExecutor{}
+	}
+	if j.Host != "" {
+		return SSHExecutor{}
+	}
+	return j.workflow.Executor
+}
+
+// runAttempt executes the job's command once with the job's executor in an empty tmp dir,
+// recording the attempt in the event DB.
+// When ctx is cancelled the command is terminated and errJobInterrupted returned
+func (j *Job) runAttempt(ctx context.Context, outLog, errLog *os.File) error {
+	err := j.resetTmp()
+	if err != nil {
+		return fmt.Errorf("could not empty tmp dir: %v", err)
+	}
+	attemptCtx := ctx
+	if j.Timeout.Duration > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, j.Timeout.Duration)
+		defer cancel()
+	}
+	if j.Attempts > 1 {
+		marker := fmt.Sprintf("GFLOW: attempt %d\n", j.Attempts)
+		outLog.WriteString(marker)
+		errLog.WriteString(marker)
+	}
+	stdout, stderr, flush := j.streamOutputs(outLog, errLog)
+	defer flush()
+	tail := &tailBuffer{limit: stderrTailSize}
+	if j.Resources != nil && j.Resources.MemoryMB > 0 {
+		stderr = io.MultiWriter(stderr, tail)
+	}
+	if j.Heartbeat.Duration > 0 {
+		var cancel context.CancelCauseFunc
+		attemptCtx, cancel = context.WithCancelCause(attemptCtx)
+		defer cancel(nil)
+		h := newHeartbeat()
+		stdout, stderr = io.MultiWriter(stdout, h), io.MultiWriter(stderr, h)
+		go watchHeartbeat(attemptCtx, cancel, h, j.Heartbeat.Duration)
+	}
+
+	j.infof("Job Started: attempt %d", j.Attempts)
+	j.recordEvent(EventStarted)
+	startedAt := time.Now()
+	if j.StartedAt == nil {
+		j.StartedAt = &startedAt
+	}
+	j.workflow.states.update(j, StatusRunning)
+	j.workflow.metrics.jobStarted()
+	code, err := j.executor().Run(attemptCtx, j, stdout, stderr)
+	j.workflow.metrics.jobStopped()
+	finishedAt := time.Now()
+	j.FinishedAt = &finishedAt
+	j.Duration = Duration{finishedAt.Sub(*j.StartedAt)}
+	j.ExitCode = code
+	if err == nil {
+		missing, err := j.missingOutput()
+		if err == nil && missing != "" {
+			err = errors.New(missing)
+		}
+		if err == nil {
+			err = j.collectArtifacts()
+		}
+		if err != nil {
+			j.recordEvent(EventFailed)
+			return &outputError{err}
+		}
+		j.recordEvent(EventFinished)
+		return nil
+	}
+	switch {
+	case cancelledFast(ctx):
+		j.recordEvent(EventCancelled)
+		return errJobInterrupted
+	case ctx.Err() != nil:
+		j.recordEvent(EventInterrupted)
+		return errJobInterrupted
+	case context.Cause(attemptCtx) == errJobStalled:
+		j.recordEvent(EventFailed)
+		return errJobStalled
+	case attemptCtx.Err() == context.DeadlineExceeded:
+		j.recordEvent(EventFailed)
+		return errJobTimeout
 	}
-	depWg.Wait()
+	j.recordEvent(EventFailed)
+	return j.checkResourceLimits(err, string(tail.buf))
 }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Warnings returns what strict validation reports about a valid workflow without it being an error:
+// jobs no job depends on when they are not selected by Only or OnlyTags, so would never run,
+// and the disconnected subgraphs of jobs that neither depend on nor are depended on by each other
+func (w *Workflow) Warnings() ([]string, error) {
+	sorted, err := w.sortJobs()
+	if err != nil {
+		return nil, err
+	}
+	warnings := []string{}
+	if w.Only != "" || len(w.OnlyTags) > 0 {
+		selected := sorted
+		if w.Only != "" {
+			selected, err = onlyJobs(selected, w.Only)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(w.OnlyTags) > 0 {
+			selected, err = w.taggedJobs(selected)
+			if err != nil {
+				return nil, err
+			}
+		}
+		warnings = append(warnings, unusedJobs(sorted, selected)...)
+	}
+	if components := subgraphs(sorted); len(components) > 1 {
+		labels := []string{}
+		for _, c := range components {
+			names := []string{}
+			for _, j := range c {
+				names = append(names, j.label())
+			}
+			labels = append(labels, "{"+strings.Join(names, ", ")+"}")
+		}
+		warnings = append(warnings, fmt.Sprintf("workflow has %d disconnected subgraphs: %s",
+			len(components), strings.Join(labels, " ")))
+	}
+	return warnings, nil
+}
+
+// unusedJobs warns of each of the sorted jobs that no job depends on and is not selected
+func unusedJobs(sorted, selected []*Job) []string {
+	dependedOn := map[*Job]bool{}
+	for _, j := range sorted {
+		for _, d := range j.Dependencies {
+			dependedOn[d] = true
+		}
+	}
+	in := map[*Job]bool{}
+	for _, j := range selected {
+		in[j] = true
+	}
+	warnings := []string{}
+	for _, j := range sorted {
+		if !dependedOn[j] && !in[j] {
+			warnings = append(warnings, fmt.Sprintf("job %s: no job depends on it and it is not selected by only or tags", j.label()))
+		}
+	}
+	return warnings
+}
+
+// subgraphs groups the sorted jobs into the sets connected by dependencies in either direction,
+// each in order and ordered by their first job
+func subgraphs(sorted []*Job) [][]*Job {
+	parent := map[*Job]*Job{}
+	var find func(j *Job) *Job
+	find = func(j *Job) *Job {
+		if parent[j] == j {
+			return j
+		}
+		parent[j] = find(parent[j])
+		return parent[j]
+	}
+	for _, j := range sorted {
+		parent[j] = j
+	}
+	for _, j := range sorted {
+		for _, d := range j.Dependencies {
+			parent[find(d)] = find(j)
+		}
+	}
+	index := map[*Job]int{}
+	components := [][]*Job{}
+	for _, j := range sorted {
+		root := find(j)
+		i, ok := index[root]
+		if !ok {
+			i = len(components)
+			index[root] = i
+			components = append(components, nil)
+		}
+		components[i] = append(components[i], j)
+	}
+	return components
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWarnings(t *testing.T) {
+	defer cleanTestData(t)
+	testCases := []struct {
+		name string
+		only string
+		want []string
+	}{
+		{"Connected", "", []string{}},
+		{"Orphaned", "", []string{"workflow has 2 disconnected subgraphs: {build, test, deploy} {orphan}"}},
+		{"Unused", "deploy", []string{
+			"job orphan: no job depends on it and it is not selected by only or tags",
+			"job lint: no job depends on it and it is not selected by only or tags",
+			"workflow has 2 disconnected subgraphs: {build, test, deploy, lint} {orphan}",
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wf := testWorkflow(t, "Warnings"+tc.name)
+			build := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+			build.Name = "build"
+			test := newJob(wf, []string{}, []*Job{build}, []string{}, false, "true")
+			test.Name = "test"
+			deploy := newJob(wf, []string{}, []*Job{test}, []string{}, false, "true")
+			deploy.Name = "deploy"
+			wf.AddJob(deploy)
+			if tc.name != "Connected" {
+				orphan := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+				orphan.Name = "orphan"
+				wf.AddJob(orphan)
+			}
+			if tc.name == "Unused" {
+				lint := newJob(wf, []string{}, []*Job{build}, []string{}, false, "true")
+				lint.Name = "lint"
+				wf.AddJob(lint)
+			}
+			wf.Only = tc.only
+			got, err := wf.Warnings()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected warnings %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log formats selectable for the workflow logger
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Log levels
+const (
+	levelDebug   = "debug"
+	levelVerbose = "verbose"
+	levelInfo    = "info"
+	levelError   = "error"
+)
+
+// Verbosity levels of the workflow logger, each logging the messages of the levels before it.
+// Errors are always logged, info messages such as jobs starting and finishing from VerbosityNormal,
+// scheduling decisions from VerbosityVerbose and event DB writes from VerbosityDebug
+const (
+	VerbosityQuiet = iota
+	VerbosityNormal
+	VerbosityVerbose
+	VerbosityDebug
+)
+
+// levelVerbosity is the verbosity from which messages of each level are logged
+var levelVerbosity = map[string]int{
+	levelError:   VerbosityQuiet,
+	levelInfo:    VerbosityNormal,
+	levelVerbose: VerbosityVerbose,
+	levelDebug:   VerbosityDebug,
+}
+
+// countFlag is a boolean command line flag counting how many times it is given
+type countFlag int
+
+func (c *countFlag) String() string {
+	return strconv.Itoa(int(*c))
+}
+
+func (c *countFlag) Set(s string) error {
+	set, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	if set {
+		*c++
+	}
+	return nil
+}
+
+func (c *countFlag) IsBoolFlag() bool {
+	return true
+}
+
+// verbosity returns the logger verbosity given how many times -v was set and -quiet
+func verbosity(verbose int, quiet bool) int {
+	switch {
+	case quiet:
+		return VerbosityQuiet
+	case VerbosityNormal+verbose > VerbosityDebug:
+		return VerbosityDebug
+	}
+	return VerbosityNormal + verbose
+}
+
+// The logger type writes the messages of a workflow and its jobs,
+// either as text lines like the standard logger or as one json object per line
+// Secrets are replaced by *** in every message. With color set, text status messages are
+// colored, which is the default when out is a terminal and NO_COLOR is not set
+// Messages are logged up to the logger's verbosity, VerbosityNormal by default.
+// With quiet set only errors are logged. With clear set, text messages first clear the
+// current line of the terminal so they replace a progress line being redrawn on it.
+// With combined set, messages are also sent to the combined log, at least up to VerbosityNormal
+// whatever the verbosity, so it records the jobs starting and finishing even with quiet set
+type logger struct {
+	out       io.Writer
+	format    string
+	text      *log.Logger
+	mutex     *sync.Mutex
+	secrets   []string
+	color     bool
+	verbosity int
+	quiet     bool
+	clear     bool
+	combined  *combinedLog
+	held      *holdingWriter
+}
+
+type logLine struct {
+	Time  time.Time `json:"ts"`
+	Level string    `json:"level"`
+	JobID int       `json:"job_id,omitempty"`
+	Msg   string    `json:"msg"`
+}
+
+func newLogger(out io.Writer, format string) *logger {
+	return &logger{out, format, log.New(out, "", log.LstdFlags), &sync.Mutex{}, nil, useColor(out), VerbosityNormal, false, false, nil, nil}
+}
+
+// holdingWriter buffers what is written to it until it is released, then writes to out directly
+type holdingWriter struct {
+	out      io.Writer
+	mutex    *sync.Mutex
+	buf      bytes.Buffer
+	released bool
+}
+
+func (h *holdingWriter) Write(b []byte) (int, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.released {
+		return h.out.Write(b)
+	}
+	return h.buf.Write(b)
+}
+
+// release writes the buffered output to out when flush is set, otherwise discards it
+func (h *holdingWriter) release(flush bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if flush {
+		h.out.Write(h.buf.Bytes())
+	}
+	h.buf.Reset()
+	h.released = true
+}
+
+// hold buffers the messages logged from now on instead of writing them, until release.
+// It must not be called while logging concurrently
+func (l *logger) hold() {
+	l.held = &holdingWriter{out: l.out, mutex: &sync.Mutex{}}
+	l.out = l.held
+	l.text.SetOutput(l.held)
+}
+
+// release writes the messages held since hold when flush is set, otherwise discards them,
+// and logs directly again. It must not be called while logging concurrently
+func (l *logger) release(flush bool) {
+	if l.held == nil {
+		return
+	}
+	l.held.release(flush)
+	l.out = l.held.out
+	l.text.SetOutput(l.out)
+	l.held = nil
+}
+
+// redact sets the secret values replaced in messages, it must be called before logging concurrently
+func (l *logger) redact(secrets []string) {
+	l.secrets = secrets
+}
+
+// validLogFormat reports whether format is a supported log format
+func validLogFormat(format string) bool {
+	return format == LogFormatText || format == LogFormatJSON
+}
+
+// Infof logs an informational message, jobID is 0 for workflow messages
+func (l *logger) Infof(jobID int, format string, v ...interface{}) {
+	l.write(levelInfo, jobID, fmt.Sprintf(format, v...))
+}
+
+// Verbosef logs a message of the workflow's scheduling decisions, jobID is 0 for workflow messages
+func (l *logger) Verbosef(jobID int, format string, v ...interface{}) {
+	l.write(levelVerbose, jobID, fmt.Sprintf(format, v...))
+}
+
+// Debugf logs a debugging message, jobID is 0 for workflow messages
+func (l *logger) Debugf(jobID int, format string, v ...interface{}) {
+	l.write(levelDebug, jobID, fmt.Sprintf(format, v...))
+}
+
+// Errorf logs an error message, jobID is 0 for workflow messages
+func (l *logger) Errorf(jobID int, format string, v ...interface{}) {
+	l.write(levelError, jobID, fmt.Sprintf(format, v...))
+}
+
+func (l *logger) write(level string, jobID int, msg string) {
+	for _, secret := range l.secrets {
+		msg = strings.Replace(msg, secret, redacted, -1)
+	}
+	if levelVerbosity[level] <= l.verbosity || levelVerbosity[level] <= VerbosityNormal {
+		l.combined.send(jobID, msg)
+	}
+	if level != levelError && (l.quiet || levelVerbosity[level] > l.verbosity) {
+		return
+	}
+	if l.format != LogFormatJSON {
+		if jobID != 0 {
+			msg = fmt.Sprintf("%s: job_id: %d", msg, jobID)
+		}
+		if l.color {
+			msg = colorize(msg)
+		}
+		if l.clear {
+			l.mutex.Lock()
+			defer l.mutex.Unlock()
+			io.WriteString(l.out, clearLine)
+		}
+		l.text.Println(msg)
+		return
+	}
+	line, err := json.Marshal(logLine{time.Now(), level, jobID, msg})
+	if err != nil {
+		l.text.Println(msg)
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.out.Write(append(line, '\n'))
+}
+
+func (j *Job) infof(format string, v ...interface{}) {
+	j.workflow.logger.Infof(j.ID, format, v...)
+}
+
+func (j *Job) verbosef(format string, v ...interface{}) {
+	j.workflow.logger.Verbosef(j.ID, format, v...)
+}
+
+func (j *Job) debugf(format string, v ...interface{}) {
+	j.workflow.logger.Debugf(j.ID, format, v...)
+}
+
+func (j *Job) errorf(format string, v ...interface{}) {
+	j.workflow.logger.Errorf(j.ID, format, v...)
+}
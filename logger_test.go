@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestJSONLogs(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "JSONLogs")
+	wf.KeepGoing = true
+	out := &bytes.Buffer{}
+	wf.logger = newLogger(out, LogFormatJSON)
+	ok := newJob(wf, []string{}, []*Job{}, []string{}, false, "echo ok")
+	failed := newJob(wf, []string{}, []*Job{}, []string{}, false, "false")
+	wf.AddJob(ok, failed)
+	expectNonZero(t, wf.Run())
+
+	found := map[string]map[string]interface{}{}
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("expected a json log line, got %q: %v", scanner.Text(), err)
+		}
+		for _, field := range []string{"ts", "level", "msg"} {
+			if _, ok := line[field]; !ok {
+				t.Errorf("expected log line %q to have field '%s'", scanner.Text(), field)
+			}
+		}
+		msg, _ := line["msg"].(string)
+		for _, prefix := range []string{"Job Started", "Job Succeeded", "Job Failed"} {
+			if strings.HasPrefix(msg, prefix) {
+				found[prefix] = line
+			}
+		}
+	}
+
+	testCases := []struct {
+		msg   string
+		level string
+		job   *Job
+	}{
+		{"Job Started", levelInfo, nil},
+		{"Job Succeeded", levelInfo, ok},
+		{"Job Failed", levelError, failed},
+	}
+	for _, tc := range testCases {
+		line, ok := found[tc.msg]
+		if !ok {
+			t.Errorf("expected a '%s' log line", tc.msg)
+			continue
+		}
+		if line["level"] != tc.level {
+			t.Errorf("expected '%s' at level %s, got %v", tc.msg, tc.level, line["level"])
+		}
+		jobID, hasJobID := line["job_id"].(float64)
+		if !hasJobID || (tc.job != nil && int(jobID) != tc.job.ID) {
+			t.Errorf("expected '%s' to have the job_id of its job, got %v", tc.msg, line["job_id"])
+		}
+	}
+}
+
+func TestTextLogs(t *testing.T) {
+	out := &bytes.Buffer{}
+	l := newLogger(out, LogFormatText)
+	l.Infof(3, "Job Succeeded")
+	l.Errorf(0, "Workflow failed: exit status: %d", 1)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], " Job Succeeded: job_id: 3") ||
+		!strings.HasSuffix(lines[1], " Workflow failed: exit status: 1") {
+		t.Errorf("unexpected text logs %q", out.String())
+	}
+}
+
+func TestColorLogs(t *testing.T) {
+	for _, color := range []bool{true, false} {
+		out := &bytes.Buffer{}
+		l := newLogger(out, LogFormatText)
+		l.color = color
+		l.Infof(1, "Job Succeeded")
+		l.Errorf(2, "Job Failed: exit status 1")
+		l.Infof(3, "Job Skipped: condition false: env:CI")
+		l.Infof(4, "Job Started: attempt 1")
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != 4 {
+			t.Fatalf("expected 4 log lines, got %q", out.String())
+		}
+		for i, want := range []string{colorGreen, colorRed, colorYellow, ""} {
+			colored := want != "" && strings.Contains(lines[i], want) && strings.HasSuffix(lines[i], colorReset)
+			switch {
+			case color && want != "" && !colored:
+				t.Errorf("expected line %q to be colored", lines[i])
+			case (!color || want == "") && strings.Contains(lines[i], "\x1b["):
+				t.Errorf("expected line %q to have no escape codes with color %v", lines[i], color)
+			}
+		}
+	}
+
+	if useColor(&bytes.Buffer{}) {
+		t.Error("expected no color when not writing to a terminal")
+	}
+	os.Setenv("NO_COLOR", "1")
+	defer os.Unsetenv("NO_COLOR")
+	if useColor(os.Stderr) {
+		t.Error("expected no color with NO_COLOR set")
+	}
+}
+
+func TestVerbosity(t *testing.T) {
+	defer cleanTestData(t)
+	testCases := []struct {
+		name      string
+		verbosity int
+		want      []string
+		notWant   []string
+	}{
+		{"Quiet", VerbosityQuiet, []string{"Job Failed"}, []string{"Job Started", "Job Waiting", "Recorded event"}},
+		{"Normal", VerbosityNormal, []string{"Job Started", "Job Failed"}, []string{"Job Waiting", "Recorded event"}},
+		{"Verbose", VerbosityVerbose, []string{"Job Started", "Job Waiting"}, []string{"Recorded event"}},
+		{"Debug", VerbosityDebug, []string{"Job Started", "Job Waiting", "Recorded event", "Wrote script"}, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wf := testWorkflow(t, "Verbosity"+tc.name)
+			out := &bytes.Buffer{}
+			wf.logger = newLogger(out, LogFormatText)
+			wf.logger.verbosity = tc.verbosity
+			a := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+			b := newJob(wf, []string{}, []*Job{a}, []string{}, false, "false")
+			wf.AddJob(b)
+			expectNonZero(t, wf.Run())
+			for _, msg := range tc.want {
+				if !strings.Contains(out.String(), msg) {
+					t.Errorf("expected '%s' to be logged at verbosity %d, logs: %q", msg, tc.verbosity, out.String())
+				}
+			}
+			for _, msg := range tc.notWant {
+				if strings.Contains(out.String(), msg) {
+					t.Errorf("expected '%s' not to be logged at verbosity %d, logs: %q", msg, tc.verbosity, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestVerbosityFlags(t *testing.T) {
+	testCases := []struct {
+		verbose int
+		quiet   bool
+		want    int
+	}{
+		{0, false, VerbosityNormal},
+		{1, false, VerbosityVerbose},
+		{2, false, VerbosityDebug},
+		{5, false, VerbosityDebug},
+		{2, true, VerbosityQuiet},
+	}
+	for _, tc := range testCases {
+		if got := verbosity(tc.verbose, tc.quiet); got != tc.want {
+			t.Errorf("expected -v %d times with quiet %v to give verbosity %d, got %d", tc.verbose, tc.quiet, tc.want, got)
+		}
+	}
+}
+
+func TestQuietOnSuccess(t *testing.T) {
+	defer cleanTestData(t)
+	for _, tc := range []struct {
+		name   string
+		cmd    string
+		status int
+	}{
+		{"Succeeded", "true", ExitSuccess},
+		{"Failed", "false", ExitJobsFailed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			wf := testWorkflow(t, "QuietOnSuccess"+tc.name)
+			out := &bytes.Buffer{}
+			wf.logger = newLogger(out, LogFormatText)
+			wf.QuietSuccess = true
+			ok := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+			j := newJob(wf, []string{}, []*Job{ok}, []string{}, false, tc.cmd)
+			wf.AddJob(j)
+			if status := wf.Run(); status != tc.status {
+				t.Fatalf("expected exit %d, wf exited %d", tc.status, status)
+			}
+			if tc.status == ExitSuccess {
+				if out.Len() != 0 {
+					t.Errorf("expected no output from a successful run, got:\n%s", out.String())
+				}
+				return
+			}
+			for _, want := range []string{"Job Started: attempt 1: job_id: 1", "Job Succeeded: job_id: 1",
+				"Failure: nonzero exit: exit status 1", "Workflow failed"} {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("expected the failed run to log '%s', got:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
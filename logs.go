@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// followInterval is how often followed logs are checked for new output
+const followInterval = 200 * time.Millisecond
+
+// jobLogs is an open log of a job copied to out as it is written
+type jobLogs struct {
+	path string
+	out  io.Writer
+	file *os.File
+}
+
+// copy writes what was added to the log since the last copy, it opens the log once it exists
+func (l *jobLogs) copy() error {
+	if l.file == nil {
+		file, err := os.Open(l.path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		l.file = file
+	}
+	_, err := io.Copy(l.out, l.file)
+	return err
+}
+
+func (l *jobLogs) close() {
+	if l.file != nil {
+		l.file.Close()
+	}
+}
+
+// statusJob returns the job of a loaded workflow by its Name or ID, with its status
+func (w *Workflow) statusJob(name string) (*Job, error) {
+	jobs, err := w.statusJobs()
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range jobs {
+		if j.Name == name || strconv.Itoa(j.ID) == name {
+			return j, nil
+		}
+	}
+	return nil, fmt.Errorf("no job named '%s'", name)
+}
+
+// printLogs writes the stdout log of the job of a loaded workflow named name to stdout and its stderr log
+// to stderr. With follow set, the logs keep being written as they grow until the job is no longer
+// pending or running in a run in progress. With since set, the job must have events recorded at or after it
+func (w *Workflow) printLogs(name string, stdout, stderr io.Writer, follow bool, since time.Time) error {
+	j, err := w.statusJob(name)
+	if err != nil {
+		return err
+	}
+	if !since.IsZero() {
+		recent, err := w.jobsWithEventsSince(since)
+		if err != nil {
+			return err
+		}
+		if !recent[j.ID] {
+			return fmt.Errorf("job %s has no events since %s", j.label(), since.Format(time.RFC3339))
+		}
+	}
+	logs := []*jobLogs{{path: j.StdoutLog, out: stdout}, {path: j.StderrLog, out: stderr}}
+	defer func() {
+		for _, l := range logs {
+			l.close()
+		}
+	}()
+	for {
+		running := follow && (j.Status == StatusPending || j.Status == StatusRunning)
+		for _, l := range logs {
+			if err := l.copy(); err != nil {
+				return err
+			}
+			if l.file == nil && !running {
+				return fmt.Errorf("job %s has no log %s", j.label(), l.path)
+			}
+		}
+		if !running {
+			return nil
+		}
+		time.Sleep(followInterval)
+		// the run in progress rewrites the workflow json once it finishes
+		if latest, err := readWorkflowJSON(w.WFJsonPath); err == nil {
+			w = latest
+		}
+		j, err = w.statusJob(name)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestPrintLogs(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "PrintLogs")
+	build := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	build.Name = "build"
+	wf.AddJob(build)
+	expectZero(t, wf.Run())
+	for logPath, content := range map[string]string{build.StdoutLog: "built\n", build.StderrLog: "warning\n"} {
+		if err := ioutil.WriteFile(logPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	loaded, err := loadWorkflowJSON(wf.WorkflowDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"build", "1"} {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		if err := loaded.printLogs(name, stdout, stderr, false, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		if stdout.String() != "built\n" || stderr.String() != "warning\n" {
+			t.Errorf("expected the logs of job %s, got stdout %q and stderr %q", name, stdout.String(), stderr.String())
+		}
+	}
+	if err := loaded.printLogs("missing", &bytes.Buffer{}, &bytes.Buffer{}, false, time.Time{}); err == nil {
+		t.Error("expected an error for an unknown job")
+	}
+
+	// following a job running in a new run prints its logs until it finishes
+	err = loaded.setupEventDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.eventDB.record(Event{Type: EventWorkflowStarted})
+	loaded.eventDB.record(Event{JobID: build.ID, Type: EventStarted})
+	loaded.eventDB.Close()
+	go func() {
+		time.Sleep(2 * followInterval)
+		f, err := os.OpenFile(build.StdoutLog, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		f.WriteString("deployed\n")
+		f.Close()
+		if err := loaded.setupEventDB(); err != nil {
+			t.Error(err)
+			return
+		}
+		loaded.eventDB.record(Event{JobID: build.ID, Type: EventFinished})
+		loaded.eventDB.Close()
+	}()
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	if err := loaded.printLogs("build", stdout, stderr, true, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "built\ndeployed\n" || stderr.String() != "warning\n" {
+		t.Errorf("expected the followed logs to include what was written while running, got stdout %q and stderr %q",
+			stdout.String(), stderr.String())
+	}
+}
+
+func TestFollowLogsFirstRun(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "FollowLogsFirstRun")
+	build := newJob(wf, []string{}, []*Job{}, []string{}, false,
+		"echo started; while [ ! -e finish ]; do sleep 0.01; done; echo done")
+	build.Name = "build"
+	wf.AddJob(build)
+	status := make(chan int)
+	go func() { status <- wf.Run() }()
+
+	var loaded *Workflow
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		w, err := loadWorkflowJSON(wf.WorkflowDir)
+		if err != nil {
+			continue
+		}
+		jobs, err := w.statusJobs()
+		if err == nil && len(jobs) == 1 && jobs[0].Status == StatusRunning {
+			loaded = w
+			break
+		}
+	}
+	if loaded == nil {
+		t.Fatal("expected status to show the job running during the first run")
+	}
+	followed := make(chan error)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	go func() { followed <- loaded.printLogs("build", stdout, stderr, true, time.Time{}) }()
+	time.Sleep(2 * followInterval)
+	if err := ioutil.WriteFile(path.Join(loaded.WorkflowDir, "finish"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-followed; err != nil {
+		t.Fatal(err)
+	}
+	expectZero(t, <-status)
+	if stdout.String() != "started\ndone\n" {
+		t.Errorf("expected the followed log of the running job to include what it wrote until it finished, got %q",
+			stdout.String())
+	}
+}
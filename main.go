@@ -1,23 +1,345 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
+	"time"
 )
 
-func main() {
-	var (
-		workflowYaml string
-	)
-	flag.StringVar(&workflowYaml, "yaml", "", "path to workflow yaml file")
-	flag.Parse()
+const usage = `Usage: gflow <command> [options]
+
+Commands:
+  init      write a starter workflow.yaml to a dir, the current dir by default
+  run       run a workflow
+  validate  check a workflow is valid without running it, with -strict also warn of unused jobs
+  graph     print the workflow's dependency graph in Graphviz DOT format or as json
+  status    print the status of each job from the last run of a workflow
+  gc        remove the outputs and artifacts of jobs no longer in a workflow
+  history   print the start, exit status and duration of the last runs of a workflow
+  logs      print the stdout and stderr logs of a job, by its name or id, from the last run of a workflow
+  serve     run a workflow, serving the live state of its jobs as json at /api/jobs
+  watch     run a workflow, then rerun the jobs affected whenever their inputs change
+
+Run 'gflow <command> -h' for the options of a command.
+`
+
+// Command is a parsed gflow subcommand and its options
+type Command struct {
+	Name         string
+	YamlPath     string
+	WorkflowDir  string
+	StateDir     string
+	DryRun       bool
+	Explain      bool
+	Resume       bool
+	NoEventDB    bool
+	KeepGoing    bool
+	FailFast     bool
+	MaxFailures  int
+	Stream       bool
+	Progress     bool
+	Only         string
+	Tags         []string
+	TagsStrict   bool
+	MetricsAddr  string
+	CacheDir     string
+	Addr         string
+	WatchPaths   []string
+	Debounce     time.Duration
+	LogFormat    string
+	GraphFormat  string
+	Verbose      int
+	Quiet        bool
+	QuietSuccess bool
+	Vars         map[string]string
+	Force        bool
+	Strict       bool
+	Since        sinceFlag
+	Follow       bool
+	JobName      string
+}
+
+// InitFlags parses the gflow command line, args excludes the program name.
+// Errors are returned rather than exiting so the caller decides the exit status
+func InitFlags(args []string) (*Command, error) {
+	if len(args) == 0 {
+		return nil, errors.New("no command specified")
+	}
+	c := &Command{Name: args[0]}
+	switch c.Name {
+	case "init", "run", "validate", "graph", "gc", "status", "history", "logs", "serve", "watch":
+	case "-h", "-help", "--help", "help":
+		return nil, flag.ErrHelp
+	default:
+		return nil, fmt.Errorf("unknown command '%s'", c.Name)
+	}
+
+	fs := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	if c.Name == "init" {
+		fs.BoolVar(&c.Force, "force", false, "overwrite an existing workflow.yaml")
+		err := fs.Parse(args[1:])
+		if err != nil {
+			return nil, err
+		}
+		if fs.NArg() > 1 {
+			return nil, fmt.Errorf("unexpected arguments: %v", fs.Args()[1:])
+		}
+		c.WorkflowDir = "."
+		if fs.NArg() == 1 {
+			c.WorkflowDir = fs.Arg(0)
+		}
+		return c, nil
+	}
+	fs.StringVar(&c.YamlPath, "f", "", "path or http(s) url of the workflow yaml file, - to read it from stdin")
+	fs.StringVar(&c.WorkflowDir, "workflow-dir", "", "override the workflow_dir of the workflow yaml")
+	fs.StringVar(&c.StateDir, "state-dir", "", "keep the logs, scripts and event db of the workflow in this dir instead of its .gflow dir")
+	fs.Var((*varFlag)(&c.Vars), "var", "set a workflow var as key=value, may be repeated")
+	fs.StringVar(&c.LogFormat, "log-format", LogFormatText, "format of log messages: text or json")
+	fs.Var((*countFlag)(&c.Verbose), "v", "log scheduling decisions, repeat to also log debug messages")
+	fs.BoolVar(&c.Quiet, "quiet", false, "only log errors")
+	if c.Name == "graph" {
+		fs.StringVar(&c.GraphFormat, "format", GraphFormatDOT, "format of the graph: dot or json")
+	}
+	if c.Name == "validate" {
+		fs.BoolVar(&c.Strict, "strict", false, "also warn of jobs nothing depends on that are not selected and of disconnected subgraphs")
+		fs.StringVar(&c.Only, "only", "", "with -strict, the jobs selected to run, as for run")
+		fs.Var((*tagsFlag)(&c.Tags), "tags", "with -strict, the tags of the jobs selected to run, as for run")
+	}
+	if c.Name == "gc" {
+		fs.BoolVar(&c.DryRun, "dry-run", false, "list the orphaned outputs and artifacts without removing them")
+	}
+	if c.Name == "status" || c.Name == "history" || c.Name == "logs" {
+		fs.Var(&c.Since, "since", "only show what happened since this duration ago, such as 24h, or timestamp")
+	}
+	if c.Name == "logs" {
+		fs.BoolVar(&c.Follow, "follow", false, "keep printing the logs as they are written while the job runs")
+	}
+	if c.Name == "serve" {
+		fs.StringVar(&c.Addr, "addr", ":8080", "address to serve the job states api on")
+	}
+	if c.Name == "watch" {
+		fs.Var((*pathsFlag)(&c.WatchPaths), "path", "also rerun the workflow when this path changes, may be repeated")
+		fs.DurationVar(&c.Debounce, "debounce", defaultDebounce, "wait this long after the last change before rerunning")
+	}
+	if c.Name == "run" || c.Name == "serve" || c.Name == "watch" {
+		fs.BoolVar(&c.DryRun, "dry-run", false, "print the jobs that would run without running them")
+		fs.BoolVar(&c.Explain, "explain", false, "print whether each job would run, be skipped or wait, and why")
+		fs.BoolVar(&c.Resume, "resume", false, "do not rerun jobs that succeeded in the previous run")
+		fs.BoolVar(&c.QuietSuccess, "quiet-on-success", false, "log nothing unless the run fails, then log all of its messages")
+		fs.BoolVar(&c.NoEventDB, "no-db", false, "do not record the run's events in the event db")
+		fs.BoolVar(&c.KeepGoing, "keep-going", false, "keep running jobs that do not depend on a failed job")
+		fs.BoolVar(&c.FailFast, "fail-fast", false, "cancel the running jobs as soon as a job fails")
+		fs.IntVar(&c.MaxFailures, "max-failures", 0, "keep running jobs until this many have failed, then cancel the running jobs")
+		fs.StringVar(&c.Only, "only", "", "run only the jobs with these comma separated names, glob patterns of names or ids and the jobs they depend on")
+		fs.Var((*tagsFlag)(&c.Tags), "tags", "run only the jobs with any of these comma separated tags and the jobs they depend on")
+		fs.BoolVar(&c.TagsStrict, "tags-strict", false, "with -tags, run only the tagged jobs and not their dependencies")
+		fs.StringVar(&c.CacheDir, "cache-dir", "", "restore the outputs of jobs that ran before with the same inputs from this dir")
+		fs.StringVar(&c.MetricsAddr, "metrics-addr", "", "serve prometheus metrics at /metrics on this address while running")
+		fs.BoolVar(&c.Stream, "stream", false, "also write job output to the console, prefixed with the job")
+		fs.BoolVar(&c.Progress, "progress", false, "print a line of how many jobs are done, running and failed instead of each job's log messages")
+	}
+	err := fs.Parse(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	args = fs.Args()
+	if c.Name == "logs" {
+		if len(args) == 0 {
+			return nil, errors.New("job not specified")
+		}
+		c.JobName, args = args[0], args[1:]
+	}
+	if len(args) > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %v", args)
+	}
+	fromJSON := c.Name == "status" || c.Name == "history" || c.Name == "logs"
+	switch {
+	case fromJSON && c.YamlPath == "" && c.WorkflowDir == "" && c.StateDir == "":
+		return nil, errors.New("workflow dir not specified")
+	case !fromJSON && c.YamlPath == "":
+		return nil, errors.New("workflow yaml not specified")
+	}
+	if !validLogFormat(c.LogFormat) {
+		return nil, fmt.Errorf("unknown log format '%s'", c.LogFormat)
+	}
+	if c.Name == "graph" && c.GraphFormat != GraphFormatDOT && c.GraphFormat != GraphFormatJSON {
+		return nil, fmt.Errorf("unknown graph format '%s'", c.GraphFormat)
+	}
+	return c, nil
+}
+
+// Execute runs the command, returning the exit status for the process
+func (c *Command) Execute() int {
+	switch c.Name {
+	case "init":
+		return c.init()
+	case "status":
+		return c.status()
+	case "history":
+		return c.history()
+	case "logs":
+		return c.logs()
+	}
+	w, err := workflowFromYamlVars(c.YamlPath, c.WorkflowDir, c.StateDir, c.Vars)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return ExitInvalidWorkflow
+	}
+	w.logger = newLogger(os.Stderr, c.LogFormat)
+	w.logger.verbosity = verbosity(c.Verbose, c.Quiet)
+	switch c.Name {
+	case "graph":
+		if c.GraphFormat != GraphFormatJSON {
+			fmt.Print(w.ToDOT())
+			return ExitSuccess
+		}
+		b, err := w.GraphJSON()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return ExitInvalidWorkflow
+		}
+		fmt.Println(string(b))
+		return ExitSuccess
+	case "validate":
+		if err := w.Validate(); err != nil {
+			fmt.Println("Invalid workflow:", err)
+			return ExitInvalidWorkflow
+		}
+		if !c.Strict {
+			fmt.Println("Workflow is valid")
+			return ExitSuccess
+		}
+		if c.Only != "" {
+			w.Only = c.Only
+		}
+		if len(c.Tags) > 0 {
+			w.OnlyTags = c.Tags
+		}
+		warnings, err := w.Warnings()
+		if err != nil {
+			fmt.Println("Invalid workflow:", err)
+			return ExitInvalidWorkflow
+		}
+		for _, warning := range warnings {
+			fmt.Println("Warning:", warning)
+		}
+		fmt.Printf("Workflow is valid with %d warnings\n", len(warnings))
+		return ExitSuccess
+	case "gc":
+		if err := w.gc(os.Stdout, c.DryRun); err != nil {
+			fmt.Println("Error:", err)
+			return ExitInvalidWorkflow
+		}
+		return ExitSuccess
+	default:
+		w.DryRun = w.DryRun || c.DryRun
+		w.Explain = w.Explain || c.Explain
+		w.Resume = w.Resume || c.Resume
+		w.NoEventDB = w.NoEventDB || c.NoEventDB
+		w.QuietSuccess = w.QuietSuccess || c.QuietSuccess
+		w.KeepGoing = w.KeepGoing || c.KeepGoing
+		w.FailFast = w.FailFast || c.FailFast
+		if c.MaxFailures != 0 {
+			w.MaxFailures = c.MaxFailures
+		}
+		w.Stream = w.Stream || c.Stream
+		w.Progress = w.Progress || c.Progress
+		if c.Only != "" {
+			w.Only = c.Only
+		}
+		if len(c.Tags) > 0 {
+			w.OnlyTags = c.Tags
+		}
+		w.TagsStrict = w.TagsStrict || c.TagsStrict
+		if c.MetricsAddr != "" {
+			w.MetricsAddr = c.MetricsAddr
+		}
+		if c.CacheDir != "" {
+			cacheDir, err := filepath.Abs(c.CacheDir)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return ExitInvalidWorkflow
+			}
+			w.CacheDir = cacheDir
+		}
+		if c.Name == "serve" {
+			w.ServeAddr = c.Addr
+		}
+		if c.Name == "watch" {
+			return w.Watch(c.WatchPaths, c.Debounce)
+		}
+		return w.Run()
+	}
+}
 
-	if workflowYaml == "" {
-		fmt.Println("Error: workflow yaml not specified")
-		flag.Usage()
-		os.Exit(2)
+// status prints the jobs of the workflow in the workflow dir, or that of the workflow yaml
+func (c *Command) status() int {
+	w, err := c.loadWorkflowJSON()
+	if err == nil {
+		err = w.printStatus(os.Stdout, time.Time(c.Since))
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		return ExitInvalidWorkflow
 	}
+	return ExitSuccess
+}
 
-	RunFromYaml(workflowYaml)
+// history prints the last runs of the workflow in the workflow dir, or that of the workflow yaml
+func (c *Command) history() int {
+	w, err := c.loadWorkflowJSON()
+	if err == nil {
+		err = w.printHistory(os.Stdout, time.Time(c.Since))
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		return ExitInvalidWorkflow
+	}
+	return ExitSuccess
+}
+
+// logs prints the logs of the job named JobName from the last run of the workflow, following them with Follow set
+func (c *Command) logs() int {
+	w, err := c.loadWorkflowJSON()
+	if err == nil {
+		err = w.printLogs(c.JobName, os.Stdout, os.Stderr, c.Follow, time.Time(c.Since))
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		return ExitInvalidWorkflow
+	}
+	return ExitSuccess
+}
+
+// loadWorkflowJSON reads the workflow JSON in the state dir, the workflow dir, or that of the workflow yaml
+func (c *Command) loadWorkflowJSON() (*Workflow, error) {
+	switch {
+	case c.StateDir != "":
+		return readWorkflowJSON(path.Join(c.StateDir, "wf.json"))
+	case c.WorkflowDir != "":
+		return loadWorkflowJSON(c.WorkflowDir)
+	}
+	w, err := workflowFromYamlVars(c.YamlPath, "", "", c.Vars)
+	if err != nil {
+		return nil, err
+	}
+	return readWorkflowJSON(w.WFJsonPath)
+}
+
+func main() {
+	c, err := InitFlags(os.Args[1:])
+	switch {
+	case err == flag.ErrHelp:
+		fmt.Print(usage)
+		os.Exit(0)
+	case err != nil:
+		fmt.Println("Error:", err)
+		fmt.Print(usage)
+		os.Exit(ExitUsage)
+	}
+	os.Exit(c.Execute())
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInitFlags(t *testing.T) {
+	testCases := []struct {
+		name    string
+		args    []string
+		want    *Command
+		wantErr bool
+	}{
+		{"Run", []string{"run", "-f", "wf.yaml"}, &Command{Name: "run", YamlPath: "wf.yaml", LogFormat: LogFormatText}, false},
+		{"RunWorkflowDir", []string{"run", "-f", "wf.yaml", "-workflow-dir", "out"},
+			&Command{Name: "run", YamlPath: "wf.yaml", WorkflowDir: "out", LogFormat: LogFormatText}, false},
+		{"RunDryRun", []string{"run", "--dry-run", "-f", "wf.yaml"},
+			&Command{Name: "run", YamlPath: "wf.yaml", DryRun: true, LogFormat: LogFormatText}, false},
+		{"RunResume", []string{"run", "-f", "wf.yaml", "-resume"},
+			&Command{Name: "run", YamlPath: "wf.yaml", Resume: true, LogFormat: LogFormatText}, false},
+		{"RunOnly", []string{"run", "-f", "wf.yaml", "-only", "build"},
+			&Command{Name: "run", YamlPath: "wf.yaml", Only: "build", LogFormat: LogFormatText}, false},
+		{"RunTags", []string{"run", "-f", "wf.yaml", "-tags", "build,test", "-tags", "lint", "-tags-strict"},
+			&Command{Name: "run", YamlPath: "wf.yaml", Tags: []string{"build", "test", "lint"}, TagsStrict: true, LogFormat: LogFormatText}, false},
+		{"RunEmptyTag", []string{"run", "-f", "wf.yaml", "-tags", "build,"}, nil, true},
+		{"RunMetricsAddr", []string{"run", "-f", "wf.yaml", "-metrics-addr", ":9090"},
+			&Command{Name: "run", YamlPath: "wf.yaml", MetricsAddr: ":9090", LogFormat: LogFormatText}, false},
+		{"RunVars", []string{"run", "-f", "wf.yaml", "-var", "a=1", "--var", "b=x=y"},
+			&Command{Name: "run", YamlPath: "wf.yaml", Vars: map[string]string{"a": "1", "b": "x=y"}, LogFormat: LogFormatText}, false},
+		{"RunMalformedVar", []string{"run", "-f", "wf.yaml", "-var", "a"}, nil, true},
+		{"RunVerbose", []string{"run", "-f", "wf.yaml", "-v", "-v"},
+			&Command{Name: "run", YamlPath: "wf.yaml", Verbose: 2, LogFormat: LogFormatText}, false},
+		{"RunQuiet", []string{"run", "-f", "wf.yaml", "-quiet"},
+			&Command{Name: "run", YamlPath: "wf.yaml", Quiet: true, LogFormat: LogFormatText}, false},
+		{"RunStream", []string{"run", "-f", "wf.yaml", "-stream"},
+			&Command{Name: "run", YamlPath: "wf.yaml", Stream: true, LogFormat: LogFormatText}, false},
+		{"RunCacheDir", []string{"run", "-f", "wf.yaml", "-cache-dir", "cache"},
+			&Command{Name: "run", YamlPath: "wf.yaml", CacheDir: "cache", LogFormat: LogFormatText}, false},
+		{"RunNoDB", []string{"run", "-f", "wf.yaml", "-no-db"},
+			&Command{Name: "run", YamlPath: "wf.yaml", NoEventDB: true, LogFormat: LogFormatText}, false},
+		{"RunProgress", []string{"run", "-f", "wf.yaml", "-progress"},
+			&Command{Name: "run", YamlPath: "wf.yaml", Progress: true, LogFormat: LogFormatText}, false},
+		{"Validate", []string{"validate", "-f", "wf.yaml"}, &Command{Name: "validate", YamlPath: "wf.yaml", LogFormat: LogFormatText}, false},
+		{"ValidateWorkflowDir", []string{"validate", "-workflow-dir=out", "-f=wf.yaml"},
+			&Command{Name: "validate", YamlPath: "wf.yaml", WorkflowDir: "out", LogFormat: LogFormatText}, false},
+		{"ValidateStrict", []string{"validate", "-strict", "-only", "deploy", "-f", "wf.yaml"},
+			&Command{Name: "validate", YamlPath: "wf.yaml", Strict: true, Only: "deploy", LogFormat: LogFormatText}, false},
+		{"RunStrict", []string{"run", "-strict", "-f", "wf.yaml"}, nil, true},
+		{"RunJSONLogs", []string{"run", "-f", "wf.yaml", "--log-format", "json"},
+			&Command{Name: "run", YamlPath: "wf.yaml", LogFormat: LogFormatJSON}, false},
+		{"UnknownLogFormat", []string{"run", "-f", "wf.yaml", "-log-format", "xml"}, nil, true},
+		{"Graph", []string{"graph", "-f", "wf.yaml"},
+			&Command{Name: "graph", YamlPath: "wf.yaml", LogFormat: LogFormatText, GraphFormat: GraphFormatDOT}, false},
+		{"GraphJSON", []string{"graph", "-f", "wf.yaml", "-format", "json"},
+			&Command{Name: "graph", YamlPath: "wf.yaml", LogFormat: LogFormatText, GraphFormat: GraphFormatJSON}, false},
+		{"GraphUnknownFormat", []string{"graph", "-f", "wf.yaml", "-format", "svg"}, nil, true},
+		{"Status", []string{"status", "-workflow-dir", "out"},
+			&Command{Name: "status", WorkflowDir: "out", LogFormat: LogFormatText}, false},
+		{"StatusNoWorkflowDir", []string{"status"}, nil, true},
+		{"RunExplain", []string{"run", "--explain", "--dry-run", "-f", "wf.yaml"},
+			&Command{Name: "run", YamlPath: "wf.yaml", DryRun: true, Explain: true, LogFormat: LogFormatText}, false},
+		{"GCDryRun", []string{"gc", "-f", "wf.yaml", "-dry-run"},
+			&Command{Name: "gc", YamlPath: "wf.yaml", DryRun: true, LogFormat: LogFormatText}, false},
+		{"StatusStateDir", []string{"status", "-state-dir", "state"},
+			&Command{Name: "status", StateDir: "state", LogFormat: LogFormatText}, false},
+		{"History", []string{"history", "-workflow-dir", "out"},
+			&Command{Name: "history", WorkflowDir: "out", LogFormat: LogFormatText}, false},
+		{"Logs", []string{"logs", "-workflow-dir", "out", "-follow", "build"},
+			&Command{Name: "logs", WorkflowDir: "out", Follow: true, JobName: "build", LogFormat: LogFormatText}, false},
+		{"HistorySince", []string{"history", "-workflow-dir", "out", "-since", "2018-02-05T07:49:50Z"},
+			&Command{Name: "history", WorkflowDir: "out", Since: sinceFlag(time.Date(2018, 2, 5, 7, 49, 50, 0, time.UTC)),
+				LogFormat: LogFormatText}, false},
+		{"StatusInvalidSince", []string{"status", "-workflow-dir", "out", "-since", "yesterday"}, nil, true},
+		{"RunSince", []string{"run", "-f", "wf.yaml", "-since", "24h"}, nil, true},
+		{"LogsNoJob", []string{"logs", "-workflow-dir", "out"}, nil, true},
+		{"LogsNoWorkflowDir", []string{"logs", "build"}, nil, true},
+		{"LogsTwoJobs", []string{"logs", "-workflow-dir", "out", "build", "test"}, nil, true},
+		{"RunKeepGoing", []string{"run", "-f", "wf.yaml", "-keep-going"},
+			&Command{Name: "run", YamlPath: "wf.yaml", KeepGoing: true, LogFormat: LogFormatText}, false},
+		{"RunMaxFailures", []string{"run", "-f", "wf.yaml", "-max-failures", "2"},
+			&Command{Name: "run", YamlPath: "wf.yaml", MaxFailures: 2, LogFormat: LogFormatText}, false},
+		{"RunQuietOnSuccess", []string{"run", "-f", "wf.yaml", "-quiet-on-success"},
+			&Command{Name: "run", YamlPath: "wf.yaml", QuietSuccess: true, LogFormat: LogFormatText}, false},
+		{"RunFailFast", []string{"run", "-f", "wf.yaml", "-fail-fast"},
+			&Command{Name: "run", YamlPath: "wf.yaml", FailFast: true, LogFormat: LogFormatText}, false},
+		{"Watch", []string{"watch", "-f", "wf.yaml", "-path", "src", "-path", "data", "-debounce", "1s"},
+			&Command{Name: "watch", YamlPath: "wf.yaml", WatchPaths: []string{"src", "data"}, Debounce: time.Second,
+				LogFormat: LogFormatText}, false},
+		{"Init", []string{"init"}, &Command{Name: "init", WorkflowDir: "."}, false},
+		{"InitDirForce", []string{"init", "-force", "pipelines"}, &Command{Name: "init", WorkflowDir: "pipelines", Force: true}, false},
+		{"InitTwoDirs", []string{"init", "a", "b"}, nil, true},
+		{"Serve", []string{"serve", "-f", "wf.yaml", "-addr", ":9000", "-resume"},
+			&Command{Name: "serve", YamlPath: "wf.yaml", Addr: ":9000", Resume: true, LogFormat: LogFormatText}, false},
+		{"NoCommand", []string{}, nil, true},
+		{"UnknownCommand", []string{"launch", "-f", "wf.yaml"}, nil, true},
+		{"MissingYaml", []string{"run"}, nil, true},
+		{"UnknownFlag", []string{"run", "-f", "wf.yaml", "-bogus"}, nil, true},
+		{"ValidateDryRun", []string{"validate", "-dry-run", "-f", "wf.yaml"}, nil, true},
+		{"ExtraArgs", []string{"validate", "-f", "wf.yaml", "extra"}, nil, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := InitFlags(tc.args)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected error parsing %v", tc.args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error parsing %v: %v", tc.args, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// expandMatrix replaces every job with a Matrix by a copy of the job for each combination
+// of the matrix values. A copy's values are substituted for its ${matrix.key} references,
+// it is named after the job and its values and keeps the job's dependencies.
+// Jobs that depend on a matrix job, nested or through depends_on, depend on all of its copies
+func expandMatrix(spec *Workflow) SpecErrors {
+	var errs SpecErrors
+	expanded := map[*Job][]*Job{}
+	var expand func(field string, jobs []*Job) []*Job
+	expand = func(field string, jobs []*Job) []*Job {
+		result := []*Job{}
+		for i, j := range jobs {
+			jobField := fmt.Sprintf("%s[%d]", field, i)
+			if copies, ok := expanded[j]; ok {
+				result = append(result, copies...)
+				continue
+			}
+			j.Dependencies = expand(jobField+".dependencies", j.Dependencies)
+			copies := []*Job{j}
+			if len(j.Matrix) > 0 {
+				var matrixErrs SpecErrors
+				copies, matrixErrs = matrixJobs(jobField, j)
+				errs = append(errs, matrixErrs...)
+			}
+			expanded[j] = copies
+			result = append(result, copies...)
+		}
+		return result
+	}
+	spec.Jobs = expand("jobs", spec.Jobs)
+	return errs
+}
+
+// matrixJobs returns a copy of j for each combination of its matrix values, keys in sorted order
+func matrixJobs(field string, j *Job) ([]*Job, SpecErrors) {
+	keys := []string{}
+	for k := range j.Matrix {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var errs SpecErrors
+	for _, k := range keys {
+		if len(j.Matrix[k]) == 0 {
+			errs = append(errs, SpecError{field + ".matrix." + k, "no values"})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	combinations := []map[string]string{{}}
+	for _, k := range keys {
+		next := []map[string]string{}
+		for _, c := range combinations {
+			for _, v := range j.Matrix[k] {
+				combination := map[string]string{"matrix." + k: v}
+				for ck, cv := range c {
+					combination[ck] = cv
+				}
+				next = append(next, combination)
+			}
+		}
+		combinations = next
+	}
+
+	copies := []*Job{}
+	for _, c := range combinations {
+		job := *j
+		job.ID = 0
+		job.Matrix = nil
+		job.matrixVars = c
+		job.matrixName = j.Name
+		job.Directories = append([]string{}, j.Directories...)
+		job.Inputs = append([]string{}, j.Inputs...)
+		job.Outputs = append([]string{}, j.Outputs...)
+		job.Args = append([]string(nil), j.Args...)
+		if j.Name != "" {
+			values := []string{}
+			for _, k := range keys {
+				values = append(values, k+"="+c["matrix."+k])
+			}
+			job.Name = j.Name + "[" + strings.Join(values, ",") + "]"
+		}
+		copies = append(copies, &job)
+	}
+	return copies, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMatrix(t *testing.T) {
+	defer cleanTestData(t)
+	wf, err := workflowFromYaml(writeTestYaml(t, "Matrix", `
+workflow_dir: .
+vars:
+  tool: cc
+jobs:
+- name: package
+  cmd: echo package
+  depends_on: [build]
+- name: build
+  cmd: ${tool} --arch ${matrix.arch} > build_${matrix.region}_${matrix.arch}.log
+  outputs: [ "build_${matrix.region}_${matrix.arch}.log" ]
+  matrix:
+    region: [us, eu]
+    arch: [amd64, arm64]
+  dependencies:
+  - name: fetch
+    cmd: echo fetch
+`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]*Job{}
+	for _, j := range wf.allJobs() {
+		byName[j.Name] = j
+	}
+	if len(byName) != 6 {
+		t.Fatalf("expected package, fetch and 4 build jobs, got %d jobs", len(byName))
+	}
+	wantCmds := map[string]string{
+		"build[arch=amd64,region=us]": "cc --arch amd64 > build_us_amd64.log",
+		"build[arch=arm64,region=us]": "cc --arch arm64 > build_us_arm64.log",
+		"build[arch=amd64,region=eu]": "cc --arch amd64 > build_eu_amd64.log",
+		"build[arch=arm64,region=eu]": "cc --arch arm64 > build_eu_arm64.log",
+	}
+	fetch := byName["fetch"]
+	ids := map[int]bool{}
+	for name, cmd := range wantCmds {
+		j := byName[name]
+		if j == nil {
+			t.Errorf("expected a job named %s", name)
+			continue
+		}
+		if j.Cmd != cmd {
+			t.Errorf("expected %s to run %q, got %q", name, cmd, j.Cmd)
+		}
+		if want := []string{cmd[len(cmd)-len("build_us_amd64.log"):]}; !reflect.DeepEqual(j.Outputs, want) {
+			t.Errorf("expected %s to output %v, got %v", name, want, j.Outputs)
+		}
+		if len(j.Dependencies) != 1 || j.Dependencies[0] != fetch {
+			t.Errorf("expected %s to depend on the one fetch job", name)
+		}
+		ids[j.ID] = true
+	}
+	if len(ids) != 4 {
+		t.Errorf("expected the build jobs to have unique ids, got %v", ids)
+	}
+	deps := []string{}
+	for _, d := range byName["package"].Dependencies {
+		deps = append(deps, d.Name)
+	}
+	sort.Strings(deps)
+	if len(deps) != 4 || deps[0] != "build[arch=amd64,region=eu]" {
+		t.Errorf("expected package to depend on every build job, got %v", deps)
+	}
+}
+
+func TestMatrixErrors(t *testing.T) {
+	err := ValidateWorkflowSpec([]byte(`
+workflow_dir: out
+jobs:
+- cmd: echo ${matrix.os}
+  matrix:
+    arch: [amd64]
+- cmd: echo ${matrix.arch}
+  matrix:
+    arch: []
+`))
+	want := SpecErrors{
+		{"jobs[1].matrix.arch", "no values"},
+		{"jobs[0].cmd", "undefined variable 'matrix.os'"},
+	}
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("expected %v, got %v", want, err)
+	}
+}
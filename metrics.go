@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// jobDurationBuckets are the upper bounds, in seconds, of the job duration histogram
+var jobDurationBuckets = []float64{1, 10, 60, 300, 900, 1800, 3600, 7200}
+
+// metrics counts jobs as the workflow runs, served in the Prometheus text format
+type metrics struct {
+	mutex       *sync.Mutex
+	jobsTotal   map[string]int
+	running     int
+	buckets     []int
+	durationSum float64
+	durations   int
+}
+
+func newMetrics() *metrics {
+	return &metrics{mutex: &sync.Mutex{}, jobsTotal: map[string]int{}, buckets: make([]int, len(jobDurationBuckets))}
+}
+
+func (m *metrics) jobStarted() {
+	m.mutex.Lock()
+	m.running++
+	m.mutex.Unlock()
+}
+
+func (m *metrics) jobStopped() {
+	m.mutex.Lock()
+	m.running--
+	m.mutex.Unlock()
+}
+
+// jobFinished counts the job by its final status, and its duration if it ran
+func (m *metrics) jobFinished(j *Job) {
+	if j.Status == StatusPending {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.jobsTotal[j.Status]++
+	if j.Attempts == 0 {
+		return
+	}
+	seconds := j.Duration.Seconds()
+	for i, le := range jobDurationBuckets {
+		if seconds <= le {
+			m.buckets[i]++
+		}
+	}
+	m.durationSum += seconds
+	m.durations++
+}
+
+func (m *metrics) write(out io.Writer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	fmt.Fprintln(out, "# HELP gflow_jobs_total Jobs that have finished, by status.")
+	fmt.Fprintln(out, "# TYPE gflow_jobs_total counter")
+	statuses := []string{}
+	for status := range m.jobsTotal {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		fmt.Fprintf(out, "gflow_jobs_total{status=%q} %d\n", status, m.jobsTotal[status])
+	}
+	fmt.Fprintln(out, "# HELP gflow_jobs_running Jobs currently executing.")
+	fmt.Fprintln(out, "# TYPE gflow_jobs_running gauge")
+	fmt.Fprintf(out, "gflow_jobs_running %d\n", m.running)
+	fmt.Fprintln(out, "# HELP gflow_job_duration_seconds Duration of the jobs that have finished.")
+	fmt.Fprintln(out, "# TYPE gflow_job_duration_seconds histogram")
+	for i, le := range jobDurationBuckets {
+		fmt.Fprintf(out, "gflow_job_duration_seconds_bucket{le=\"%g\"} %d\n", le, m.buckets[i])
+	}
+	fmt.Fprintf(out, "gflow_job_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.durations)
+	fmt.Fprintf(out, "gflow_job_duration_seconds_sum %g\n", m.durationSum)
+	fmt.Fprintf(out, "gflow_job_duration_seconds_count %d\n", m.durations)
+}
+
+func (m *metrics) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.write(rw)
+}
+
+// serveMetrics serves the workflow's metrics at /metrics on MetricsAddr,
+// returning a func shutting the server down
+func (w *Workflow) serveMetrics() (func(), error) {
+	listener, err := net.Listen("tcp", w.MetricsAddr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", w.metrics)
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	w.logger.Infof(0, "Serving metrics at http://%s/metrics", listener.Addr())
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	defer cleanTestData(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	wf := testWorkflow(t, "Metrics")
+	wf.MetricsAddr = addr
+	release := wf.pathToWDir("release")
+	wait := "while [[ ! -f " + release + " ]]; do sleep 0.01; done"
+	quick := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	a := newJob(wf, []string{}, []*Job{quick}, []string{}, false, wait)
+	b := newJob(wf, []string{}, []*Job{quick}, []string{}, false, wait)
+	wf.AddJob(a, b)
+
+	status := make(chan int)
+	go func() { status <- wf.Run() }()
+
+	scrape := func() (string, error) {
+		resp, err := http.Get("http://" + addr + "/metrics")
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		return string(body), err
+	}
+	body := ""
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		body, _ = scrape()
+		if strings.Contains(body, "gflow_jobs_running 2\n") {
+			break
+		}
+	}
+	if !strings.Contains(body, "gflow_jobs_running 2\n") {
+		t.Errorf("expected the running jobs gauge to reach 2 mid-run, last scraped:\n%s", body)
+	}
+	if !strings.Contains(body, `gflow_jobs_total{status="succeeded"} 1`) {
+		t.Errorf("expected the quick job to be counted as succeeded mid-run, scraped:\n%s", body)
+	}
+
+	if err := ioutil.WriteFile(release, []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectZero(t, <-status)
+	if _, err := scrape(); err == nil {
+		t.Error("expected the metrics server to shut down once the workflow returned")
+	}
+	out := &bytes.Buffer{}
+	wf.metrics.write(out)
+	for _, want := range []string{`gflow_jobs_total{status="succeeded"} 3`, "gflow_jobs_running 0", "gflow_job_duration_seconds_count 3"} {
+		if !strings.Contains(out.String(), want+"\n") {
+			t.Errorf("expected final metrics to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
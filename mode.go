@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Default permissions of the dirs and files gflow creates
+const (
+	defaultDirMode  = 0755
+	defaultFileMode = 0644
+)
+
+// Mode is a file permission read from and written to yaml/json
+// as an octal string such as "0750", the zero Mode means the default
+type Mode os.FileMode
+
+// MarshalJSON writes the mode as an octal string
+func (m Mode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("%04o", uint32(m)))
+}
+
+// UnmarshalJSON parses an octal string
+func (m *Mode) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("expected an octal string such as \"0755\", got %s", b)
+	}
+	perm, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || perm > 0777 {
+		return fmt.Errorf("invalid mode '%s', expected an octal string such as \"0755\"", s)
+	}
+	*m = Mode(perm)
+	return nil
+}
+
+// dirMode is the permission of the dirs gflow creates under the workflow dir
+func (w *Workflow) dirMode() os.FileMode {
+	if w.DirMode == 0 {
+		return defaultDirMode
+	}
+	return os.FileMode(w.DirMode)
+}
+
+// fileMode is the permission of the logs, event db and workflow json gflow writes
+func (w *Workflow) fileMode() os.FileMode {
+	if w.FileMode == 0 {
+		return defaultFileMode
+	}
+	return os.FileMode(w.FileMode)
+}
+
+// execMode is the permission of job scripts, the fileMode made executable wherever it is readable
+func (w *Workflow) execMode() os.FileMode {
+	mode := w.fileMode()
+	return mode | (mode&0444)>>2
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// webhookTimeout bounds how long posting to a webhook may take
+const webhookTimeout = 10 * time.Second
+
+// Notifications configures how the outcome of a run is reported, as its jobs fail and once it finishes.
+// When WebhookURL is set, a json summary of the run is POSTed to it once the workflow finishes.
+// When SlackWebhookURL is set, a message is posted to that Slack incoming webhook
+// as each job fails and once the workflow finishes
+type Notifications struct {
+	WebhookURL      string `json:"webhook_url,omitempty"`
+	SlackWebhookURL string `json:"slack_webhook_url,omitempty"`
+}
+
+// Types of notification events
+const (
+	NotifyWorkflowFinished = "workflow_finished"
+	NotifyJobFailed        = "job_failed"
+)
+
+// NotificationEvent is what a Notifier is told of a run: that the workflow finished, with the Summary
+// of the run, or that one of its jobs failed, with the Job
+type NotificationEvent struct {
+	Type    string
+	Summary completionSummary
+	Job     *Job
+}
+
+// Notifier reports the events of a workflow run, it may ignore the types of events it does not report
+type Notifier interface {
+	Notify(e NotificationEvent) error
+}
+
+// WebhookNotifier POSTs the json summary of the run to URL once the workflow finishes
+type WebhookNotifier struct {
+	URL string
+}
+
+// Notify posts the summary of a finished workflow
+func (n WebhookNotifier) Notify(e NotificationEvent) error {
+	if e.Type != NotifyWorkflowFinished {
+		return nil
+	}
+	if err := postJSON(n.URL, e.Summary); err != nil {
+		return fmt.Errorf("webhook: %v", err)
+	}
+	return nil
+}
+
+// SlackNotifier posts a message to the Slack incoming webhook WebhookURL as each job fails
+// and once the workflow finishes
+type SlackNotifier struct {
+	WebhookURL string
+}
+
+// slackMessage is the payload of a Slack incoming webhook
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// Notify posts the event as a Slack message
+func (n SlackNotifier) Notify(e NotificationEvent) error {
+	if err := postJSON(n.WebhookURL, slackMessage{slackText(e)}); err != nil {
+		return fmt.Errorf("slack: %v", err)
+	}
+	return nil
+}
+
+// slackText formats the event in Slack's markdown
+func slackText(e NotificationEvent) string {
+	if e.Type == NotifyJobFailed {
+		j := e.Job
+		return fmt.Sprintf(":x: Job *%s* (job_id:%d) of `%s` failed on attempt %d: %s\nstderr log: `%s`",
+			j.label(), j.ID, j.workflow.WorkflowDir, j.Attempts, j.workflow.redact(j.Reason), j.StderrLog)
+	}
+	s := e.Summary
+	icon := ":x:"
+	if s.ExitStatus == ExitSuccess {
+		icon = ":white_check_mark:"
+	}
+	return fmt.Sprintf("%s Workflow `%s` finished: %s (exit status %d) in %.1fs\n"+
+		"%d succeeded, %d failed, %d failed allowed, %d skipped, %d interrupted, %d cancelled",
+		icon, s.WorkflowDir, exitStatusNames[s.ExitStatus], s.ExitStatus, s.Duration,
+		s.Succeeded, s.Failed, s.FailedAllowed, s.Skipped, s.Interrupted, s.Cancelled)
+}
+
+// completionSummary is the payload sent when a workflow finishes
+type completionSummary struct {
+	WorkflowDir   string  `json:"workflow_dir"`
+	ExitStatus    int     `json:"exit_status"`
+	Succeeded     int     `json:"succeeded"`
+	Failed        int     `json:"failed"`
+	FailedAllowed int     `json:"failed_allowed"`
+	Skipped       int     `json:"skipped"`
+	Interrupted   int     `json:"interrupted"`
+	Cancelled     int     `json:"cancelled"`
+	Duration      float64 `json:"duration_seconds"`
+}
+
+func newCompletionSummary(w *Workflow, exitStatus int, jobs []*Job, duration time.Duration) completionSummary {
+	summary := completionSummary{
+		WorkflowDir: w.WorkflowDir,
+		ExitStatus:  exitStatus,
+		Duration:    duration.Seconds(),
+	}
+	for _, j := range jobs {
+		switch j.Status {
+		case StatusSucceeded:
+			summary.Succeeded++
+		case StatusFailed:
+			summary.Failed++
+		case StatusFailedAllowed:
+			summary.FailedAllowed++
+		case StatusSkipped:
+			summary.Skipped++
+		case StatusInterrupted:
+			summary.Interrupted++
+		case StatusCancelled:
+			summary.Cancelled++
+		}
+	}
+	return summary
+}
+
+// notifiers returns the Notifiers configured by the workflow's Notifications followed by its own Notifiers
+func (w *Workflow) notifiers() []Notifier {
+	notifiers := []Notifier{}
+	if w.Notifications.WebhookURL != "" {
+		notifiers = append(notifiers, WebhookNotifier{w.Notifications.WebhookURL})
+	}
+	if w.Notifications.SlackWebhookURL != "" {
+		notifiers = append(notifiers, SlackNotifier{w.Notifications.SlackWebhookURL})
+	}
+	return append(notifiers, w.Notifiers...)
+}
+
+// notifyEvent tells every notifier of the event. Failing to notify is logged,
+// it does not change the outcome of the workflow
+func (w *Workflow) notifyEvent(jobID int, e NotificationEvent) {
+	for _, n := range w.notifiers() {
+		if err := n.Notify(e); err != nil {
+			w.logger.Errorf(jobID, "Failed notifying %v", err)
+		}
+	}
+}
+
+// notify reports the outcome of the workflow once the notifications of its failed jobs are sent
+func (w *Workflow) notify(exitStatus int, jobs []*Job, duration time.Duration) {
+	w.notifying.Wait()
+	w.notifyEvent(0, NotificationEvent{Type: NotifyWorkflowFinished,
+		Summary: newCompletionSummary(w, exitStatus, jobs, duration)})
+}
+
+// notifyFailed reports that the job failed without waiting for the notifiers,
+// so the jobs waiting on it are not held up. Run waits for them before it notifies its outcome
+func (j *Job) notifyFailed() {
+	w := j.workflow
+	if len(w.notifiers()) == 0 {
+		return
+	}
+	w.notifying.Add(1)
+	go func() {
+		defer w.notifying.Done()
+		w.notifyEvent(j.ID, NotificationEvent{Type: NotifyJobFailed, Job: j})
+	}()
+}
+
+func postJSON(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	return nil
+}
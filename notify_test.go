@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWebhookNotification(t *testing.T) {
+	defer cleanTestData(t)
+	summaries := make(chan completionSummary, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var summary completionSummary
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("expected a json POST, got %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&summary); err != nil {
+			t.Error(err)
+		}
+		summaries <- summary
+	}))
+	defer server.Close()
+
+	wf := testWorkflow(t, "WebhookNotification")
+	wf.KeepGoing = true
+	wf.Notifications.WebhookURL = server.URL
+	failed := newJob(wf, []string{}, []*Job{}, []string{}, false, "false")
+	wf.AddJob(
+		newJob(wf, []string{}, []*Job{}, []string{}, false, "echo ok"),
+		newJob(wf, []string{}, []*Job{failed}, []string{}, false, "echo skipped"),
+	)
+	if status := wf.Run(); status != ExitJobsFailed {
+		t.Errorf("expected exit %d, wf exited %d", ExitJobsFailed, status)
+	}
+
+	select {
+	case summary := <-summaries:
+		want := completionSummary{
+			WorkflowDir: wf.WorkflowDir,
+			ExitStatus:  ExitJobsFailed,
+			Succeeded:   1,
+			Failed:      1,
+			Skipped:     1,
+			Duration:    summary.Duration,
+		}
+		if summary != want {
+			t.Errorf("expected payload %+v, got %+v", want, summary)
+		}
+		if summary.Duration <= 0 {
+			t.Errorf("expected a positive duration, got %v", summary.Duration)
+		}
+	default:
+		t.Fatal("expected the webhook to be notified")
+	}
+}
+
+func TestWebhookFailureKeepsExitStatus(t *testing.T) {
+	defer cleanTestData(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	wf := testWorkflow(t, "WebhookFailure")
+	wf.Notifications.WebhookURL = server.URL
+	wf.AddJob(newJob(wf, []string{}, []*Job{}, []string{}, false, "echo ok"))
+	expectZero(t, wf.Run())
+}
+
+func TestSlackNotification(t *testing.T) {
+	defer cleanTestData(t)
+	messages := make(chan map[string]interface{}, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var message map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			t.Error(err)
+		}
+		messages <- message
+	}))
+	defer server.Close()
+
+	wf := testWorkflow(t, "SlackNotification")
+	wf.Notifications.SlackWebhookURL = server.URL
+	failed := newJob(wf, []string{}, []*Job{}, []string{}, false, "exit 3")
+	failed.Name = "build"
+	wf.AddJob(failed)
+	expectNonZero(t, wf.Run())
+
+	if len(messages) != 2 {
+		t.Fatalf("expected a message for the failed job and for the workflow, got %d", len(messages))
+	}
+	want := map[string]interface{}{"text": fmt.Sprintf(
+		":x: Job *build* (job_id:%d) of `%s` failed on attempt 1: exit status 3\nstderr log: `%s`",
+		failed.ID, wf.WorkflowDir, failed.StderrLog)}
+	if got := <-messages; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected job failure message %v, got %v", want, got)
+	}
+	finished := (<-messages)["text"].(string)
+	wantPrefix := fmt.Sprintf(":x: Workflow `%s` finished: failed (exit status %d) in ", wf.WorkflowDir, ExitJobsFailed)
+	if !strings.HasPrefix(finished, wantPrefix) ||
+		!strings.HasSuffix(finished, "\n0 succeeded, 1 failed, 0 failed allowed, 0 skipped, 0 interrupted, 0 cancelled") {
+		t.Errorf("expected workflow finished message, got %q", finished)
+	}
+}
+
+func TestSlackTextRedacted(t *testing.T) {
+	wf := &Workflow{WorkflowDir: "/work", secrets: map[string]string{"TOKEN": "hunter2"}}
+	j := &Job{workflow: wf, ID: 2, Name: "deploy", Attempts: 1, Reason: "could not log in with hunter2"}
+	text := slackText(NotificationEvent{Type: NotifyJobFailed, Job: j})
+	if strings.Contains(text, "hunter2") || !strings.Contains(text, "could not log in with "+redacted) {
+		t.Errorf("expected the secret to be redacted from the message, got %q", text)
+	}
+}
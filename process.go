@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup starts cmd in its own process group, so that when it is
+// cancelled the signal reaches any children the job script spawned.
+// Cancelling sends SIGTERM, if cmd has not exited after grace it is killed
+func setProcessGroup(cmd *exec.Cmd, grace time.Duration) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	}
+	cmd.WaitDelay = grace
+}
+
+// killProcessGroup kills whatever is left of cmd's process group
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// Bounds of the niceness of a job's process
+const (
+	minNice = -20
+	maxNice = 19
+)
+
+// clampNice returns nice within the bounds of a process niceness
+func clampNice(nice int) int {
+	switch {
+	case nice < minNice:
+		return minNice
+	case nice > maxNice:
+		return maxNice
+	}
+	return nice
+}
+
+// setNice sets the niceness of every process in the group of the started cmd, so that processes
+// it started before the niceness was set have it too, and those it goes on to start inherit it
+func setNice(cmd *exec.Cmd, nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PGRP, cmd.Process.Pid, nice)
+}
+
+// signalNames names the signals a job is commonly killed by
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGTRAP: "SIGTRAP",
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGUSR1: "SIGUSR1",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGUSR2: "SIGUSR2",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGALRM: "SIGALRM",
+	syscall.SIGTERM: "SIGTERM",
+	syscall.SIGXCPU: "SIGXCPU",
+	syscall.SIGXFSZ: "SIGXFSZ",
+}
+
+// exitSignal returns the name of the signal that terminated the command that returned err,
+// "" if it was not killed by a signal. As the command runs as a bash script, a command the script
+// ran being killed by one of signalNames is told by the script exiting 128 plus the signal number
+func exitSignal(err error) string {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return ""
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok {
+		return ""
+	}
+	if !status.Signaled() {
+		return signalNames[syscall.Signal(status.ExitStatus()-128)]
+	}
+	if name, ok := signalNames[status.Signal()]; ok {
+		return name
+	}
+	return strconv.Itoa(int(status.Signal()))
+}
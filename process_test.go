@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestExitSignal(t *testing.T) {
+	defer cleanTestData(t)
+	testCases := []struct {
+		name   string
+		cmd    string
+		reason string
+	}{
+		{"Kill", "kill -KILL $$", "killed by signal SIGKILL"},
+		{"Term", "kill -TERM $$", "killed by signal SIGTERM"},
+		{"ChildKill", "sh -c 'kill -KILL $$'", "killed by signal SIGKILL"},
+		{"ChildSegv", "sh -c 'kill -SEGV $$'", "killed by signal SIGSEGV"},
+		{"Exit", "exit 3", "exit status 3"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wf := testWorkflow(t, "ExitSignal"+tc.name)
+			j := newJob(wf, []string{}, []*Job{}, []string{}, false, tc.cmd)
+			wf.AddJob(j)
+			expectNonZero(t, wf.Run())
+			if j.Status != StatusFailed || j.Reason != tc.reason {
+				t.Errorf("expected job to fail with reason '%s', got %s: '%s'", tc.reason, j.Status, j.Reason)
+			}
+		})
+	}
+}
+
+func TestNice(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("niceness is only tested on linux")
+	}
+	defer cleanTestData(t)
+	testCases := []struct {
+		name string
+		nice int
+		want string
+	}{
+		{"Lower", 5, "5"},
+		{"Clamped", 40, "19"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wf := testWorkflow(t, "Nice"+tc.name)
+			j := newJob(wf, []string{}, []*Job{}, []string{}, false, "sleep 0.1; nice > nice.out")
+			j.Nice = tc.nice
+			wf.AddJob(j)
+			expectZero(t, wf.Run())
+			got, err := ioutil.ReadFile(wf.pathToWDir("nice.out"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimSpace(string(got)) != tc.want {
+				t.Errorf("expected the job to run at nice %s, got %q", tc.want, string(got))
+			}
+		})
+	}
+}
+
+func TestUmask(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("umask is only tested on linux")
+	}
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "Umask")
+	umask := Mode(0077)
+	j := newJob(wf, []string{}, []*Job{}, []string{"private.txt"}, false, "echo secret > private.txt")
+	j.Umask = &umask
+	wf.AddJob(j)
+	expectZero(t, wf.Run())
+
+	info, err := os.Stat(wf.pathToWDir("private.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("expected the job's umask to create private.txt with mode 0600, got %04o", mode)
+	}
+}
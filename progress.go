@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// defaultProgressInterval is how often the progress summary is printed when not writing to a terminal
+const defaultProgressInterval = 10 * time.Second
+
+// clearLine returns the cursor to the start of the line and clears it
+const clearLine = "\r\x1b[K"
+
+// The progress type renders a summary of how many jobs are done, running and failed.
+// On a terminal the summary is redrawn in place on one line whenever it changes,
+// otherwise it is printed on a new line at most once per interval and once all jobs are done
+type progress struct {
+	out      io.Writer
+	tty      bool
+	interval time.Duration
+	now      func() time.Time
+	printed  time.Time
+	line     string
+}
+
+func newProgress(out io.Writer) *progress {
+	return &progress{out: out, tty: isTerminal(out), interval: defaultProgressInterval, now: time.Now}
+}
+
+// progressSummary summarizes the job states, done counts jobs that finished with any status
+func progressSummary(states map[int]jobState) (summary string, finished bool) {
+	done, running, failed := 0, 0, 0
+	for _, s := range states {
+		switch s.Status {
+		case StatusRunning:
+			running++
+		case StatusSucceeded, StatusSkipped, StatusInterrupted, StatusCancelled, StatusFailedAllowed:
+			done++
+		case StatusFailed:
+			done++
+			failed++
+		}
+	}
+	return fmt.Sprintf("%d/%d done, %d running, %d failed", done, len(states), running, failed), done == len(states)
+}
+
+// render prints the summary of the job states if it changed
+func (p *progress) render(states map[int]jobState) {
+	line, finished := progressSummary(states)
+	if line == p.line {
+		return
+	}
+	p.line = line
+	if p.tty {
+		fmt.Fprint(p.out, clearLine+line)
+		if finished {
+			fmt.Fprintln(p.out)
+		}
+		return
+	}
+	if now := p.now(); finished || now.Sub(p.printed) >= p.interval {
+		p.printed = now
+		fmt.Fprintln(p.out, line)
+	}
+}
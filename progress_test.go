@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	wf := testWorkflow(t, "Progress")
+	a := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	b := newJob(wf, []string{}, []*Job{}, []string{}, false, "false")
+	c := newJob(wf, []string{}, []*Job{a}, []string{}, false, "true")
+	jobs := []*Job{a, b, c}
+	transitions := []struct {
+		job    *Job
+		status string
+	}{
+		{a, StatusRunning},
+		{b, StatusRunning},
+		{a, StatusSucceeded},
+		{c, StatusRunning},
+		{b, StatusFailed},
+		{c, StatusSucceeded},
+	}
+
+	out := &bytes.Buffer{}
+	now := time.Now()
+	p := &progress{out: out, tty: true, interval: time.Minute, now: func() time.Time { return now }}
+	states := newJobStates(jobs, p)
+	for _, tr := range transitions {
+		states.update(tr.job, tr.status)
+	}
+	expected := clearLine + "0/3 done, 1 running, 0 failed" +
+		clearLine + "0/3 done, 2 running, 0 failed" +
+		clearLine + "1/3 done, 1 running, 0 failed" +
+		clearLine + "1/3 done, 2 running, 0 failed" +
+		clearLine + "2/3 done, 1 running, 1 failed" +
+		clearLine + "3/3 done, 0 running, 1 failed\n"
+	if out.String() != expected {
+		t.Errorf("expected the terminal progress line redrawn on each change\n%q, got\n%q", expected, out.String())
+	}
+
+	out.Reset()
+	p = &progress{out: out, tty: false, interval: time.Minute, now: func() time.Time { return now }}
+	states = newJobStates(jobs, p)
+	for i, tr := range transitions {
+		if i == 3 {
+			now = now.Add(time.Minute)
+		}
+		states.update(tr.job, tr.status)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	expectedLines := []string{
+		"0/3 done, 1 running, 0 failed",
+		"1/3 done, 2 running, 0 failed",
+		"3/3 done, 0 running, 1 failed",
+	}
+	if strings.Join(lines, "|") != strings.Join(expectedLines, "|") {
+		t.Errorf("expected a progress line per interval and once done %q, got %q", expectedLines, lines)
+	}
+}
+
+func TestProgressRun(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "ProgressRun")
+	wf.Progress = true
+	out := &bytes.Buffer{}
+	wf.stderr = out
+	wf.logger = newLogger(out, LogFormatText)
+	a := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	b := newJob(wf, []string{}, []*Job{a}, []string{}, false, "true")
+	wf.AddJob(b)
+	expectZero(t, wf.Run())
+	if !strings.HasSuffix(out.String(), "2/2 done, 0 running, 0 failed\n") {
+		t.Errorf("expected the progress summary once all jobs are done, got %q", out.String())
+	}
+	if strings.Contains(out.String(), "Job Started") {
+		t.Errorf("expected info messages not to be logged with progress, got %q", out.String())
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// configHash identifies the configuration of a job: its shell, image, ssh target, command and work dir,
+// its inputs and outputs, and the environment of the workflow and the job with its secrets.
+// It is recorded with the job's finished events so a later run can tell whether the same job has
+// succeeded recently
+func (j *Job) configHash() string {
+	h := sha256.New()
+	field := func(s string) {
+		fmt.Fprintf(h, "%d:%s\n", len(s), s)
+	}
+	field(j.shell())
+	field(j.Image)
+	field(j.sshTarget())
+	field(j.command())
+	field(j.WorkDir)
+	for _, kv := range j.configEnviron() {
+		field(kv)
+	}
+	for _, name := range j.secretNames() {
+		sum := sha256.Sum256([]byte(j.workflow.secrets[name]))
+		field("secret:" + name + "=" + hex.EncodeToString(sum[:]))
+	}
+	for _, input := range j.Inputs {
+		field("input:" + input)
+	}
+	for _, output := range j.Outputs {
+		field("output:" + output)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// prepareRecent records when the jobs with SucceededWithin set last succeeded, if a job of the
+// same configuration did less than that long ago. They are skipped when they are scheduled.
+// Jobs referencing the outputs of other jobs are never skipped, their command is not known yet
+func (w *Workflow) prepareRecent(jobs []*Job) error {
+	recent := []*Job{}
+	for _, j := range jobs {
+		j.succeededAt = time.Time{}
+		if j.SucceededWithin.Duration > 0 && !j.hasOutputRefs() {
+			recent = append(recent, j)
+		}
+	}
+	if len(recent) == 0 {
+		return nil
+	}
+	exists, err := fileExists(w.EventDBPath)
+	if err != nil || !exists {
+		return err
+	}
+	db, err := OpenEventDB(w.EventDBPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	succeeded, err := db.lastSucceeded()
+	if err != nil {
+		return err
+	}
+	for _, j := range recent {
+		if at, ok := succeeded[j.configHash()]; ok && time.Since(at) < j.SucceededWithin.Duration {
+			j.succeededAt = at
+		}
+	}
+	return nil
+}
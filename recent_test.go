@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSucceededWithin(t *testing.T) {
+	defer cleanTestData(t)
+	deployWorkflow := func(cmd string) (*Workflow, *Job, *Job) {
+		wf := testWorkflow(t, "SucceededWithin")
+		deploy := newJob(wf, []string{}, []*Job{}, []string{}, false, cmd)
+		deploy.SucceededWithin = Duration{time.Hour}
+		notify := newJob(wf, []string{}, []*Job{deploy}, []string{}, false, "true")
+		wf.AddJob(notify)
+		return wf, deploy, notify
+	}
+
+	wf, deploy, _ := deployWorkflow("echo deploy >> deploys")
+	expectZero(t, wf.Run())
+	if deploy.Status != StatusSucceeded || deploy.Attempts != 1 {
+		t.Fatalf("expected the first deploy to run, got %s after %d attempts", deploy.Status, deploy.Attempts)
+	}
+
+	wf, deploy, notify := deployWorkflow("echo deploy >> deploys")
+	expectZero(t, wf.Run())
+	if deploy.Status != StatusSkipped || deploy.Attempts != 0 {
+		t.Errorf("expected a deploy within the ttl to be skipped, got %s after %d attempts", deploy.Status, deploy.Attempts)
+	}
+	if notify.Status != StatusSucceeded {
+		t.Errorf("expected the dependent of a skipped deploy to run, got %s", notify.Status)
+	}
+
+	wf, deploy, _ = deployWorkflow("echo changed >> deploys")
+	expectZero(t, wf.Run())
+	if deploy.Attempts != 1 {
+		t.Errorf("expected a deploy with a changed configuration to run, got %d attempts", deploy.Attempts)
+	}
+
+	wf, deploy, _ = deployWorkflow("echo changed >> deploys")
+	wf.Env = map[string]string{"TARGET": "staging"}
+	expectZero(t, wf.Run())
+	if deploy.Attempts != 1 {
+		t.Errorf("expected a deploy with a changed workflow env to run, got %d attempts", deploy.Attempts)
+	}
+
+	wf, deploy, _ = deployWorkflow("echo deploy >> deploys")
+	deploy.SucceededWithin = Duration{time.Nanosecond}
+	expectZero(t, wf.Run())
+	if deploy.Status != StatusSucceeded || deploy.Attempts != 1 {
+		t.Errorf("expected a deploy after the ttl expired to run, got %s after %d attempts", deploy.Status, deploy.Attempts)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// remoteTimeout bounds fetching a workflow yaml from a URL
+const remoteTimeout = 30 * time.Second
+
+// isRemote reports whether the workflow yaml path is an http or https URL
+func isRemote(yamlPath string) bool {
+	return strings.HasPrefix(yamlPath, "http://") || strings.HasPrefix(yamlPath, "https://")
+}
+
+// fetchYaml gets the workflow yaml at url, a response other than 200 OK is an error
+func fetchYaml(url string) ([]byte, error) {
+	client := &http.Client{Timeout: remoteTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoteWorkflow(t *testing.T) {
+	defer cleanTestData(t)
+	wfDir, err := filepath.Abs(path.Join(OutputDir, "RemoteWorkflow"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/workflow.yaml" {
+			http.NotFound(rw, r)
+			return
+		}
+		rw.Write([]byte(`
+workflow_dir: ` + wfDir + `
+jobs:
+- cmd: echo remote > out.txt
+  outputs: [ out.txt ]
+`))
+	}))
+	defer server.Close()
+
+	wf, err := workflowFromYamlVars(server.URL+"/workflow.yaml", "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wf.WorkflowDir != wfDir {
+		t.Errorf("expected the local workflow dir %s, got %s", wfDir, wf.WorkflowDir)
+	}
+	expectZero(t, wf.Run())
+	got, err := ioutil.ReadFile(path.Join(wfDir, "out.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "remote\n" {
+		t.Errorf("expected the remote workflow's job to run, got %q", string(got))
+	}
+
+	_, err = workflowFromYamlVars(server.URL+"/missing.yaml", "", "", nil)
+	if err == nil {
+		t.Error("expected an error for a url that is not found")
+	}
+}
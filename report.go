@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// reportSchemaVersion is the version of the run report format, raised when a field changes meaning or is removed
+const reportSchemaVersion = 1
+
+// runReport is the summary of a finished run written to the workflow's ReportPath for CI to parse.
+// Status is the name of the exit status: success, failed, invalid, interrupted or timeout
+type runReport struct {
+	SchemaVersion   int         `json:"schema_version"`
+	RunID           string      `json:"run_id"`
+	WorkflowDir     string      `json:"workflow_dir"`
+	ExitStatus      int         `json:"exit_status"`
+	Status          string      `json:"status"`
+	StartedAt       time.Time   `json:"started_at"`
+	DurationSeconds float64     `json:"duration_seconds"`
+	Jobs            []jobReport `json:"jobs"`
+}
+
+// jobReport is the outcome of one job of the run. Failure is why the job failed the workflow,
+// one of the Failure constants, and Reason the detail of a job that did not succeed
+type jobReport struct {
+	ID              int     `json:"id"`
+	Name            string  `json:"name,omitempty"`
+	Status          string  `json:"status"`
+	Attempts        int     `json:"attempts"`
+	ExitCode        int     `json:"exit_code"`
+	Failure         string  `json:"failure,omitempty"`
+	Reason          string  `json:"reason,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	StdoutLog       string  `json:"stdout_log"`
+	StderrLog       string  `json:"stderr_log"`
+}
+
+func newRunReport(w *Workflow, exitStatus int, jobs []*Job, start time.Time) runReport {
+	failures := map[*Job]string{}
+	for _, f := range w.failedJobs.List() {
+		failures[f.Job] = f.Reason
+	}
+	report := runReport{
+		SchemaVersion:   reportSchemaVersion,
+		RunID:           w.runID,
+		WorkflowDir:     w.WorkflowDir,
+		ExitStatus:      exitStatus,
+		Status:          exitStatusNames[exitStatus],
+		StartedAt:       start,
+		DurationSeconds: time.Since(start).Seconds(),
+		Jobs:            []jobReport{},
+	}
+	for _, j := range jobs {
+		report.Jobs = append(report.Jobs, jobReport{j.ID, j.Name, j.Status, j.Attempts, j.ExitCode, failures[j],
+			j.Reason, j.Duration.Seconds(), j.StdoutLog, j.StderrLog})
+	}
+	return report
+}
+
+// writeRunReport writes the report of the run to the workflow's ReportPath
+func (w *Workflow) writeRunReport(exitStatus int, jobs []*Job, start time.Time) error {
+	b, err := json.MarshalIndent(newRunReport(w, exitStatus, jobs, start), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := w.ReportPath + ".tmp"
+	err = ioutil.WriteFile(tmp, b, w.fileMode())
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.ReportPath)
+}
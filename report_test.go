@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRunReport(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "RunReport")
+	wf.KeepGoing = true
+	ok := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	ok.Name = "ok"
+	failed := newJob(wf, []string{}, []*Job{}, []string{}, false, "exit 3")
+	skipped := newJob(wf, []string{}, []*Job{failed}, []string{}, false, "true")
+	allowed := newJob(wf, []string{}, []*Job{}, []string{}, false, "false")
+	allowed.AllowFailure = true
+	wf.AddJob(ok, skipped, allowed)
+	expectNonZero(t, wf.Run())
+
+	b, err := ioutil.ReadFile(wf.ReportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{}
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	wantKeys := []string{"duration_seconds", "exit_status", "jobs", "run_id", "schema_version", "started_at", "status", "workflow_dir"}
+	if !reflect.DeepEqual(keys, wantKeys) {
+		t.Errorf("expected report fields %v, got %v", wantKeys, keys)
+	}
+
+	var report runReport
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.SchemaVersion != reportSchemaVersion || report.ExitStatus != ExitJobsFailed || report.Status != "failed" ||
+		report.WorkflowDir != wf.WorkflowDir || report.StartedAt.IsZero() || report.RunID != wf.runID {
+		t.Errorf("unexpected report of the run %+v", report)
+	}
+	byID := map[int]jobReport{}
+	for _, j := range report.Jobs {
+		byID[j.ID] = j
+	}
+	testCases := []struct {
+		job      *Job
+		status   string
+		exitCode int
+		failure  string
+	}{
+		{ok, StatusSucceeded, 0, ""},
+		{failed, StatusFailed, 3, FailureNonzeroExit},
+		{skipped, StatusSkipped, 0, FailureSkippedDependency},
+		{allowed, StatusFailedAllowed, 1, ""},
+	}
+	if len(report.Jobs) != len(testCases) {
+		t.Fatalf("expected a report of each of the %d jobs, got %d", len(testCases), len(report.Jobs))
+	}
+	for _, tc := range testCases {
+		got := byID[tc.job.ID]
+		if got.Status != tc.status || got.ExitCode != tc.exitCode || got.Failure != tc.failure ||
+			got.Name != tc.job.Name || got.Reason != tc.job.Reason {
+			t.Errorf("expected job_id:%d %s exiting %d with failure '%s', got %+v", tc.job.ID, tc.status, tc.exitCode, tc.failure, got)
+		}
+		if got.StdoutLog != tc.job.StdoutLog || got.StderrLog != tc.job.StderrLog {
+			t.Errorf("expected job_id:%d to report its logs, got %s and %s", tc.job.ID, got.StdoutLog, got.StderrLog)
+		}
+		if tc.status != StatusSkipped && got.DurationSeconds <= 0 {
+			t.Errorf("expected job_id:%d to report its duration", tc.job.ID)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// resourceLimitsSupported reports whether job resource limits are enforced on this platform
+var resourceLimitsSupported = runtime.GOOS == "linux"
+
+// Resources limits the memory and cpu time of a job's processes.
+// Zero values are unlimited
+type Resources struct {
+	MemoryMB   int `json:"memory_mb,omitempty"`
+	CPUSeconds int `json:"cpu_seconds,omitempty"`
+}
+
+// templateResourceLimits sets the rlimits for the job script and its children.
+// The cpu limit is soft so exceeding it delivers SIGXCPU rather than SIGKILL
+func templateResourceLimits(r *Resources) string {
+	if r == nil || !resourceLimitsSupported {
+		return ""
+	}
+	lines := []string{}
+	if r.MemoryMB > 0 {
+		lines = append(lines, fmt.Sprintf("ulimit -v %d", r.MemoryMB*1024))
+	}
+	if r.CPUSeconds > 0 {
+		lines = append(lines, fmt.Sprintf("ulimit -S -t %d", r.CPUSeconds))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// resourceLimitError is returned when a job with resource limits fails
+type resourceLimitError struct {
+	error
+}
+
+// oomMessages are lowercased messages on stderr showing a command ran out of memory
+var oomMessages = []string{"cannot allocate", "out of memory", "enomem", "memory exhausted", "memoryerror", "bad_alloc"}
+
+// stderrTailSize is how much of the end of an attempt's stderr is kept to look for oomMessages
+const stderrTailSize = 4096
+
+// tailBuffer keeps the last limit bytes written to it
+type tailBuffer struct {
+	buf   []byte
+	limit int
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.limit {
+		t.buf = t.buf[len(t.buf)-t.limit:]
+	}
+	return len(p), nil
+}
+
+// checkResourceLimits wraps the error of a failed command run under resource limits
+// so the reason for the failure names the limit, when there is evidence the command hit it.
+// stderrTail is the end of the attempt's stderr
+func (j *Job) checkResourceLimits(err error, stderrTail string) error {
+	r := j.Resources
+	if r == nil || !resourceLimitsSupported {
+		return err
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	if r.CPUSeconds > 0 && killedBySIGXCPU(exitErr) {
+		return &resourceLimitError{fmt.Errorf("cpu_seconds limit of %d exceeded", r.CPUSeconds)}
+	}
+	if r.MemoryMB > 0 && outOfMemory(stderrTail) {
+		return &resourceLimitError{fmt.Errorf("%v: memory_mb limit of %d may have been exceeded", err, r.MemoryMB)}
+	}
+	return err
+}
+
+// outOfMemory reports whether the script, or a command it ran, wrote a message on stderr about failing
+// to allocate memory. Under the address space limit allocations fail rather than the process being
+// killed, so signals and exit codes are no evidence of running out of memory
+func outOfMemory(stderrTail string) bool {
+	stderrTail = strings.ToLower(stderrTail)
+	for _, m := range oomMessages {
+		if strings.Contains(stderrTail, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// killedBySIGXCPU reports whether the script, or the command it ran, was killed for exceeding its cpu time
+func killedBySIGXCPU(exitErr *exec.ExitError) bool {
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() && status.Signal() == syscall.SIGXCPU {
+		return true
+	}
+	return exitErr.ExitCode() == 128+int(syscall.SIGXCPU)
+}
+
+func isResourceLimitError(err error) bool {
+	_, ok := err.(*resourceLimitError)
+	return ok
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// structureHash identifies the structure of a workflow from its sorted jobs:
+// their ids, commands and dependencies. A resumed workflow must have the
+// same structure as the run it resumes
+func structureHash(jobs []*Job) string {
+	h := sha256.New()
+	for _, j := range jobs {
+		depIDs := []int{}
+		for _, d := range j.Dependencies {
+			depIDs = append(depIDs, d.ID)
+		}
+		fmt.Fprintf(h, "%d\x00%s\x00%v\n", j.ID, j.Cmd, depIDs)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// prepareResume marks the jobs that succeeded in previous runs so they are not run again.
+// Jobs with Inputs or Outputs are run again unless their outputs are newer than their
+// inputs and were written since the job last started.
+// An error is returned if the workflow has changed since the last run
+func (w *Workflow) prepareResume(jobs []*Job, hash string) error {
+	exists, err := fileExists(w.EventDBPath)
+	if err != nil || !exists {
+		return err
+	}
+	db, err := OpenEventDB(w.EventDBPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	lastHash, err := db.lastWorkflowHash()
+	if err != nil {
+		return err
+	}
+	if lastHash != "" && lastHash != hash {
+		return fmt.Errorf("cannot resume: workflow jobs changed since the last run")
+	}
+	succeeded, err := db.SucceededJobs()
+	if err != nil {
+		return err
+	}
+	lastStarted, err := db.lastStarted()
+	if err != nil {
+		return err
+	}
+	previous := map[int]bool{}
+	for _, id := range succeeded {
+		previous[id] = true
+	}
+	for _, j := range jobs {
+		j.succeededPreviously = previous[j.ID]
+		if !j.succeededPreviously {
+			continue
+		}
+		if len(j.Inputs) > 0 || len(j.Outputs) > 0 {
+			stale, err := j.staleOutput(lastStarted[j.ID])
+			if err != nil {
+				return err
+			}
+			if stale != "" {
+				j.succeededPreviously = false
+				j.infof("Resuming: rerunning job, %s", stale)
+				continue
+			}
+		}
+		j.infof("Resuming: job succeeded in a previous run")
+	}
+	return nil
+}
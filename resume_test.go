@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestResume(t *testing.T) {
+	defer cleanTestData(t)
+	resumeWorkflow := func(checkCmd string) (*Workflow, *Job, *Job) {
+		wf := testWorkflow(t, "Resume")
+		a := newJob(wf, []string{}, []*Job{}, []string{}, false, "echo a >> a.count")
+		b := newJob(wf, []string{}, []*Job{a}, []string{}, false, checkCmd)
+		wf.AddJob(b)
+		return wf, a, b
+	}
+
+	wf, _, _ := resumeWorkflow("[[ -f fixed ]]")
+	if status := wf.Run(); status != ExitJobsFailed {
+		t.Fatalf("expected exit %d, wf exited %d", ExitJobsFailed, status)
+	}
+	err := ioutil.WriteFile(wf.pathToWDir("fixed"), []byte{}, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed, _, _ := resumeWorkflow("[[ -f fixed ]] && true")
+	changed.Resume = true
+	if status := changed.Run(); status != ExitInvalidWorkflow {
+		t.Errorf("expected resuming a changed workflow to exit %d, wf exited %d", ExitInvalidWorkflow, status)
+	}
+
+	wf, a, b := resumeWorkflow("[[ -f fixed ]]")
+	wf.Resume = true
+	expectZero(t, wf.Run())
+	if a.Status != StatusSucceeded || b.Status != StatusSucceeded {
+		t.Errorf("expected both jobs to succeed, got %s and %s", a.Status, b.Status)
+	}
+	count, err := ioutil.ReadFile(wf.pathToWDir("a.count"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(count) != "a\n" {
+		t.Errorf("expected the succeeded job to run once, a.count: %q", string(count))
+	}
+	events, err := readEvents(wf.EventDBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := map[int]int{}
+	for _, e := range events {
+		if e.Type == EventStarted {
+			started[e.JobID]++
+		}
+	}
+	if started[a.ID] != 1 || started[b.ID] != 2 {
+		t.Errorf("expected job_id:%d to start once and job_id:%d twice, got %v", a.ID, b.ID, started)
+	}
+	if _, err := os.Stat(wf.WFJsonPath); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestResumeInputs(t *testing.T) {
+	defer cleanTestData(t)
+	incrementalWorkflow := func() (*Workflow, *Job) {
+		wf := testWorkflow(t, "ResumeInputs")
+		wf.Resume = true
+		j := newJob(wf, []string{}, []*Job{}, []string{"out.txt"}, false, "cat in.txt > out.txt; echo run >> runs")
+		j.Inputs = []string{"in.txt"}
+		wf.AddJob(j)
+		return wf, j
+	}
+	runs := func(wf *Workflow) string {
+		b, err := ioutil.ReadFile(wf.pathToWDir("runs"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	wf, _ := incrementalWorkflow()
+	inPath := wf.pathToWDir("in.txt")
+	if err := ioutil.WriteFile(inPath, []byte("v1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectZero(t, wf.Run())
+
+	wf, j := incrementalWorkflow()
+	expectZero(t, wf.Run())
+	if got := runs(wf); got != "run\n" || j.Attempts != 0 {
+		t.Errorf("expected job with outputs newer than its inputs not to rerun, runs: %q", got)
+	}
+
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(inPath, future, future); err != nil {
+		t.Fatal(err)
+	}
+	wf, j = incrementalWorkflow()
+	expectZero(t, wf.Run())
+	if got := runs(wf); got != "run\nrun\n" || j.Attempts != 1 {
+		t.Errorf("expected job with an input newer than its outputs to rerun, runs: %q", got)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Retry backoff modes. A fixed backoff waits RetryDelay between attempts, an exponential one
+// doubles the wait after each attempt up to RetryMaxDelay
+const (
+	RetryBackoffFixed       = "fixed"
+	RetryBackoffExponential = "exponential"
+)
+
+// Restart policies of a job. With never, the default, a job is only retried as set by Retries.
+// With on-failure a failed job is also retried up to MaxRestarts times, and with always it is
+// restarted whether its attempt failed or succeeded. Its dependents wait for its last attempt
+const (
+	RestartNever     = "never"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+// defaultMaxRetriesCap bounds the Retries of jobs when the workflow has no MaxRetriesCap
+const defaultMaxRetriesCap = 100
+
+// retries returns how many times the job is retried, its Retries, or MaxRestarts if it has a
+// Restart policy and more restarts, bounded by the workflow's MaxRetriesCap
+func (j *Job) retries() int {
+	maxRetries := j.workflow.MaxRetriesCap
+	if maxRetries <= 0 {
+		maxRetries = defaultMaxRetriesCap
+	}
+	retries := j.Retries
+	if j.Restart == RestartOnFailure || j.Restart == RestartAlways {
+		if j.MaxRestarts > retries {
+			retries = j.MaxRestarts
+		}
+	}
+	if retries > maxRetries {
+		return maxRetries
+	}
+	return retries
+}
+
+// restartsOnSuccess reports whether the job is run again after its last attempt succeeded,
+// with Restart always until it has been restarted MaxRestarts times
+func (j *Job) restartsOnSuccess() bool {
+	return j.Restart == RestartAlways && j.Attempts <= j.retries()
+}
+
+func validRestart(restart string) bool {
+	return restart == "" || restart == RestartNever || restart == RestartOnFailure || restart == RestartAlways
+}
+
+// retryable reports whether the job's last attempt may be retried, any failure unless
+// RetryExitCodes lists the exit codes to retry
+func (j *Job) retryable() bool {
+	if len(j.RetryExitCodes) == 0 {
+		return true
+	}
+	for _, code := range j.RetryExitCodes {
+		if j.ExitCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+func validRetryBackoff(backoff string) bool {
+	return backoff == "" || backoff == RetryBackoffFixed || backoff == RetryBackoffExponential
+}
+
+// retryDelay returns how long to wait before retrying the job after the given failed attempt.
+// Fixed backoff always waits RetryDelay, exponential backoff waits RetryDelay * 2^(attempt-1).
+// Delays are capped at a nonzero RetryMaxDelay, and with RetryJitter a random
+// amount of up to half the delay is taken off so retries of many jobs spread out
+func (j *Job) retryDelay(attempt int) time.Duration {
+	delay := j.RetryDelay.Duration
+	if j.RetryBackoff == RetryBackoffExponential {
+		for i := 1; i < attempt; i++ {
+			delay *= 2
+			if j.RetryMaxDelay.Duration > 0 && delay >= j.RetryMaxDelay.Duration {
+				break
+			}
+		}
+	}
+	if j.RetryMaxDelay.Duration > 0 && delay > j.RetryMaxDelay.Duration {
+		delay = j.RetryMaxDelay.Duration
+	}
+	if j.RetryJitter && delay > 1 {
+		delay -= time.Duration(j.workflow.random(int64(delay / 2)))
+	}
+	return delay
+}
+
+// random returns a random number in [0, n) from the workflow's source
+func (w *Workflow) random(n int64) int64 {
+	if n <= 0 {
+		return 0
+	}
+	if w.randInt63n != nil {
+		return w.randInt63n(n)
+	}
+	return rand.Int63n(n)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	testCases := []struct {
+		name     string
+		backoff  string
+		maxDelay time.Duration
+		jitter   bool
+		want     []time.Duration
+	}{
+		{"Fixed", RetryBackoffFixed, 0, false, []time.Duration{time.Second, time.Second, time.Second}},
+		{"DefaultFixed", "", 0, false, []time.Duration{time.Second, time.Second, time.Second}},
+		{"Exponential", RetryBackoffExponential, 0, false,
+			[]time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}},
+		{"ExponentialCapped", RetryBackoffExponential, 5 * time.Second, false,
+			[]time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}},
+		// the injected source always takes off the most jitter allowed, just under half the delay
+		{"ExponentialJitter", RetryBackoffExponential, 0, true,
+			[]time.Duration{500*time.Millisecond + 1, time.Second + 1, 2*time.Second + 1}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wf := &Workflow{randInt63n: func(n int64) int64 { return n - 1 }}
+			j := &Job{workflow: wf, RetryDelay: Duration{time.Second}, RetryBackoff: tc.backoff,
+				RetryMaxDelay: Duration{tc.maxDelay}, RetryJitter: tc.jitter}
+			got := []time.Duration{}
+			for attempt := 1; attempt <= len(tc.want); attempt++ {
+				got = append(got, j.retryDelay(attempt))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected delays %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "RetryBackoff")
+	waits := []time.Duration{}
+	wf.after = func(d time.Duration) <-chan time.Time {
+		waits = append(waits, d)
+		c := make(chan time.Time, 1)
+		c <- time.Now()
+		return c
+	}
+	j := newJob(wf, []string{}, []*Job{}, []string{}, false, "false")
+	j.Retries = 4
+	j.RetryDelay = Duration{time.Minute}
+	j.RetryBackoff = RetryBackoffExponential
+	j.RetryMaxDelay = Duration{3 * time.Minute}
+	wf.AddJob(j)
+	expectNonZero(t, wf.Run())
+
+	want := []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute}
+	if !reflect.DeepEqual(waits, want) {
+		t.Errorf("expected to wait %v between attempts, waited %v", want, waits)
+	}
+	if j.Attempts != 5 {
+		t.Errorf("expected 5 attempts, got %d", j.Attempts)
+	}
+}
+
+func TestRetriesCap(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cap     int
+		retries int
+		want    int
+	}{
+		{"BelowCap", 5, 3, 3},
+		{"AboveCap", 5, 10, 5},
+		{"DefaultCap", 0, 1000, defaultMaxRetriesCap},
+		{"BelowDefaultCap", 0, 7, 7},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			j := &Job{workflow: &Workflow{MaxRetriesCap: tc.cap}, Retries: tc.retries}
+			if got := j.retries(); got != tc.want {
+				t.Errorf("expected %d retries, got %d", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRetryExitCodes(t *testing.T) {
+	defer cleanTestData(t)
+	testCases := []struct {
+		name     string
+		codes    []int
+		exit     int
+		attempts int
+	}{
+		{"Listed", []int{2, 75}, 75, 3},
+		{"Unlisted", []int{2, 75}, 1, 1},
+		{"Any", nil, 1, 3},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wf := testWorkflow(t, "RetryExitCodes"+tc.name)
+			j := newJob(wf, []string{}, []*Job{}, []string{}, false, fmt.Sprintf("exit %d", tc.exit))
+			j.Retries = 2
+			j.RetryExitCodes = tc.codes
+			wf.AddJob(j)
+			expectNonZero(t, wf.Run())
+			if j.Attempts != tc.attempts || j.ExitCode != tc.exit {
+				t.Errorf("expected %d attempts exiting %d, got %d exiting %d", tc.attempts, tc.exit, j.Attempts, j.ExitCode)
+			}
+		})
+	}
+}
+
+func TestRestart(t *testing.T) {
+	defer cleanTestData(t)
+	testCases := []struct {
+		name     string
+		restart  string
+		cmd      string
+		attempts int
+		status   string
+	}{
+		{"Never", RestartNever, "exit 1", 1, StatusFailed},
+		{"OnFailure", RestartOnFailure, `[ "$(wc -l < runs.txt)" -ge 2 ]`, 2, StatusSucceeded},
+		{"OnFailureSucceeded", RestartOnFailure, "true", 1, StatusSucceeded},
+		{"Always", RestartAlways, "true", 4, StatusSucceeded},
+		{"AlwaysLastFailed", RestartAlways, `[ "$(wc -l < runs.txt)" -lt 4 ]`, 4, StatusFailed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wf := testWorkflow(t, "Restart"+tc.name)
+			wf.after = func(d time.Duration) <-chan time.Time {
+				c := make(chan time.Time, 1)
+				c <- time.Now()
+				return c
+			}
+			j := newJob(wf, []string{}, []*Job{}, []string{}, false, "echo run >> runs.txt; "+tc.cmd)
+			j.Restart = tc.restart
+			if tc.restart != RestartNever {
+				j.MaxRestarts = 3
+			}
+			dependent := newJob(wf, []string{}, []*Job{j}, []string{}, false, "wc -l < runs.txt > seen.txt")
+			wf.AddJob(dependent)
+			code := wf.Run()
+			if j.Attempts != tc.attempts || j.Status != tc.status {
+				t.Errorf("expected %d attempts and status %s, got %d and %s", tc.attempts, tc.status, j.Attempts, j.Status)
+			}
+			if tc.status != StatusSucceeded {
+				expectNonZero(t, code)
+				return
+			}
+			expectZero(t, code)
+			b, err := ioutil.ReadFile(wf.pathToWDir("seen.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(string(b)); got != fmt.Sprint(tc.attempts) {
+				t.Errorf("expected the dependent to run after all %d runs, it saw %s", tc.attempts, got)
+			}
+		})
+	}
+}
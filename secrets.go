@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// redacted replaces the value of a secret wherever gflow logs or serializes it
+const redacted = "***"
+
+// readSecretsFile reads NAME=value lines, skipping blank lines and lines starting with #
+func readSecretsFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	secrets := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("%s:%d: expected NAME=value", path, n)
+		}
+		secrets[parts[0]] = parts[1]
+	}
+	return secrets, scanner.Err()
+}
+
+// loadSecrets looks up the value of every secret the workflow and its jobs reference,
+// first in the SecretsFile, relative to the workflow dir, and then in the environment.
+// Once loaded, the values are redacted from the workflow log
+func (w *Workflow) loadSecrets() error {
+	fromFile := map[string]string{}
+	if w.SecretsFile != "" {
+		secretsPath := w.SecretsFile
+		if !filepath.IsAbs(secretsPath) {
+			secretsPath = w.pathToWDir(secretsPath)
+		}
+		var err error
+		fromFile, err = readSecretsFile(secretsPath)
+		if err != nil {
+			return fmt.Errorf("could not read secrets file: %v", err)
+		}
+	}
+	names := append([]string{}, w.Secrets...)
+	for _, j := range w.allJobs() {
+		names = append(names, j.Secrets...)
+	}
+	w.secrets = map[string]string{}
+	for _, name := range names {
+		if v, ok := fromFile[name]; ok {
+			w.secrets[name] = v
+		} else if v, ok := os.LookupEnv(name); ok {
+			w.secrets[name] = v
+		} else {
+			return fmt.Errorf("secret %s is not set in the secrets file or environment", name)
+		}
+	}
+	w.logger.redact(w.secretValues())
+	return nil
+}
+
+func (w *Workflow) secretValues() []string {
+	values := []string{}
+	for _, v := range w.secrets {
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+	// longest first, so a secret containing another is redacted whole
+	sort.Slice(values, func(a, b int) bool { return len(values[a]) > len(values[b]) })
+	return values
+}
+
+// redact replaces the value of every loaded secret in s
+func (w *Workflow) redact(s string) string {
+	for _, v := range w.secretValues() {
+		s = strings.Replace(s, v, redacted, -1)
+	}
+	return s
+}
+
+// secretNames returns the secrets set in the job's environment, the workflow Secrets and the job's own
+func (j *Job) secretNames() []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, name := range append(append([]string{}, j.workflow.Secrets...), j.Secrets...) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// secretEnviron returns the NAME=value of each of the job's secrets
+func (j *Job) secretEnviron() []string {
+	env := []string{}
+	for _, name := range j.secretNames() {
+		env = append(env, name+"="+j.workflow.secrets[name])
+	}
+	return env
+}
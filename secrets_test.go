@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestSecrets(t *testing.T) {
+	defer cleanTestData(t)
+	os.Setenv("GFLOW_TEST_ENV_TOKEN", "env-secret-value")
+	defer os.Unsetenv("GFLOW_TEST_ENV_TOKEN")
+	yamlPath := writeTestYaml(t, "Secrets", `
+workflow_dir: .
+secrets_file: secrets.env
+secrets: [API_TOKEN]
+jobs:
+- name: use
+  secrets: [GFLOW_TEST_ENV_TOKEN]
+  cmd: '[[ $API_TOKEN == file-secret-value && $GFLOW_TEST_ENV_TOKEN == env-secret-value ]] && echo received > received.txt'
+- name: skipped
+  when: env:GFLOW_TEST_ENV_TOKEN != "env-secret-value"
+  cmd: echo never
+`)
+	secrets := "# tokens\nAPI_TOKEN=file-secret-value\n\nUNUSED=other\n"
+	err := ioutil.WriteFile(path.Join(path.Dir(yamlPath), "secrets.env"), []byte(secrets), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wf, err := workflowFromYaml(yamlPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	wf.logger = newLogger(out, LogFormatText)
+	expectZero(t, wf.Run())
+
+	if _, err := os.Stat(wf.pathToWDir("received.txt")); err != nil {
+		t.Errorf("expected the job to receive its secrets: %v", err)
+	}
+	wfJSON, err := ioutil.ReadFile(wf.WFJsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, text := range map[string]string{"log": out.String(), "wf.json": string(wfJSON)} {
+		for _, secret := range []string{"file-secret-value", "env-secret-value"} {
+			if strings.Contains(text, secret) {
+				t.Errorf("expected secret %q to be redacted from the %s, got:\n%s", secret, name, text)
+			}
+		}
+		if !strings.Contains(text, redacted) {
+			t.Errorf("expected the skipped job's condition to be redacted in the %s, got:\n%s", name, text)
+		}
+	}
+}
+
+func TestMissingSecret(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "MissingSecret")
+	j := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	j.Secrets = []string{"GFLOW_TEST_NOT_SET"}
+	wf.AddJob(j)
+	if status := wf.Run(); status != ExitInvalidWorkflow {
+		t.Errorf("expected exit status %d with a missing secret, got %d", ExitInvalidWorkflow, status)
+	}
+	if j.Attempts != 0 {
+		t.Errorf("expected no job to run with a missing secret, got %d attempts", j.Attempts)
+	}
+}
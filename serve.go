@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// jobState is a snapshot of a job's progress served by the jobs api
+type jobState struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name,omitempty"`
+	Status     string     `json:"status"`
+	Attempts   int        `json:"attempts"`
+	ExitCode   int        `json:"exit_code"`
+	Reason     string     `json:"reason,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Duration   Duration   `json:"duration"`
+}
+
+// jobStates holds the latest snapshot of each job. Jobs update their own snapshot
+// as they progress so it can be read while the workflow runs.
+// With a progress, its summary is rendered on every update
+type jobStates struct {
+	mutex    *sync.Mutex
+	states   map[int]jobState
+	progress *progress
+}
+
+func newJobStates(jobs []*Job, p *progress) *jobStates {
+	s := &jobStates{mutex: &sync.Mutex{}, states: map[int]jobState{}}
+	for _, j := range jobs {
+		s.update(j, j.Status)
+	}
+	s.progress = p
+	return s
+}
+
+// update records the job's current state with status, called from the job's goroutine
+func (s *jobStates) update(j *Job, status string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.states[j.ID] = jobState{j.ID, j.Name, status, j.Attempts, j.ExitCode, j.Reason,
+		j.StartedAt, j.FinishedAt, j.Duration}
+	if s.progress != nil {
+		s.progress.render(s.states)
+	}
+}
+
+// list returns the snapshot of every job in ID order
+func (s *jobStates) list() []jobState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	states := []jobState{}
+	for _, state := range s.states {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(a, b int) bool { return states[a].ID < states[b].ID })
+	return states
+}
+
+func (s *jobStates) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(struct {
+		Jobs []jobState `json:"jobs"`
+	}{s.list()})
+}
+
+// serveAPI serves the live state of the workflow's jobs at /api/jobs on ServeAddr,
+// returning a func shutting the server down
+func (w *Workflow) serveAPI() (func(), error) {
+	listener, err := net.Listen("tcp", w.ServeAddr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/api/jobs", w.states)
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	w.logger.Infof(0, "Serving job states at http://%s/api/jobs", listener.Addr())
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServeJobStates(t *testing.T) {
+	defer cleanTestData(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	wf := testWorkflow(t, "ServeJobStates")
+	wf.ServeAddr = addr
+	release := wf.pathToWDir("release")
+	quick := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	quick.Name = "quick"
+	slow := newJob(wf, []string{}, []*Job{quick}, []string{}, false, "while [[ ! -f "+release+" ]]; do sleep 0.01; done")
+	after := newJob(wf, []string{}, []*Job{slow}, []string{}, false, "true")
+	wf.AddJob(after)
+
+	status := make(chan int)
+	go func() { status <- wf.Run() }()
+
+	get := func() (map[int]jobState, error) {
+		resp, err := http.Get("http://" + addr + "/api/jobs")
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		var body struct {
+			Jobs []jobState `json:"jobs"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		states := map[int]jobState{}
+		for _, s := range body.Jobs {
+			states[s.ID] = s
+		}
+		return states, err
+	}
+	var states map[int]jobState
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		states, _ = get()
+		if states[slow.ID].Status == StatusRunning {
+			break
+		}
+	}
+	want := map[int]string{quick.ID: StatusSucceeded, slow.ID: StatusRunning, after.ID: StatusPending}
+	for id, wantStatus := range want {
+		if states[id].Status != wantStatus {
+			t.Errorf("expected job %d to be %s mid-run, got %+v", id, wantStatus, states[id])
+		}
+	}
+	if states[quick.ID].Name != "quick" || states[quick.ID].Attempts != 1 || states[quick.ID].FinishedAt == nil {
+		t.Errorf("expected the finished job's name, attempts and finish time, got %+v", states[quick.ID])
+	}
+
+	if err := ioutil.WriteFile(release, []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectZero(t, <-status)
+	if _, err := get(); err == nil {
+		t.Error("expected the server to shut down once the workflow finished")
+	}
+	for _, s := range wf.states.list() {
+		if s.Status != StatusSucceeded {
+			t.Errorf("expected every job to end succeeded, got %+v", s)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// sinceFlag is a command line flag of a cutoff time, given as a duration before now such as 24h
+// or as an RFC 3339 timestamp or date. Unset it is the zero time
+type sinceFlag time.Time
+
+func (s *sinceFlag) String() string {
+	if s == nil || time.Time(*s).IsZero() {
+		return ""
+	}
+	return time.Time(*s).Format(time.RFC3339)
+}
+
+func (s *sinceFlag) Set(v string) error {
+	cutoff, err := parseSince(v, time.Now())
+	if err != nil {
+		return err
+	}
+	*s = sinceFlag(cutoff)
+	return nil
+}
+
+// parseSince parses a cutoff time given as a duration before now or as an RFC 3339 timestamp or date
+func parseSince(v string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(v); err == nil {
+		if d < 0 {
+			return time.Time{}, fmt.Errorf("negative duration '%s'", v)
+		}
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("expected a duration such as 24h or a timestamp such as 2006-01-02T15:04:05Z, got '%s'", v)
+}
+
+// eventsSince returns the events recorded at or after since, every event when since is zero
+func eventsSince(events []Event, since time.Time) []Event {
+	if since.IsZero() {
+		return events
+	}
+	recent := []Event{}
+	for _, e := range events {
+		if !e.Time.Before(since) {
+			recent = append(recent, e)
+		}
+	}
+	return recent
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2018, 2, 5, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name  string
+		value string
+		want  time.Time
+		err   bool
+	}{
+		{"Duration", "90m", now.Add(-90 * time.Minute), false},
+		{"Timestamp", "2018-02-05T07:49:50Z", time.Date(2018, 2, 5, 7, 49, 50, 0, time.UTC), false},
+		{"Date", "2018-02-01", time.Date(2018, 2, 1, 0, 0, 0, 0, time.Local), false},
+		{"NegativeDuration", "-1h", time.Time{}, true},
+		{"Invalid", "yesterday", time.Time{}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseSince(tc.value, now)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if !got.Equal(tc.want) {
+				t.Errorf("expected cutoff %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// slotQueue bounds how many jobs execute at once. When a slot frees up it is given
+// to the waiting job with the highest Priority, ties going to the lowest ID
+type slotQueue struct {
+	mutex   *sync.Mutex
+	free    int
+	waiting []*slotWaiter
+}
+
+type slotWaiter struct {
+	j     *Job
+	ready chan struct{}
+}
+
+func newSlotQueue(slots int) *slotQueue {
+	return &slotQueue{mutex: &sync.Mutex{}, free: slots}
+}
+
+// newLocks returns a queue of a single slot for each Lock of the jobs,
+// so that only one job holding a lock executes at a time
+func newLocks(jobs []*Job) map[string]*slotQueue {
+	locks := map[string]*slotQueue{}
+	for _, j := range jobs {
+		if j.Lock != "" && locks[j.Lock] == nil {
+			locks[j.Lock] = newSlotQueue(1)
+		}
+	}
+	return locks
+}
+
+// acquire blocks until j is given a slot, returning a func releasing it, or until ctx is cancelled
+func (q *slotQueue) acquire(ctx context.Context, j *Job) (func(), error) {
+	q.mutex.Lock()
+	if q.free > 0 && len(q.waiting) == 0 {
+		q.free--
+		q.mutex.Unlock()
+		return q.release, nil
+	}
+	waiter := &slotWaiter{j, make(chan struct{})}
+	q.waiting = append(q.waiting, waiter)
+	sort.SliceStable(q.waiting, func(a, b int) bool {
+		wa, wb := q.waiting[a].j, q.waiting[b].j
+		if wa.Priority != wb.Priority {
+			return wa.Priority > wb.Priority
+		}
+		return wa.ID < wb.ID
+	})
+	q.mutex.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return q.release, nil
+	case <-ctx.Done():
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+		for i, w := range q.waiting {
+			if w == waiter {
+				q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+				return nil, ctx.Err()
+			}
+		}
+		// given a slot while being cancelled, pass it on
+		q.releaseLocked()
+		return nil, ctx.Err()
+	}
+}
+
+func (q *slotQueue) release() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.releaseLocked()
+}
+
+func (q *slotQueue) releaseLocked() {
+	if len(q.waiting) == 0 {
+		q.free++
+		return
+	}
+	next := q.waiting[0]
+	q.waiting = q.waiting[1:]
+	close(next.ready)
+}
+
+// numWaiting returns how many jobs are waiting for a slot
+func (q *slotQueue) numWaiting() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.waiting)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedExecutor blocks the first job it runs until gate is closed, handing the workflow's
+// slot queue to the test once that job holds its slot
+type gatedExecutor struct {
+	mutex *sync.Mutex
+	ran   []*Job
+	slots chan *slotQueue
+	gate  chan struct{}
+}
+
+func (e *gatedExecutor) Run(ctx context.Context, j *Job, stdout, stderr io.Writer) (int, error) {
+	e.mutex.Lock()
+	e.ran = append(e.ran, j)
+	first := len(e.ran) == 1
+	e.mutex.Unlock()
+	if first {
+		e.slots <- j.workflow.slots
+		<-e.gate
+	}
+	return 0, nil
+}
+
+func TestPriorities(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "Priorities")
+	wf.MaxParallel = 1
+	jobs := []*Job{}
+	for _, priority := range []int{2, 0, 5, 1} {
+		j := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+		j.Priority = priority
+		jobs = append(jobs, j)
+	}
+	wf.AddJob(jobs...)
+	executor := &gatedExecutor{mutex: &sync.Mutex{}, slots: make(chan *slotQueue), gate: make(chan struct{})}
+	wf.Executor = executor
+
+	status := make(chan int)
+	go func() { status <- wf.Run() }()
+	slots := <-executor.slots
+	for deadline := time.Now().Add(5 * time.Second); slots.numWaiting() < 3 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if slots.numWaiting() != 3 {
+		t.Fatalf("expected the other 3 jobs to wait for the slot, %d waiting", slots.numWaiting())
+	}
+	close(executor.gate)
+	expectZero(t, <-status)
+
+	priorities := []int{}
+	for _, j := range executor.ran[1:] {
+		priorities = append(priorities, j.Priority)
+	}
+	for i := 1; i < len(priorities); i++ {
+		if priorities[i] > priorities[i-1] {
+			t.Errorf("expected waiting jobs to run by descending priority, ran priorities %v", priorities)
+		}
+	}
+}
+
+func TestSlotQueueTies(t *testing.T) {
+	q := newSlotQueue(1)
+	release, err := q.acquire(context.Background(), &Job{ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := make(chan int, 3)
+	for i, j := range []*Job{{ID: 4}, {ID: 2, Priority: -1}, {ID: 3}} {
+		j := j
+		go func() {
+			release, _ := q.acquire(context.Background(), j)
+			order <- j.ID
+			release()
+		}()
+		for q.numWaiting() < i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := q.acquire(ctx, &Job{ID: 5, Priority: 10}); err == nil {
+		t.Error("expected acquiring a slot with a cancelled context to fail")
+	}
+	release()
+	got := []int{<-order, <-order, <-order}
+	if want := []int{3, 4, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected equal priorities to run by id, then lower priorities, got %v", got)
+	}
+}
+
+// lockExecutor counts the jobs of each lock executing at once, the job of lock "other"
+// runs until it sees a job of lock "db" executing
+type lockExecutor struct {
+	mutex      *sync.Mutex
+	running    map[string]int
+	maxRunning map[string]int
+	overlapped bool
+}
+
+func (e *lockExecutor) Run(ctx context.Context, j *Job, stdout, stderr io.Writer) (int, error) {
+	e.mutex.Lock()
+	e.running[j.Lock]++
+	if e.running[j.Lock] > e.maxRunning[j.Lock] {
+		e.maxRunning[j.Lock] = e.running[j.Lock]
+	}
+	e.mutex.Unlock()
+	for deadline := time.Now().Add(5 * time.Second); j.Lock == "other" && time.Now().Before(deadline); {
+		e.mutex.Lock()
+		e.overlapped = e.running["db"] > 0
+		e.mutex.Unlock()
+		if e.overlapped {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if j.Lock == "db" {
+		time.Sleep(50 * time.Millisecond)
+	}
+	e.mutex.Lock()
+	e.running[j.Lock]--
+	e.mutex.Unlock()
+	return 0, nil
+}
+
+func TestLocks(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "Locks")
+	for _, lock := range []string{"db", "db", "other", "db"} {
+		j := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+		j.Lock = lock
+		wf.AddJob(j)
+	}
+	executor := &lockExecutor{mutex: &sync.Mutex{}, running: map[string]int{}, maxRunning: map[string]int{}}
+	wf.Executor = executor
+	expectZero(t, wf.Run())
+
+	if executor.maxRunning["db"] != 1 {
+		t.Errorf("expected the jobs sharing a lock never to overlap, %d ran at once", executor.maxRunning["db"])
+	}
+	if !executor.overlapped {
+		t.Error("expected the job with a different lock to run while a job of the shared lock ran")
+	}
+}
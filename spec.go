@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// SpecError is a problem with a field of a workflow spec
+type SpecError struct {
+	Field   string
+	Problem string
+}
+
+func (e SpecError) Error() string {
+	return e.Field + ": " + e.Problem
+}
+
+// SpecErrors lists every problem found in a workflow spec
+type SpecErrors []SpecError
+
+func (e SpecErrors) Error() string {
+	problems := []string{}
+	for _, err := range e {
+		problems = append(problems, err.Error())
+	}
+	return strings.Join(problems, "\n")
+}
+
+// ValidateWorkflowSpec checks a workflow yaml before it is loaded: the
+// workflow_dir is set, every job has a cmd, job names are unique, depends_on
+// names a job in the spec, and dependencies that only give an id refer to a job
+// declared elsewhere in the spec. All problems found are returned as SpecErrors
+func ValidateWorkflowSpec(yamlBytes []byte) error {
+	var spec Workflow
+	err := yaml.Unmarshal(yamlBytes, &spec)
+	if err != nil {
+		return fmt.Errorf("error unmarshalling workflow: %v", err)
+	}
+	err = includeJobs(&spec, ".")
+	if err != nil {
+		return err
+	}
+	errs := expandMatrix(&spec)
+	errs = append(errs, substituteVars(&spec, nil)...)
+	errs = append(errs, validateSpec(&spec)...)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateSpec(spec *Workflow) SpecErrors {
+	errs := SpecErrors{}
+	if spec.WorkflowDir == "" {
+		errs = append(errs, SpecError{"workflow_dir", "required"})
+	}
+	if spec.KeepGoing && spec.FailFast {
+		errs = append(errs, SpecError{"fail_fast", "cannot be set with keep_going"})
+	}
+	switch {
+	case spec.MaxFailures < 0:
+		errs = append(errs, SpecError{"max_failures", "must not be negative"})
+	case spec.MaxFailures > 0 && spec.FailFast:
+		errs = append(errs, SpecError{"max_failures", "cannot be set with fail_fast"})
+	}
+	stages := map[string]bool{}
+	for i, stage := range spec.Stages {
+		if stages[stage] {
+			errs = append(errs, SpecError{fmt.Sprintf("stages[%d]", i), fmt.Sprintf("duplicate stage '%s'", stage)})
+		}
+		stages[stage] = true
+	}
+	declared := declaredJobs(spec.Jobs)
+	names := specJobNames(spec.Jobs)
+	namedIDs := map[string]int{}
+
+	visited := map[*Job]bool{}
+	var check func(field string, jobs []*Job)
+	check = func(field string, jobs []*Job) {
+		for i, j := range jobs {
+			if visited[j] {
+				continue
+			}
+			visited[j] = true
+			jobField := fmt.Sprintf("%s[%d]", field, i)
+			if j.Name != "" && j.Cmd != "" {
+				if id, ok := namedIDs[j.Name]; ok && (id == 0 || id != j.ID) {
+					errs = append(errs, SpecError{jobField + ".name", fmt.Sprintf("duplicate job name '%s'", j.Name)})
+				}
+				namedIDs[j.Name] = j.ID
+			}
+			for k, name := range j.DependsOn {
+				if !names[name] {
+					errs = append(errs, SpecError{fmt.Sprintf("%s.depends_on[%d]", jobField, k),
+						fmt.Sprintf("unknown job '%s'", name)})
+				}
+			}
+			for k, name := range j.After {
+				if !names[name] {
+					errs = append(errs, SpecError{fmt.Sprintf("%s.after[%d]", jobField, k),
+						fmt.Sprintf("unknown job '%s'", name)})
+				}
+			}
+			if j.Stage != "" && !stages[j.Stage] {
+				errs = append(errs, SpecError{jobField + ".stage", fmt.Sprintf("unknown stage '%s'", j.Stage)})
+			}
+			if j.StdinFrom != "" && !names[j.StdinFrom] {
+				errs = append(errs, SpecError{jobField + ".stdin_from", fmt.Sprintf("unknown job '%s'", j.StdinFrom)})
+			}
+			for k, d := range j.Directories {
+				field := fmt.Sprintf("%s.directories[%d]", jobField, k)
+				switch {
+				case strings.TrimSpace(d) == "":
+					errs = append(errs, SpecError{field, "empty directory"})
+				case path.IsAbs(d):
+					errs = append(errs, SpecError{field, "must be relative to the workflow dir"})
+				}
+			}
+			errs = append(errs, validateSecretNames(jobField+".secrets", j.Secrets)...)
+			if !validRetryBackoff(j.RetryBackoff) {
+				errs = append(errs, SpecError{jobField + ".retry_backoff",
+					fmt.Sprintf("unknown backoff '%s', expected fixed or exponential", j.RetryBackoff)})
+			}
+			if j.Host != "" && j.Image != "" {
+				errs = append(errs, SpecError{jobField + ".host", "cannot be set with image"})
+			}
+			if j.Host != "" && j.StdinFrom != "" {
+				errs = append(errs, SpecError{jobField + ".stdin_from", "cannot be set with host"})
+			}
+			switch {
+			case !validRestart(j.Restart):
+				errs = append(errs, SpecError{jobField + ".restart",
+					fmt.Sprintf("unknown restart policy '%s', expected never, on-failure or always", j.Restart)})
+			case j.Restart == RestartAlways && j.MaxRestarts <= 0:
+				errs = append(errs, SpecError{jobField + ".max_restarts", "must be positive with restart always"})
+			case j.MaxRestarts < 0:
+				errs = append(errs, SpecError{jobField + ".max_restarts", "must not be negative"})
+			case j.MaxRestarts > 0 && (j.Restart == "" || j.Restart == RestartNever):
+				errs = append(errs, SpecError{jobField + ".max_restarts", "cannot be set with restart never"})
+			}
+			if !validCapture(j.Capture) {
+				errs = append(errs, SpecError{jobField + ".capture",
+					fmt.Sprintf("unknown capture '%s', expected stdout or file:PATH", j.Capture)})
+			}
+			if len(j.Args) > 0 && j.Shell != "" {
+				errs = append(errs, SpecError{jobField + ".shell", "cannot be set with a cmd list"})
+			}
+			for k, code := range j.RetryExitCodes {
+				if code < 1 || code > 255 {
+					errs = append(errs, SpecError{fmt.Sprintf("%s.retry_on_exit_codes[%d]", jobField, k),
+						fmt.Sprintf("invalid exit code %d, expected 1 to 255", code)})
+				}
+			}
+			if j.When != "" {
+				if _, err := parseWhen(j.When); err != nil {
+					errs = append(errs, SpecError{jobField + ".when", err.Error()})
+				}
+			}
+			switch {
+			case j.Cmd != "" && declared[j.ID] != nil && declared[j.ID].Cmd != j.Cmd:
+				errs = append(errs, SpecError{jobField + ".id",
+					fmt.Sprintf("job %d is declared more than once with different cmds", j.ID)})
+			case j.Cmd == "" && j.ID == 0:
+				errs = append(errs, SpecError{jobField + ".cmd", "required"})
+			case j.Cmd == "" && declared[j.ID] == nil:
+				errs = append(errs, SpecError{jobField + ".id",
+					fmt.Sprintf("dependency on job %d which is not declared", j.ID)})
+			}
+			check(jobField+".dependencies", j.Dependencies)
+		}
+	}
+	check("jobs", spec.Jobs)
+	errs = append(errs, validateSecretNames("secrets", spec.Secrets)...)
+	return errs
+}
+
+// validateSecretNames checks each secret names an environment variable
+func validateSecretNames(field string, names []string) SpecErrors {
+	errs := SpecErrors{}
+	for i, name := range names {
+		if name == "" || strings.ContainsAny(name, "= ") {
+			errs = append(errs, SpecError{fmt.Sprintf("%s[%d]", field, i), fmt.Sprintf("invalid secret name '%s'", name)})
+		}
+	}
+	return errs
+}
+
+// declaredJobs maps ids to the first job declaring them with a cmd, a job
+// without a cmd is a reference to the job declared with the same id
+func declaredJobs(jobs []*Job) map[int]*Job {
+	declared := map[int]*Job{}
+	var collect func(jobs []*Job)
+	collect = func(jobs []*Job) {
+		for _, j := range jobs {
+			if _, ok := declared[j.ID]; !ok && j.ID != 0 && j.Cmd != "" {
+				declared[j.ID] = j
+			}
+			collect(j.Dependencies)
+		}
+	}
+	collect(jobs)
+	return declared
+}
+
+// specJobNames returns the set of job names declared in the spec
+func specJobNames(jobs []*Job) map[string]bool {
+	names := map[string]bool{}
+	var collect func(jobs []*Job)
+	collect = func(jobs []*Job) {
+		for _, j := range jobs {
+			if j.Name != "" {
+				names[j.Name] = true
+			}
+			if j.matrixName != "" {
+				names[j.matrixName] = true
+			}
+			collect(j.Dependencies)
+		}
+	}
+	collect(jobs)
+	return names
+}
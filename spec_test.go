@@ -0,0 +1,305 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateWorkflowSpec(t *testing.T) {
+	testCases := []struct {
+		name string
+		yaml string
+		want SpecErrors
+	}{
+		{"WellFormed", `
+workflow_dir: out
+jobs:
+- id: 1
+  cmd: echo a
+  dependencies:
+  - id: 2
+    cmd: echo b
+  - id: 3
+    cmd: echo c
+    dependencies:
+    - id: 2
+`, nil},
+		{"UnknownStdinFrom", `
+workflow_dir: out
+jobs:
+- cmd: tr a-z A-Z
+  stdin_from: missing
+`, SpecErrors{{"jobs[0].stdin_from", "unknown job 'missing'"}}},
+		{"InvalidSecretName", `
+workflow_dir: out
+secrets: [TOKEN, "A=B"]
+jobs:
+- cmd: echo a
+  secrets: [""]
+`, SpecErrors{{"jobs[0].secrets[0]", "invalid secret name ''"}, {"secrets[1]", "invalid secret name 'A=B'"}}},
+		{"KeepGoingAndFailFast", `
+workflow_dir: out
+keep_going: true
+fail_fast: true
+jobs:
+- cmd: echo a
+`, SpecErrors{{"fail_fast", "cannot be set with keep_going"}}},
+		{"InvalidMaxFailures", `
+workflow_dir: out
+max_failures: -1
+jobs:
+- cmd: echo a
+`, SpecErrors{{"max_failures", "must not be negative"}}},
+		{"MaxFailuresAndFailFast", `
+workflow_dir: out
+max_failures: 2
+fail_fast: true
+jobs:
+- cmd: echo a
+`, SpecErrors{{"max_failures", "cannot be set with fail_fast"}}},
+		{"MissingCmd", `
+workflow_dir: out
+jobs:
+- cmd: echo a
+  dependencies:
+  - directories: [out]
+`, SpecErrors{{"jobs[0].dependencies[0].cmd", "required"}}},
+		{"DanglingDependency", `
+workflow_dir: out
+jobs:
+- id: 1
+  cmd: echo a
+  dependencies:
+  - id: 7
+`, SpecErrors{{"jobs[0].dependencies[0].id", "dependency on job 7 which is not declared"}}},
+		{"MissingWorkflowDirAndConflictingIDs", `
+jobs:
+- id: 1
+  cmd: echo a
+- id: 1
+  cmd: echo b
+`, SpecErrors{
+			{"workflow_dir", "required"},
+			{"jobs[1].id", "job 1 is declared more than once with different cmds"},
+		}},
+		{"DuplicateName", `
+workflow_dir: out
+jobs:
+- name: build
+  cmd: make
+- name: build
+  cmd: make all
+`, SpecErrors{{"jobs[1].name", "duplicate job name 'build'"}}},
+		{"UnknownName", `
+workflow_dir: out
+jobs:
+- name: build
+  cmd: make
+- name: test
+  cmd: make test
+  depends_on: [build, lint]
+`, SpecErrors{{"jobs[1].depends_on[1]", "unknown job 'lint'"}}},
+		{"UnknownRetryBackoff", `
+workflow_dir: out
+jobs:
+- cmd: make
+  retries: 2
+  retry_backoff: linear
+`, SpecErrors{{"jobs[0].retry_backoff", "unknown backoff 'linear', expected fixed or exponential"}}},
+		{"InvalidDirectories", `
+workflow_dir: out
+jobs:
+- cmd: make
+  directories: [ok, "", /abs]
+`, SpecErrors{{"jobs[0].directories[1]", "empty directory"}, {"jobs[0].directories[2]", "must be relative to the workflow dir"}}},
+		{"InvalidWhen", `
+workflow_dir: out
+jobs:
+- cmd: make deploy
+  when: DEPLOY
+`, SpecErrors{{"jobs[0].when", "invalid condition 'DEPLOY': expected env: or exists:"}}},
+		{"ShellWithCmdList", `
+workflow_dir: out
+jobs:
+- cmd: [echo, a]
+  shell: python -c
+`, SpecErrors{{"jobs[0].shell", "cannot be set with a cmd list"}}},
+		{"HostWithImageOrStdin", `
+workflow_dir: out
+jobs:
+- name: a
+  cmd: make
+- cmd: make test
+  host: build.example.com
+  image: golang
+  stdin_from: a
+`, SpecErrors{{"jobs[1].host", "cannot be set with image"}, {"jobs[1].stdin_from", "cannot be set with host"}}},
+		{"InvalidCapture", `
+workflow_dir: out
+jobs:
+- cmd: make
+  capture: stderr
+`, SpecErrors{{"jobs[0].capture", "unknown capture 'stderr', expected stdout or file:PATH"}}},
+		{"InvalidRetryExitCode", `
+workflow_dir: out
+jobs:
+- cmd: make
+  retries: 2
+  retry_on_exit_codes: [75, 0]
+`, SpecErrors{{"jobs[0].retry_on_exit_codes[1]", "invalid exit code 0, expected 1 to 255"}}},
+		{"InvalidRestart", `
+workflow_dir: out
+jobs:
+- cmd: make
+  restart: unless-stopped
+- cmd: make test
+  restart: always
+- cmd: make lint
+  max_restarts: 3
+`, SpecErrors{{"jobs[0].restart", "unknown restart policy 'unless-stopped', expected never, on-failure or always"},
+			{"jobs[1].max_restarts", "must be positive with restart always"},
+			{"jobs[2].max_restarts", "cannot be set with restart never"}}},
+		{"InvalidStages", `
+workflow_dir: out
+stages: [build, test, build]
+jobs:
+- cmd: make
+  stage: deploy
+`, SpecErrors{{"stages[2]", "duplicate stage 'build'"}, {"jobs[0].stage", "unknown stage 'deploy'"}}},
+		{"EmptyCmdList", `
+workflow_dir: out
+jobs:
+- cmd: []
+`, SpecErrors{{"jobs[0].cmd", "required"}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateWorkflowSpec([]byte(tc.yaml))
+			if tc.want == nil {
+				if err != nil {
+					t.Errorf("expected a valid spec, got %v", err)
+				}
+				return
+			}
+			got, ok := err.(SpecErrors)
+			if !ok {
+				t.Fatalf("expected SpecErrors, got %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected errors %v, got %v", tc.want, got)
+			}
+		})
+	}
+
+	if err := ValidateWorkflowSpec([]byte("jobs: {")); err == nil {
+		t.Error("expected an error for malformed yaml")
+	}
+}
+
+func TestDependsOnNames(t *testing.T) {
+	defer cleanTestData(t)
+	wfYaml := `
+workflow_dir: .
+jobs:
+- name: a
+  cmd: echo a
+  depends_on: [b, c]
+- name: b
+  cmd: echo b
+  depends_on: [d]
+- name: c
+  cmd: echo c
+  depends_on: [d]
+- name: d
+  cmd: echo d
+`
+	wf, err := workflowFromYaml(writeTestYaml(t, "DependsOnNames", wfYaml), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]*Job{}
+	for _, j := range wf.Jobs {
+		byName[j.Name] = j
+	}
+	a, b, c, d := byName["a"], byName["b"], byName["c"], byName["d"]
+	if len(a.Dependencies) != 2 || a.Dependencies[0] != b || a.Dependencies[1] != c {
+		t.Error("expected a to depend on b and c")
+	}
+	if len(b.Dependencies) != 1 || len(c.Dependencies) != 1 || b.Dependencies[0] != d || c.Dependencies[0] != d {
+		t.Error("expected b and c to depend on the same d")
+	}
+	expectZero(t, wf.Run())
+
+	_, err = workflowFromYaml(writeTestYaml(t, "UnknownDependsOn", `
+workflow_dir: .
+jobs:
+- name: a
+  cmd: echo a
+  depends_on: [missing]
+`), "")
+	if err == nil {
+		t.Error("expected an error loading a workflow depending on an unknown job")
+	}
+}
+
+func TestDeterministicJobIDs(t *testing.T) {
+	defer cleanTestData(t)
+	wfYaml := `
+workflow_dir: .
+jobs:
+- name: report
+  cmd: echo report
+  depends_on: [test]
+- name: test
+  cmd: echo test ${matrix.os}
+  matrix:
+    os: [linux, darwin]
+  dependencies:
+  - id: 10
+    cmd: echo build
+  - name: fetch
+    cmd: echo fetch
+- name: lint
+  cmd: echo lint
+`
+	yamlPath := writeTestYaml(t, "DeterministicJobIDs", wfYaml)
+	ids := func() map[string]int {
+		wf, err := workflowFromYaml(yamlPath, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		byCmd := map[string]int{}
+		for _, j := range wf.allJobs() {
+			byCmd[j.Cmd] = j.ID
+		}
+		return byCmd
+	}
+	// jobs without an id are numbered after the explicit 10, each after the jobs it depends on
+	want := map[string]int{"echo build": 10, "echo fetch": 11, "echo test linux": 12, "echo test darwin": 13,
+		"echo report": 14, "echo lint": 15}
+	for i := 0; i < 2; i++ {
+		if got := ids(); !reflect.DeepEqual(got, want) {
+			t.Errorf("expected job ids %v on load %d, got %v", want, i+1, got)
+		}
+	}
+}
+
+func TestNamedCycle(t *testing.T) {
+	defer cleanTestData(t)
+	wf, err := workflowFromYaml(writeTestYaml(t, "NamedCycle", `
+workflow_dir: .
+jobs:
+- name: A
+  cmd: echo a
+  depends_on: [B]
+- name: B
+  cmd: echo b
+  depends_on: [A]
+`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wf.Validate(); err == nil || err.Error() != "dependency cycle: A -> B -> A" {
+		t.Errorf("expected named dependency cycle error, got %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// sshCommand is the ssh cli run by the SSHExecutor
+var sshCommand = "ssh"
+
+// sshConnectionFailed is the exit code of the ssh cli when it could not connect or authenticate
+const sshConnectionFailed = 255
+
+// SSHConfig configures how jobs with a Host connect to it with the ssh cli.
+// User is the login user unless the host is given as user@host, KeyFile the private key
+// to authenticate with and Port the port of the ssh server, 22 when it is 0.
+// Options are extra ssh -o options such as StrictHostKeyChecking=accept-new
+type SSHConfig struct {
+	User    string   `json:"user,omitempty"`
+	KeyFile string   `json:"key_file,omitempty"`
+	Port    int      `json:"port,omitempty"`
+	Options []string `json:"options,omitempty"`
+}
+
+// sshTarget identifies where a job with a Host runs, its host and the ssh user and port,
+// so hashes of a job's configuration change with its target. It is "" for a local job
+func (j *Job) sshTarget() string {
+	if j.Host == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s@%s:%d", j.workflow.SSH.User, j.Host, j.workflow.SSH.Port)
+}
+
+// SSHExecutor runs jobs on the job's Host with the ssh cli, streaming their output back.
+// The job script is sent over stdin with the job's environment and secrets, so their values
+// are not in any command line, and runs with bash in the remote user's home dir with
+// GFLOW_TMP set to a remote tmp dir removed once it exits.
+// Authentication is non-interactive, a connection or authentication failure fails the job
+type SSHExecutor struct{}
+
+// Run executes the job script on the job's Host. When ctx is done the ssh cli is killed,
+// which closes the connection and hangs up the remote script
+func (SSHExecutor) Run(ctx context.Context, j *Job, stdout, stderr io.Writer) (int, error) {
+	script, err := ioutil.ReadFile(j.pathToExec("exe"))
+	if err != nil {
+		return -1, err
+	}
+	sshErr := &bytes.Buffer{}
+	cmd := exec.Command(sshCommand, sshArgs(j.workflow.SSH, j.Host)...)
+	cmd.Stdin = strings.NewReader(sshScript(j, string(script)))
+	cmd.Stdout = stdout
+	cmd.Stderr = io.MultiWriter(stderr, &limitedBuffer{buf: sshErr, limit: 4096})
+	err = cmd.Start()
+	if err != nil {
+		return -1, err
+	}
+	waited := make(chan error, 1)
+	go func() { waited <- cmd.Wait() }()
+	select {
+	case err = <-waited:
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		err = <-waited
+		return exitCode(err), err
+	}
+	if exitCode(err) == sshConnectionFailed {
+		return sshConnectionFailed, &sshError{fmt.Errorf("ssh connection to %s failed: %s",
+			j.Host, lastLine(sshErr.String()))}
+	}
+	return exitCode(err), err
+}
+
+// sshArgs returns the ssh cli arguments running bash on host, reading its script from stdin
+func sshArgs(config SSHConfig, host string) []string {
+	args := []string{"-o", "BatchMode=yes"}
+	for _, o := range config.Options {
+		args = append(args, "-o", o)
+	}
+	if config.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(config.Port))
+	}
+	if config.KeyFile != "" {
+		args = append(args, "-i", config.KeyFile)
+	}
+	if config.User != "" && !strings.Contains(host, "@") {
+		args = append(args, "-l", config.User)
+	}
+	return append(args, host, "bash", "-s")
+}
+
+// sshScript returns the remote script exporting the job's environment and secrets,
+// writing the job script to a remote tmp dir and running it there with stdin closed
+func sshScript(j *Job, script string) string {
+	b := &strings.Builder{}
+	b.WriteString("set -e\n")
+	b.WriteString("gflow_dir=\"$(mktemp -d)\"\n")
+	b.WriteString("trap 'rm -rf \"$gflow_dir\"' EXIT\n")
+	b.WriteString("mkdir \"$gflow_dir/tmp\"\n")
+	for _, kv := range append(j.jobEnviron(), j.secretEnviron()...) {
+		kv := strings.SplitN(kv, "=", 2)
+		if kv[0] == "GFLOW_TMP" {
+			continue
+		}
+		fmt.Fprintf(b, "export %s=%s\n", kv[0], shellQuote(kv[1]))
+	}
+	b.WriteString("export GFLOW_TMP=\"$gflow_dir/tmp\"\n")
+	delimiter := fmt.Sprintf("GFLOW_SCRIPT_%d_%d_%d", os.Getpid(), j.ID, j.Attempts)
+	fmt.Fprintf(b, "cat > \"$gflow_dir/exe\" <<'%s'\n%s\n%s\n", delimiter, strings.TrimSuffix(script, "\n"), delimiter)
+	b.WriteString("set +e\n")
+	b.WriteString("bash \"$gflow_dir/exe\" < /dev/null\n")
+	return b.String()
+}
+
+// sshError is returned when a job could not connect or authenticate to its Host
+type sshError struct {
+	error
+}
+
+func isSSHError(err error) bool {
+	_, ok := err.(*sshError)
+	return ok
+}
+
+// limitedBuffer writes to buf until it holds limit bytes, discarding the rest
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	if room := l.limit - l.buf.Len(); room > 0 {
+		if len(p) > room {
+			l.buf.Write(p[:room])
+		} else {
+			l.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// lastLine returns the last non empty line of s
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
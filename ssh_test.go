@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// fakeSSH replaces the ssh cli with a script recording its arguments to ssh.args,
+// then running body, until the returned func restores it
+func fakeSSH(t *testing.T, wf *Workflow, body string) func() {
+	fake := wf.pathToWDir("ssh")
+	script := "#!/bin/bash\nprintf '%s\\n' \"$@\" > " + shellQuote(wf.pathToWDir("ssh.args")) + "\n" + body + "\n"
+	if err := ioutil.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	sshCommand = fake
+	return func() { sshCommand = "ssh" }
+}
+
+func TestSSHExecutor(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "SSHExecutor")
+	wf.SSH = SSHConfig{User: "deploy", KeyFile: "/keys/id_ed25519", Port: 2222}
+	wf.Env = map[string]string{"GREETING": "hello 'remote'"}
+	// the remote end runs the script it is sent with bash, as sshd would
+	defer fakeSSH(t, wf, "exec bash -s")()
+	j := newJob(wf, []string{}, []*Job{}, []string{}, false, `echo "$GREETING"; echo warn >&2; [[ -d $GFLOW_TMP ]]`)
+	j.Host = "build.example.com"
+	wf.AddJob(j)
+	expectZero(t, wf.Run())
+
+	args, err := ioutil.ReadFile(wf.pathToWDir("ssh.args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "-o BatchMode=yes -p 2222 -i /keys/id_ed25519 -l deploy build.example.com bash -s"
+	if got := strings.Join(strings.Fields(string(args)), " "); got != want {
+		t.Errorf("expected ssh args '%s', got '%s'", want, got)
+	}
+	stdout, err := ioutil.ReadFile(j.StdoutLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(stdout) != "hello 'remote'\n" {
+		t.Errorf("expected the remote stdout in the stdout log, got %q", string(stdout))
+	}
+	stderr, err := ioutil.ReadFile(j.StderrLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(stderr) != "warn\n" {
+		t.Errorf("expected the remote stderr in the stderr log, got %q", string(stderr))
+	}
+}
+
+func TestSSHExecutorConnectionFailed(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "SSHExecutorConnectionFailed")
+	defer fakeSSH(t, wf, "echo 'deploy@build.example.com: Permission denied (publickey).' >&2; exit 255")()
+	j := newJob(wf, []string{}, []*Job{}, []string{}, false, "echo never")
+	j.Host = "deploy@build.example.com"
+	wf.AddJob(j)
+	expectNonZero(t, wf.Run())
+
+	want := "ssh connection to deploy@build.example.com failed: deploy@build.example.com: Permission denied (publickey)."
+	if j.Status != StatusFailed || j.Reason != want {
+		t.Errorf("expected job to fail with reason '%s', got %s: '%s'", want, j.Status, j.Reason)
+	}
+	if got := wf.failedJobs.List()[0].Reason; got != FailureError {
+		t.Errorf("expected failure %s, got %s", FailureError, got)
+	}
+}
+
+func TestSSHTargetHashed(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "SSHTargetHashed")
+	wf.CacheDir = "cache"
+	j := newJob(wf, []string{}, []*Job{}, []string{"out.txt"}, false, "deploy > out.txt")
+	hashes := func() (string, string) {
+		key, err := j.cacheKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return j.configHash(), key
+	}
+	seen := map[string]bool{}
+	for _, target := range []struct {
+		host string
+		port int
+	}{{"", 0}, {"a.example.com", 0}, {"b.example.com", 0}, {"b.example.com", 2222}} {
+		j.Host, wf.SSH.Port = target.host, target.port
+		config, key := hashes()
+		if seen[config] || seen[key] {
+			t.Errorf("expected the hashes of a job on %s port %d to differ from other targets", target.host, target.port)
+		}
+		seen[config], seen[key] = true, true
+	}
+}
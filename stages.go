@@ -0,0 +1,39 @@
+package main
+
+import "fmt"
+
+// resolveStages makes each job with a Stage depend on every job of the nearest earlier stage
+// that has jobs, so a stage starts once the stage before it has finished.
+// Stages are run in the order of the workflow's Stages
+func resolveStages(stages []string, jobs []*Job) error {
+	order := map[string]int{}
+	for i, stage := range stages {
+		order[stage] = i
+	}
+	byStage := make([][]*Job, len(stages))
+	for _, j := range jobs {
+		if j.Stage == "" {
+			continue
+		}
+		i, ok := order[j.Stage]
+		if !ok {
+			return fmt.Errorf("job %s has unknown stage '%s'", j.label(), j.Stage)
+		}
+		byStage[i] = append(byStage[i], j)
+	}
+	var previous []*Job
+	for _, stageJobs := range byStage {
+		if len(stageJobs) == 0 {
+			continue
+		}
+		for _, j := range stageJobs {
+			for _, d := range previous {
+				if !j.dependsOn(d) {
+					j.AddDependency(d)
+				}
+			}
+		}
+		previous = stageJobs
+	}
+	return nil
+}
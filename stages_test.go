@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestStages(t *testing.T) {
+	defer cleanTestData(t)
+	yamlPath := writeTestYaml(t, "Stages", `
+workflow_dir: .
+stages: [build, test]
+jobs:
+- name: test-unit
+  stage: test
+  cmd: "true"
+- name: build-fast
+  stage: build
+  cmd: "true"
+- name: build-slow
+  stage: build
+  cmd: sleep 0.2
+- name: test-lint
+  stage: test
+  cmd: "true"
+- name: unstaged
+  cmd: "true"
+`)
+	wf, err := workflowFromYaml(yamlPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectZero(t, wf.Run())
+
+	byName := map[string]*Job{}
+	for _, j := range wf.allJobs() {
+		byName[j.Name] = j
+	}
+	events := jobEvents(t, wf)
+	for _, build := range []string{"build-fast", "build-slow"} {
+		finished := events[byName[build].ID][EventFinished].Time
+		for _, test := range []string{"test-unit", "test-lint"} {
+			if started := events[byName[test].ID][EventStarted].Time; started.Before(finished) {
+				t.Errorf("expected %s to start after %s finished, started %v finished %v", test, build, started, finished)
+			}
+		}
+	}
+	if n := len(byName["unstaged"].Dependencies); n != 0 {
+		t.Errorf("expected a job without a stage to have no dependencies, got %d", n)
+	}
+	if n := len(byName["build-slow"].Dependencies); n != 0 {
+		t.Errorf("expected a job of the first stage to have no dependencies, got %d", n)
+	}
+}
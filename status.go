@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// StatusRunning is reported by status and the jobs api for a job that has started but not finished in a run in progress
+const StatusRunning = "running"
+
+// loadWorkflowJSON reads back the workflow JSON written by the last run of the workflow in wfDir
+// keeping its state in its .gflow dir
+func loadWorkflowJSON(wfDir string) (*Workflow, error) {
+	absWfDir, err := filepath.Abs(wfDir)
+	if err != nil {
+		return nil, err
+	}
+	return readWorkflowJSON(path.Join(absWfDir, ".gflow", "wf.json"))
+}
+
+// readWorkflowJSON reads back the workflow JSON at wfJSONPath
+func readWorkflowJSON(wfJSONPath string) (*Workflow, error) {
+	b, err := ioutil.ReadFile(wfJSONPath)
+	if err != nil {
+		return nil, err
+	}
+	w := &Workflow{}
+	err = json.Unmarshal(b, w)
+	if err != nil {
+		return nil, fmt.Errorf("reading workflow json: %v", err)
+	}
+	return w, nil
+}
+
+// statusJobs returns each job of a loaded workflow once, in ID order. When the event DB
+// shows a run started after the workflow JSON was written, statuses come from its events
+func (w *Workflow) statusJobs() ([]*Job, error) {
+	byID := map[int]*Job{}
+	var collect func(jobs []*Job)
+	collect = func(jobs []*Job) {
+		for _, j := range jobs {
+			if _, ok := byID[j.ID]; !ok {
+				byID[j.ID] = j
+			}
+			collect(j.Dependencies)
+		}
+	}
+	collect(w.Jobs)
+	jobs := []*Job{}
+	for _, j := range byID {
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].ID < jobs[b].ID })
+
+	info, err := os.Stat(w.WFJsonPath)
+	if err != nil {
+		return nil, err
+	}
+	events, err := readEvents(w.EventDBPath)
+	if os.IsNotExist(err) {
+		return jobs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	runStart := -1
+	for i, e := range events {
+		if e.Type == EventWorkflowStarted && e.Time.After(info.ModTime()) {
+			runStart = i
+		}
+	}
+	if runStart < 0 {
+		return jobs, nil
+	}
+	for _, j := range jobs {
+		j.Status = StatusPending
+	}
+	for _, e := range events[runStart+1:] {
+		j, ok := byID[e.JobID]
+		if !ok {
+			continue
+		}
+		switch e.Type {
+		case EventStarted:
+			j.Status = StatusRunning
+		case EventFinished:
+			j.Status = StatusSucceeded
+		case EventFailed:
+			j.Status = StatusFailed
+		case EventSkipped:
+			j.Status = StatusSkipped
+		case EventInterrupted:
+			j.Status = StatusInterrupted
+		case EventCancelled:
+			j.Status = StatusCancelled
+		}
+	}
+	return jobs, nil
+}
+
+// jobsWithEventsSince reports which jobs have events in the event DB recorded at or after since
+func (w *Workflow) jobsWithEventsSince(since time.Time) (map[int]bool, error) {
+	events, err := readEvents(w.EventDBPath)
+	if os.IsNotExist(err) {
+		return map[int]bool{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := map[int]bool{}
+	for _, e := range eventsSince(events, since) {
+		ids[e.JobID] = true
+	}
+	return ids, nil
+}
+
+// printStatus writes a table of the workflow's jobs with their status, duration and logs,
+// followed by the PATH the last run started with when it was recorded.
+// With since set, only the jobs with events recorded at or after it are listed
+func (w *Workflow) printStatus(out io.Writer, since time.Time) error {
+	jobs, err := w.statusJobs()
+	if err != nil {
+		return err
+	}
+	if !since.IsZero() {
+		recent, err := w.jobsWithEventsSince(since)
+		if err != nil {
+			return err
+		}
+		listed := []*Job{}
+		for _, j := range jobs {
+			if recent[j.ID] {
+				listed = append(listed, j)
+			}
+		}
+		jobs = listed
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSTATUS\tDURATION\tSTDOUT LOG\tSTDERR LOG")
+	for _, j := range jobs {
+		name := j.Name
+		if name == "" {
+			name = "-"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%v\t%s\t%s\n", j.ID, name, j.Status, j.Duration.Duration, j.StdoutLog, j.StderrLog)
+	}
+	err = tw.Flush()
+	if err != nil || w.EnvPath == "" {
+		return err
+	}
+	snapshot, err := readEnvSnapshot(w.EnvPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "\nPATH: %s\n", snapshot.Path)
+	return err
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatus(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "Status")
+	build := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	build.Name = "build"
+	test := newJob(wf, []string{}, []*Job{build}, []string{}, false, "false")
+	deploy := newJob(wf, []string{}, []*Job{build, test}, []string{}, false, "true")
+	wf.AddJob(deploy)
+	expectNonZero(t, wf.Run())
+
+	loaded, err := loadWorkflowJSON(wf.WorkflowDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := loaded.statusJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 3 {
+		t.Fatalf("expected each of the 3 jobs once, got %d", len(jobs))
+	}
+	for i, want := range []*Job{build, test, deploy} {
+		got := jobs[i]
+		if got.ID != want.ID || got.Status != want.Status || got.StdoutLog != want.StdoutLog || got.StderrLog != want.StderrLog {
+			t.Errorf("expected job %d %s with logs %s %s, got job %d %s with logs %s %s", want.ID, want.Status,
+				want.StdoutLog, want.StderrLog, got.ID, got.Status, got.StdoutLog, got.StderrLog)
+		}
+		if got.Duration.Duration == 0 && got.Status != StatusSkipped {
+			t.Errorf("expected job %d to have a duration", got.ID)
+		}
+	}
+
+	out := &bytes.Buffer{}
+	if err := loaded.printStatus(out, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 6 || !strings.HasPrefix(lines[0], "ID") {
+		t.Fatalf("expected a header, a line per job and the PATH of the run, got %q", out.String())
+	}
+	if want := "PATH: " + os.Getenv("PATH"); lines[5] != want {
+		t.Errorf("expected the PATH the run started with '%s', got '%s'", want, lines[5])
+	}
+	for i, want := range [][]string{{strconv.Itoa(build.ID), "build", "succeeded"}, {strconv.Itoa(test.ID), "-", "failed"}} {
+		fields := strings.Fields(lines[i+1])
+		if !reflect.DeepEqual(fields[:3], want) || fields[4] != jobs[i].StdoutLog {
+			t.Errorf("expected status line starting %q with its log, got %q", want, lines[i+1])
+		}
+	}
+
+	// a new run in progress takes its statuses from the event db
+	since := time.Now()
+	err = loaded.setupEventDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.eventDB.record(Event{Type: EventWorkflowStarted})
+	loaded.eventDB.record(Event{JobID: build.ID, Type: EventStarted})
+	loaded.eventDB.Close()
+	jobs, err = loaded.statusJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs[0].Status != StatusRunning || jobs[1].Status != StatusPending {
+		t.Errorf("expected running and pending jobs in a run in progress, got %s and %s", jobs[0].Status, jobs[1].Status)
+	}
+
+	out.Reset()
+	if err := loaded.printStatus(out, since); err != nil {
+		t.Fatal(err)
+	}
+	lines = strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[1], strconv.Itoa(build.ID)+" ") {
+		t.Errorf("expected only the job with events since the new run started, got %q", out.String())
+	}
+}
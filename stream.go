@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// prefixWriter writes each complete line to out prefixed with prefix.
+// Writers streaming to the same out share a mutex so lines from concurrent jobs do not interleave
+type prefixWriter struct {
+	out    io.Writer
+	mutex  *sync.Mutex
+	prefix string
+	buf    []byte
+}
+
+func newPrefixWriter(out io.Writer, mutex *sync.Mutex, prefix string) *prefixWriter {
+	return &prefixWriter{out: out, mutex: mutex, prefix: prefix}
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		err := p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+		if err != nil {
+			return len(b), err
+		}
+	}
+}
+
+// Flush writes any partial last line, terminating it with a newline
+func (p *prefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	line := append(p.buf, '\n')
+	p.buf = nil
+	return p.writeLine(line)
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	_, err := io.WriteString(p.out, p.prefix)
+	if err != nil {
+		return err
+	}
+	_, err = p.out.Write(line)
+	return err
+}
+
+// streamOutputs tees the job's output to its logs, the workflow's combined log and, with Stream set,
+// the console. The returned func flushes the partial last lines once the command has exited
+func (j *Job) streamOutputs(outLog, errLog io.Writer) (stdout, stderr io.Writer, flush func()) {
+	w := j.workflow
+	outs, errs := []io.Writer{outLog}, []io.Writer{errLog}
+	flushers := []interface{ Flush() error }{}
+	if w.combined != nil {
+		outCombined := &combinedWriter{log: w.combined, jobID: j.ID}
+		errCombined := &combinedWriter{log: w.combined, jobID: j.ID}
+		outs, errs = append(outs, outCombined), append(errs, errCombined)
+		flushers = append(flushers, outCombined, errCombined)
+	}
+	if w.Stream {
+		prefix := "[job_" + strconv.Itoa(j.ID) + "] "
+		outStream := newPrefixWriter(w.stdout, w.streamLock, prefix)
+		errStream := newPrefixWriter(w.stderr, w.streamLock, prefix)
+		outs, errs = append(outs, outStream), append(errs, errStream)
+		flushers = append(flushers, outStream, errStream)
+	}
+	flush = func() {
+		for _, f := range flushers {
+			f.Flush()
+		}
+	}
+	return io.MultiWriter(outs...), io.MultiWriter(errs...), flush
+}
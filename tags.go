@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tagsFlag is a command line flag of comma separated tags, it may be repeated
+type tagsFlag []string
+
+func (t *tagsFlag) String() string {
+	return strings.Join(*t, ",")
+}
+
+func (t *tagsFlag) Set(s string) error {
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			return fmt.Errorf("empty tag in '%s'", s)
+		}
+		*t = append(*t, tag)
+	}
+	return nil
+}
+
+// tags returns the job's Tags and the Tags of its workflow
+func (j *Job) tags() []string {
+	return append(append([]string{}, j.workflow.Tags...), j.Tags...)
+}
+
+// hasTag reports whether the job has any of tags
+func (j *Job) hasTag(tags []string) bool {
+	for _, tag := range j.tags() {
+		for _, t := range tags {
+			if tag == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// taggedJobs narrows the sorted jobs to those with any of the OnlyTags and, unless
+// TagsStrict is set, the jobs they transitively depend on, keeping their order
+func (w *Workflow) taggedJobs(sorted []*Job) ([]*Job, error) {
+	tagged := []*Job{}
+	for _, j := range sorted {
+		if j.hasTag(w.OnlyTags) {
+			tagged = append(tagged, j)
+		}
+	}
+	if len(tagged) == 0 {
+		return nil, fmt.Errorf("no job tagged '%s'", strings.Join(w.OnlyTags, ","))
+	}
+	if w.TagsStrict {
+		return tagged, nil
+	}
+	return withDependencies(sorted, tagged), nil
+}
+
+// unselect marks the sorted jobs that are not among the selected jobs as unselected,
+// so the selected jobs do not wait on them
+func unselect(sorted, selected []*Job) {
+	in := map[*Job]bool{}
+	for _, j := range selected {
+		in[j] = true
+	}
+	for _, j := range sorted {
+		j.unselected = !in[j]
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestTaggedJobs(t *testing.T) {
+	defer cleanTestData(t)
+	testCases := []struct {
+		name     string
+		tags     []string
+		strict   bool
+		expected []string
+	}{
+		{"Tagged", []string{"build"}, false, []string{"build"}},
+		{"DependencyClosure", []string{"test"}, false, []string{"build", "lint", "test"}},
+		{"Strict", []string{"test"}, true, []string{"lint", "test"}},
+		{"StrictDependent", []string{"deploy"}, true, []string{"deploy"}},
+		{"AnyTag", []string{"deploy", "lint"}, false, []string{"build", "deploy", "lint", "test"}},
+		{"WorkflowTag", []string{"ci"}, false, []string{"build", "deploy", "docs", "lint", "test"}},
+	}
+	for i, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wf := testWorkflow(t, fmt.Sprintf("TaggedJobs%d", i))
+			wf.Tags = []string{"ci"}
+			job := func(name string, tags []string, deps ...*Job) *Job {
+				j := newJob(wf, []string{}, deps, []string{}, false, "true")
+				j.Name = name
+				j.Tags = tags
+				return j
+			}
+			build := job("build", []string{"build"})
+			lint := job("lint", []string{"test", "lint"})
+			test := job("test", []string{"test"}, build)
+			deploy := job("deploy", []string{"deploy"}, test)
+			docs := job("docs", nil)
+			wf.AddJob(deploy, lint, docs)
+			wf.OnlyTags = tc.tags
+			wf.TagsStrict = tc.strict
+			expectZero(t, wf.Run())
+
+			ran := []string{}
+			for _, j := range []*Job{build, lint, test, deploy, docs} {
+				if j.Attempts > 0 {
+					ran = append(ran, j.Name)
+				}
+			}
+			sort.Strings(ran)
+			if strings.Join(ran, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("expected jobs %v to run, got %v", tc.expected, ran)
+			}
+		})
+	}
+
+	wf := testWorkflow(t, "TaggedJobsMissing")
+	wf.AddJob(newJob(wf, []string{}, []*Job{}, []string{}, false, "true"))
+	wf.OnlyTags = []string{"missing"}
+	if status := wf.Run(); status != ExitInvalidWorkflow {
+		t.Errorf("expected exit status %d for a tag no job has, got %d", ExitInvalidWorkflow, status)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// varPattern matches ${name} references to workflow vars, and $$ which escapes a $
+var varPattern = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_.]*)\}`)
+
+// varFlag collects repeated -var key=value flags
+type varFlag map[string]string
+
+func (v *varFlag) String() string {
+	kvs := []string{}
+	for k, value := range *v {
+		kvs = append(kvs, k+"="+value)
+	}
+	sort.Strings(kvs)
+	return strings.Join(kvs, ",")
+}
+
+func (v *varFlag) Set(kv string) error {
+	i := strings.Index(kv, "=")
+	if i < 1 {
+		return fmt.Errorf("expected key=value, got '%s'", kv)
+	}
+	if *v == nil {
+		*v = varFlag{}
+	}
+	(*v)[kv[:i]] = kv[i+1:]
+	return nil
+}
+
+// interpolate replaces ${name} references in s with the values of vars,
+// returning the names referenced which are not defined.
+// References to the outputs of jobs are left to be resolved when the job is dispatched
+func interpolate(s string, vars map[string]string) (string, []string) {
+	undefined := []string{}
+	result := varPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "$$" {
+			return "$"
+		}
+		name := ref[2 : len(ref)-1]
+		if isOutputRef(name) {
+			return ref
+		}
+		value, ok := vars[name]
+		if !ok {
+			undefined = append(undefined, name)
+		}
+		return value
+	})
+	return result, undefined
+}
+
+// substituteVars interpolates the spec's vars, overridden by overrides, and the matrix values
+// of matrix jobs into the cmd, directories, inputs and outputs of its jobs.
+// References to undefined vars are returned as errors
+func substituteVars(spec *Workflow, overrides map[string]string) SpecErrors {
+	vars := map[string]string{}
+	for _, values := range []map[string]string{spec.Vars, overrides} {
+		for k, v := range values {
+			vars[k] = v
+		}
+	}
+	if len(vars) > 0 {
+		spec.Vars = vars
+	}
+
+	var errs SpecErrors
+	substitute := func(field string, s *string, vars map[string]string) {
+		var undefined []string
+		*s, undefined = interpolate(*s, vars)
+		for _, name := range undefined {
+			errs = append(errs, SpecError{field, fmt.Sprintf("undefined variable '%s'", name)})
+		}
+	}
+	visited := map[*Job]bool{}
+	var visit func(field string, jobs []*Job)
+	visit = func(field string, jobs []*Job) {
+		for i, j := range jobs {
+			if visited[j] {
+				continue
+			}
+			visited[j] = true
+			jobField := fmt.Sprintf("%s[%d]", field, i)
+			jobVars := vars
+			if len(j.matrixVars) > 0 {
+				jobVars = map[string]string{}
+				for _, values := range []map[string]string{vars, j.matrixVars} {
+					for k, v := range values {
+						jobVars[k] = v
+					}
+				}
+			}
+			substitute := func(field string, s *string) { substitute(field, s, jobVars) }
+			substituteAll := func(field string, values []string) {
+				for i := range values {
+					substitute(fmt.Sprintf("%s[%d]", field, i), &values[i])
+				}
+			}
+			if len(j.Args) > 0 {
+				substituteAll(jobField+".cmd", j.Args)
+				j.Cmd = argsCmd(j.Args)
+			} else {
+				substitute(jobField+".cmd", &j.Cmd)
+			}
+			substituteAll(jobField+".directories", j.Directories)
+			substituteAll(jobField+".inputs", j.Inputs)
+			substituteAll(jobField+".outputs", j.Outputs)
+			visit(jobField+".dependencies", j.Dependencies)
+		}
+	}
+	visit("jobs", spec.Jobs)
+	return errs
+}
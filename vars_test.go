@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	vars := map[string]string{"name": "world", "n": "3"}
+	testCases := []struct {
+		s         string
+		want      string
+		undefined []string
+	}{
+		{"echo ${name}", "echo world", []string{}},
+		{"seq ${n} > ${name}_${n}.txt", "seq 3 > world_3.txt", []string{}},
+		{"echo $HOME $$HOME", "echo $HOME $HOME", []string{}},
+		{"echo $${HOME}", "echo ${HOME}", []string{}},
+		{"echo ${missing} ${name} ${other}", "echo  world ", []string{"missing", "other"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.s, func(t *testing.T) {
+			got, undefined := interpolate(tc.s, vars)
+			if got != tc.want || !reflect.DeepEqual(undefined, tc.undefined) {
+				t.Errorf("expected %q undefined %v, got %q undefined %v", tc.want, tc.undefined, got, undefined)
+			}
+		})
+	}
+}
+
+func TestWorkflowVars(t *testing.T) {
+	defer cleanTestData(t)
+	yamlPath := writeTestYaml(t, "WorkflowVars", `
+workflow_dir: .
+vars:
+  name: yaml
+  out: greeting.txt
+  dir: greetings
+jobs:
+- cmd: echo hello ${name} > ${dir}/${out}
+  directories: [ "${dir}" ]
+  outputs: [ "${dir}/${out}" ]
+`)
+	wf, err := workflowFromYamlVars(yamlPath, "", "", map[string]string{"name": "cli"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := wf.Jobs[0]
+	if j.Cmd != "echo hello cli > greetings/greeting.txt" {
+		t.Errorf("expected vars substituted into cmd with the cli overriding the yaml, got %q", j.Cmd)
+	}
+	if !reflect.DeepEqual(j.Directories, []string{"greetings"}) || !reflect.DeepEqual(j.Outputs, []string{"greetings/greeting.txt"}) {
+		t.Errorf("expected vars substituted into directories and outputs, got %v and %v", j.Directories, j.Outputs)
+	}
+	expectZero(t, wf.Run())
+	got, err := ioutil.ReadFile(wf.pathToWDir("greetings", "greeting.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello cli\n" {
+		t.Errorf("expected output 'hello cli', got %q", string(got))
+	}
+
+	_, err = workflowFromYaml(writeTestYaml(t, "UndefinedVar", `
+workflow_dir: .
+jobs:
+- cmd: echo ${missing}
+`), "")
+	want := SpecErrors{{"jobs[0].cmd", "undefined variable 'missing'"}}
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("expected %v, got %v", want, err)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// defaultDebounce is how long watch waits after the last change before rerunning
+const defaultDebounce = 500 * time.Millisecond
+
+// pathsFlag is a repeatable command line flag collecting paths
+type pathsFlag []string
+
+func (p *pathsFlag) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *pathsFlag) Set(s string) error {
+	*p = append(*p, s)
+	return nil
+}
+
+// Watch runs the workflow, then reruns it whenever the Inputs of its jobs, or any of paths, change.
+// Changes are collected until none happen for debounce. Only the jobs with a changed input,
+// the jobs depending on them and the jobs that did not succeed in the last run are run again,
+// a change to one of paths reruns every job that is not up to date.
+// Watch returns the exit status of the last run on SIGINT or SIGTERM
+func (w *Workflow) Watch(paths []string, debounce time.Duration) int {
+	status := w.Run()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		w.logger.Errorf(0, "Failed watching files: %v", err)
+		return status
+	}
+	defer watcher.Close()
+	watched := map[string]bool{}
+	for _, p := range w.watchPaths(paths) {
+		// the dir is watched too, so files replaced by renaming are still seen
+		for _, dir := range []string{p, filepath.Dir(p)} {
+			if info, err := os.Stat(dir); err == nil && info.IsDir() && !watched[dir] {
+				watched[dir] = true
+				if err := watcher.Add(dir); err != nil {
+					w.logger.Errorf(0, "Failed watching %s: %v", dir, err)
+				}
+			}
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	changes := make(chan string)
+	go func() {
+		defer close(changes)
+		for {
+			select {
+			case e, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if e.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0 {
+					changes <- filepath.Clean(e.Name)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				w.logger.Errorf(0, "Failed watching files: %v", err)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	w.logger.Infof(0, "Watching for changes to %d paths", len(watched))
+	return w.watchChanges(changes, paths, debounce, status)
+}
+
+// watchChanges reruns the workflow for the paths received from changes once debounce passes
+// without another change, until changes is closed. status is that of the first run
+func (w *Workflow) watchChanges(changes <-chan string, paths []string, debounce time.Duration, status int) int {
+	pending := map[string]bool{}
+	var settle <-chan time.Time
+	for {
+		select {
+		case p, ok := <-changes:
+			if !ok {
+				if len(pending) > 0 {
+					status = w.rerun(pending, paths)
+				}
+				return status
+			}
+			if w.isWatched(p, paths) {
+				pending[p] = true
+				settle = w.after(debounce)
+			}
+		case <-settle:
+			status = w.rerun(pending, paths)
+			pending, settle = map[string]bool{}, nil
+		}
+	}
+}
+
+// watchPaths returns the absolute paths of the job Inputs and paths
+func (w *Workflow) watchPaths(paths []string) []string {
+	watch := []string{}
+	for _, j := range w.allJobs() {
+		for _, f := range j.Inputs {
+			watch = append(watch, filepath.Clean(j.pathToOutput(f)))
+		}
+	}
+	for _, p := range paths {
+		if abs, err := filepath.Abs(p); err == nil {
+			watch = append(watch, abs)
+		}
+	}
+	return watch
+}
+
+// isWatched reports whether p is one of the watch paths or inside one of them
+func (w *Workflow) isWatched(p string, paths []string) bool {
+	for _, watched := range w.watchPaths(paths) {
+		if within(p, watched) {
+			return true
+		}
+	}
+	return false
+}
+
+func within(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// rerun runs the workflow again for the changed paths
+func (w *Workflow) rerun(changed map[string]bool, paths []string) int {
+	w.rerunJobs = w.affectedJobs(changed, paths)
+	defer func() { w.rerunJobs = nil }()
+	w.logger.Infof(0, "Watch: %d paths changed, rerunning", len(changed))
+	return w.Run()
+}
+
+// affectedJobs returns the jobs to run again after the changed paths changed: those with a changed input,
+// the jobs depending on them and the jobs that did not succeed. It returns nil, to run every job
+// that is not up to date, if one of paths changed
+func (w *Workflow) affectedJobs(changed map[string]bool, paths []string) map[*Job]bool {
+	for p := range changed {
+		for _, watched := range paths {
+			if abs, err := filepath.Abs(watched); err == nil && within(p, abs) {
+				return nil
+			}
+		}
+	}
+	jobs := w.allJobs()
+	affected := map[*Job]bool{}
+	for _, j := range jobs {
+		if j.Status != StatusSucceeded {
+			affected[j] = true
+		}
+		for _, f := range j.Inputs {
+			input := filepath.Clean(j.pathToOutput(f))
+			for p := range changed {
+				if within(p, input) {
+					affected[j] = true
+				}
+			}
+		}
+	}
+	// jobs are sorted after their dependencies
+	sorted, err := w.sortJobs()
+	if err != nil {
+		return affected
+	}
+	for _, j := range sorted {
+		for _, d := range j.Dependencies {
+			if affected[d] {
+				affected[j] = true
+			}
+		}
+	}
+	return affected
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchRerunsAffectedJobs(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "WatchRerunsAffectedJobs")
+	input := wf.pathToWDir("in.txt")
+	if err := ioutil.WriteFile(input, []byte("one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	build := newJob(wf, []string{}, []*Job{}, []string{"build.out"}, false, "cat in.txt > build.out")
+	build.Inputs = []string{"in.txt"}
+	dependent := newJob(wf, []string{}, []*Job{build}, []string{}, false, "cat build.out >> dependent.log")
+	unrelated := newJob(wf, []string{}, []*Job{}, []string{}, false, "echo ran >> unrelated.log")
+	wf.AddJob(dependent, unrelated)
+	expectZero(t, wf.Run())
+
+	if err := ioutil.WriteFile(input, []byte("two\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changes := make(chan string, 3)
+	// rapid changes are debounced into one rerun
+	changes <- input
+	changes <- input
+	changes <- wf.pathToWDir("not-an-input.txt")
+	close(changes)
+	expectZero(t, wf.watchChanges(changes, nil, time.Hour, 0))
+
+	for logName, want := range map[string]string{"dependent.log": "one\ntwo\n", "unrelated.log": "ran\n"} {
+		got, err := ioutil.ReadFile(wf.pathToWDir(logName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("expected %s to contain %q after the change, got %q", logName, want, string(got))
+		}
+	}
+	if unrelated.Status != StatusSucceeded || unrelated.Attempts != 0 {
+		t.Errorf("expected the unrelated job not to rerun, got %s after %d attempts", unrelated.Status, unrelated.Attempts)
+	}
+}
+
+func TestWatchDebounce(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "WatchDebounce")
+	settle := make(chan time.Time)
+	wf.after = func(time.Duration) <-chan time.Time { return settle }
+	j := newJob(wf, []string{}, []*Job{}, []string{}, false, "echo ran >> runs.log")
+	wf.AddJob(j)
+	watched := wf.pathToWDir("watched")
+
+	changes := make(chan string)
+	status := make(chan int)
+	go func() { status <- wf.watchChanges(changes, []string{watched}, time.Second, 0) }()
+	changes <- watched + "/a.txt"
+	changes <- watched + "/b.txt"
+	settle <- time.Now()
+	changes <- watched
+	settle <- time.Now()
+	close(changes)
+	expectZero(t, <-status)
+
+	runs, err := ioutil.ReadFile(wf.pathToWDir("runs.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(runs), "ran\n"); n != 2 {
+		t.Errorf("expected a rerun for each settled batch of changes, got %d runs", n)
+	}
+}
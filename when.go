@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// condition is a parsed When expression, one of
+//
+//	env:NAME              NAME is set and not empty
+//	env:NAME == "value"   NAME is set to value
+//	env:NAME != "value"   NAME is not set to value
+//	exists:PATH           PATH exists, relative paths are in the job's work dir
+type condition struct {
+	kind  string
+	name  string
+	op    string
+	value string
+}
+
+func parseWhen(expr string) (*condition, error) {
+	expr = strings.TrimSpace(expr)
+	switch {
+	case strings.HasPrefix(expr, "exists:"):
+		p := strings.TrimSpace(strings.TrimPrefix(expr, "exists:"))
+		if p == "" {
+			return nil, fmt.Errorf("invalid condition '%s': exists needs a path", expr)
+		}
+		return &condition{kind: "exists", name: p}, nil
+	case strings.HasPrefix(expr, "env:"):
+		fields := strings.Fields(strings.TrimPrefix(expr, "env:"))
+		switch {
+		case len(fields) == 1:
+			return &condition{kind: "env", name: fields[0]}, nil
+		case len(fields) >= 3 && (fields[1] == "==" || fields[1] == "!="):
+			rest := strings.TrimSpace(strings.SplitN(expr, fields[1], 2)[1])
+			value, err := strconv.Unquote(rest)
+			if err != nil {
+				return nil, fmt.Errorf("invalid condition '%s': value must be a quoted string", expr)
+			}
+			return &condition{kind: "env", name: fields[0], op: fields[1], value: value}, nil
+		}
+		return nil, fmt.Errorf("invalid condition '%s': expected env:NAME, env:NAME == \"value\" or env:NAME != \"value\"", expr)
+	}
+	return nil, fmt.Errorf("invalid condition '%s': expected env: or exists:", expr)
+}
+
+// evalWhen reports whether the job's When condition holds, an empty When always holds
+func (j *Job) evalWhen() (bool, error) {
+	if j.When == "" {
+		return true, nil
+	}
+	c, err := parseWhen(j.When)
+	if err != nil {
+		return false, err
+	}
+	if c.kind == "exists" {
+		p := c.name
+		if !path.IsAbs(p) {
+			p = path.Join(j.workDir(), p)
+		}
+		_, err := os.Stat(p)
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	value, set := "", false
+	prefix := c.name + "="
+	for _, kv := range j.environ() {
+		if strings.HasPrefix(kv, prefix) {
+			value, set = strings.TrimPrefix(kv, prefix), true
+		}
+	}
+	switch c.op {
+	case "==":
+		return set && value == c.value, nil
+	case "!=":
+		return !set || value != c.value, nil
+	}
+	return value != "", nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseWhen(t *testing.T) {
+	testCases := []struct {
+		expr    string
+		want    condition
+		wantErr bool
+	}{
+		{`env:DEPLOY`, condition{kind: "env", name: "DEPLOY"}, false},
+		{`env:DEPLOY == "true"`, condition{kind: "env", name: "DEPLOY", op: "==", value: "true"}, false},
+		{`env:STAGE != "prod env"`, condition{kind: "env", name: "STAGE", op: "!=", value: "prod env"}, false},
+		{`exists:out/done.txt`, condition{kind: "exists", name: "out/done.txt"}, false},
+		{`env:DEPLOY == true`, condition{}, true},
+		{`env:DEPLOY =~ "t"`, condition{}, true},
+		{`exists:`, condition{}, true},
+		{`DEPLOY`, condition{}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			got, err := parseWhen(tc.expr)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected an error parsing '%s'", tc.expr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tc.want {
+				t.Errorf("expected %+v, got %+v", tc.want, *got)
+			}
+		})
+	}
+}
+
+func TestWhenCondition(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "WhenCondition")
+	wf.Env = map[string]string{"DEPLOY": "true"}
+	deploy := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	deploy.When = `env:DEPLOY == "true"`
+	skipped := newJob(wf, []string{}, []*Job{}, []string{}, false, "false")
+	skipped.When = "exists:never.txt"
+	after := newJob(wf, []string{}, []*Job{deploy, skipped}, []string{}, false, "true")
+	wf.AddJob(after)
+	expectZero(t, wf.Run())
+
+	if deploy.Status != StatusSucceeded || deploy.Attempts != 1 {
+		t.Errorf("expected job with a true condition to run, got %s", deploy.Status)
+	}
+	if skipped.Status != StatusSkipped || skipped.Attempts != 0 {
+		t.Errorf("expected job with a false condition to be skipped, got %s", skipped.Status)
+	}
+	if want := "condition false: exists:never.txt"; skipped.Reason != want {
+		t.Errorf("expected reason '%s', got '%s'", want, skipped.Reason)
+	}
+	if after.Status != StatusSucceeded {
+		t.Errorf("expected dependent of a job skipped by its condition to run, got %s", after.Status)
+	}
+	if events := jobEvents(t, wf)[skipped.ID]; events[EventSkipped].Type != EventSkipped {
+		t.Error("expected a skipped event for the job with a false condition")
+	}
+}
@@ -1,47 +1,199 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	// "fmt"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/ghodss/yaml"
 )
 
+// Exit statuses of a workflow run and of gflow
 const (
+	// ExitSuccess indicates that every job succeeded, was up to date or was skipped by its condition
+	ExitSuccess int = iota
 	// ExitJobsFailed indicates that one or more jobs failed
-	ExitJobsFailed int = 1 + iota
+	ExitJobsFailed
+	// ExitInvalidWorkflow indicates that the workflow failed validation
+	ExitInvalidWorkflow
+	// ExitInterrupted indicates that the workflow was stopped by a signal
+	ExitInterrupted
+	// ExitUsage indicates that gflow was invoked incorrectly
+	ExitUsage
+	// ExitTimeout indicates that the workflow ran past its Timeout and was stopped
+	ExitTimeout
 )
 
+// defaultGracePeriod is how long an interrupted job has to exit after SIGTERM before it is killed
+const defaultGracePeriod = 5 * time.Second
+
 // The Workflow type abstracts the entrypoint of a given workflow
 // It manages jobs, both launching them and waiting for them to finish
 // When jobs fail, it infers the errors and returns a nonzero exit status
 // A Workflow dir will contain logs, scripts, and the PATH of the process
 type Workflow struct {
+	// WorkflowDir is relative to the directory of the yaml file it is set in
 	WorkflowDir string `json:"workflow_dir"`
-	LogDir      string `json:"log_dir"`
-	ExecDir     string `json:"exec_dir"`
-	TmpDir      string `json:"tmp_dir"`
-	WFJsonPath  string `json:"wf_json_path"`
-	Jobs        []*Job `json:"jobs"`
+	// StateDir keeps the logs, scripts, tmp dirs, workflow json and event DB, by default .gflow
+	// in the workflow dir. A relative StateDir is relative to the workflow dir
+	StateDir     string `json:"state_dir"`
+	LogDir       string `json:"log_dir"`
+	ExecDir      string `json:"exec_dir"`
+	TmpDir       string `json:"tmp_dir"`
+	ArtifactsDir string `json:"artifacts_dir"`
+	// CacheDir holds the outputs of succeeded jobs, relative to the workflow dir. Jobs are not cached when it is empty
+	CacheDir   string `json:"cache_dir,omitempty"`
+	WFJsonPath string `json:"wf_json_path"`
+	// CombinedLog gets the output and log messages of every job as they happen, stamped and prefixed with the job
+	CombinedLog string `json:"combined_log,omitempty"`
+	EventDBPath string `json:"event_db_path"`
+	// HistoryPath keeps the start, exit status and duration of the last runs
+	HistoryPath string `json:"history_path,omitempty"`
+	// ReportPath gets the status and outcome of each job once a run finishes
+	ReportPath string `json:"report_path,omitempty"`
+	// OutputsPath records every output declared by the runs of the workflow, so gc finds those of removed jobs
+	OutputsPath string `json:"outputs_path,omitempty"`
+	// EnvPath records the PATH when a run starts, or with RecordEnv the whole environment, secrets redacted
+	EnvPath   string `json:"env_path,omitempty"`
+	RecordEnv bool   `json:"record_env,omitempty"`
+	// MaxParallel bounds how many jobs execute at once, 0 means unlimited
+	MaxParallel int `json:"max_parallel"`
+	// MaxRetriesCap bounds the Retries of every job, 0 means the default of 100
+	MaxRetriesCap int `json:"max_retries_cap,omitempty"`
+	// Timeout stops the running jobs of a workflow running past it, and starts no more
+	Timeout Duration `json:"timeout"`
+	// DirMode and FileMode are the permissions of what gflow creates, by default 0755 and 0644
+	DirMode  Mode `json:"dir_mode,omitempty"`
+	FileMode Mode `json:"file_mode,omitempty"`
+	// Shell runs the cmd of jobs without their own Shell, such as "python -c". By default cmds are bash scripts
+	Shell string `json:"shell,omitempty"`
+	// Env is set in the environment of every job, jobs may override it with their own Env
+	Env map[string]string `json:"env,omitempty"`
+	// Vars are substituted for ${name} in the cmd, directories, inputs and outputs of jobs, $$ escapes a $
+	Vars map[string]string `json:"vars,omitempty"`
+	// Secrets are read from SecretsFile or else the environment when Run starts, and redacted from logs and json
+	Secrets     []string `json:"secrets,omitempty"`
+	SecretsFile string   `json:"secrets_file,omitempty"`
+	// DryRun prints the jobs that would execute instead of executing them
+	DryRun bool `json:"dry_run,omitempty"`
+	// Explain prints whether each job would run, be skipped or wait for a dependency, and why
+	Explain bool `json:"explain,omitempty"`
+	// Resume does not run again the jobs that succeeded in a previous run
+	Resume bool `json:"resume,omitempty"`
+	// NoEventDB records no events, so the run cannot be resumed and status shows it once it has finished
+	NoEventDB bool `json:"no_event_db,omitempty"`
+	// QuietSuccess holds back the messages of a run and logs them only when it exits nonzero
+	QuietSuccess bool `json:"quiet_on_success,omitempty"`
+	// Once a job fails no more jobs are started, with KeepGoing only the dependents of a failed job are skipped
+	KeepGoing bool `json:"keep_going,omitempty"`
+	// FailFast cancels the running jobs as soon as a job fails
+	FailFast bool `json:"fail_fast,omitempty"`
+	// MaxFailures keeps going until that many jobs have failed, then fails fast. 0 leaves it to KeepGoing and FailFast
+	MaxFailures int `json:"max_failures,omitempty"`
+	// Stream writes job output to the console as well, each line prefixed with its job
+	Stream bool `json:"stream,omitempty"`
+	// Progress logs only errors and prints a summary line of the jobs instead
+	Progress bool `json:"progress,omitempty"`
+	// Only selects jobs by comma separated Names, globs of Names or IDs, along with their dependencies
+	Only string `json:"only,omitempty"`
+	// Stages orders the stages of jobs, every job of a stage depends on all jobs of the stage before it
+	Stages []string `json:"stages,omitempty"`
+	// Tags are added to every job. OnlyTags selects the jobs with any of them, with TagsStrict
+	// treating their other dependencies as satisfied
+	Tags       []string `json:"tags,omitempty"`
+	OnlyTags   []string `json:"only_tags,omitempty"`
+	TagsStrict bool     `json:"tags_strict,omitempty"`
+	// Labels are recorded in the event DB with the start of each run
+	Labels map[string]string `json:"labels,omitempty"`
+	// MetricsAddr serves Prometheus metrics at /metrics while Run runs
+	MetricsAddr string `json:"metrics_addr,omitempty"`
+	// ServeAddr serves the live state of each job as json at /api/jobs while Run runs
+	ServeAddr string `json:"serve_addr,omitempty"`
+	// Include lists yaml files, relative to the including file, whose jobs are added to the workflow's own jobs
+	Include       []string      `json:"include,omitempty"`
+	SSH           SSHConfig     `json:"ssh"`
+	Hooks         Hooks         `json:"hooks"`
+	Notifications Notifications `json:"notifications"`
+	Jobs          []*Job        `json:"jobs"`
+	// Executor runs the jobs' commands, by default as local processes
+	Executor Executor `json:"-"`
+	// Notifiers are told the events of a run along with those configured by Notifications
+	Notifiers []Notifier `json:"-"`
 
 	currentJobID int
+	hookFailed   int32
+	failures     int32
 	jobIDLock    *sync.Mutex
 	failedJobs   *failedJobs
+	notifying    *sync.WaitGroup
+	eventDB      eventSink
+	slots        *slotQueue
+	locks        map[string]*slotQueue
+	gracePeriod  time.Duration
+	stdout       io.Writer
+	stderr       io.Writer
+	streamLock   *sync.Mutex
+	combined     *combinedLog
+	runID        string
+	after        func(time.Duration) <-chan time.Time
+	randInt63n   func(int64) int64
+	metrics      *metrics
+	states       *jobStates
+	secrets      map[string]string
+	rerunJobs    map[*Job]bool
+	scheduling   context.Context
+	stopSchedule context.CancelFunc
+	cancelJobs   context.CancelCauseFunc
+	logger       *logger
 }
 
-// func (w *Workflow) InitFlags() {
-// 	// TODO: add flag parsing here
-// }
+func (w *Workflow) initWorkflow() error {
+	err := w.checkWritable()
+	if err != nil {
+		return err
+	}
+	return w.createWorkflowDirs()
+}
 
-func (w *Workflow) initWorkflow() {
-	w.createWorkflowDirs()
+// checkWritable returns an error naming the first of the workflow dir and its .gflow dirs that
+// cannot be written, or cannot be created because its nearest existing parent cannot be written
+func (w *Workflow) checkWritable() error {
+	for _, d := range []string{w.WorkflowDir, path.Dir(w.ExecDir), w.ExecDir, w.LogDir} {
+		existing := d
+		info, err := os.Stat(existing)
+		for (os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR)) && existing != path.Dir(existing) {
+			existing = path.Dir(existing)
+			info, err = os.Stat(existing)
+		}
+		if err == nil && !info.IsDir() {
+			err = fmt.Errorf("%s is not a directory", existing)
+		}
+		if err == nil {
+			var f *os.File
+			f, err = ioutil.TempFile(existing, ".gflow-write-check")
+			if err == nil {
+				f.Close()
+				os.Remove(f.Name())
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("workflow dir %s is not writable: %v", d, err)
+		}
+	}
+	return nil
 }
 
 // AddJob adds a job or list of jobs to a workflow
@@ -53,26 +205,24 @@ func (w *Workflow) pathToWDir(s ...string) string {
 	return path.Join(append([]string{w.WorkflowDir}, s...)...)
 }
 
-func (w *Workflow) createWorkflowDirs() {
-	// TODO: where do responsibilities stop?
-	// _, err := os.Stat(w.WorkflowDir)
-	// if err != nil {
-	// 	if os.IsNotExist(err) {
-	// 		err = os.Mkdir(w.WorkflowDir, 0775)
-	// 		if err != nil {
-	// 			log.Fatal(err)
-	// 		}
-	// 		return
-	// 	}
-	// 	log.Fatal(err)
-	// }
-
+func (w *Workflow) createWorkflowDirs() error {
 	for _, d := range []string{w.WorkflowDir, w.ExecDir, w.LogDir} {
-		err := os.MkdirAll(d, 0755)
+		err := os.MkdirAll(d, w.dirMode())
+		if err != nil {
+			return err
+		}
+	}
+	if w.DirMode == 0 {
+		return nil
+	}
+	// the .gflow dirs may have been created before DirMode was set
+	for _, d := range []string{path.Dir(w.ExecDir), w.ExecDir, w.LogDir} {
+		err := os.Chmod(d, w.dirMode())
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 	}
+	return nil
 }
 
 func (w *Workflow) incrementCurrentJobID() int {
@@ -82,99 +232,685 @@ func (w *Workflow) incrementCurrentJobID() int {
 	return w.currentJobID
 }
 
-func newWorkflow(wfDir string) *Workflow {
+func newWorkflow(wfDir string) (*Workflow, error) {
+	return newWorkflowState(wfDir, "")
+}
+
+// newWorkflowState creates a workflow in wfDir keeping its state in stateDir, relative to wfDir,
+// or in wfDir/.gflow if stateDir is empty
+func newWorkflowState(wfDir, stateDir string) (*Workflow, error) {
 	absWfDir, err := filepath.Abs(wfDir)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	if stateDir == "" {
+		stateDir = ".gflow"
 	}
-	logDir := path.Join(absWfDir, ".gflow", "log")
-	execDir := path.Join(absWfDir, ".gflow", "exec")
-	tmpDir := path.Join(absWfDir, ".gflow", "tmp")
-	wfJSONPath := path.Join(absWfDir, ".gflow", "wf.json")
+	if !filepath.IsAbs(stateDir) {
+		stateDir = path.Join(absWfDir, stateDir)
+	}
+	logDir := path.Join(stateDir, "log")
+	execDir := path.Join(stateDir, "exec")
+	tmpDir := path.Join(stateDir, "tmp")
+	artifactsDir := path.Join(stateDir, "artifacts")
+	wfJSONPath := path.Join(stateDir, "wf.json")
+	eventDBPath := path.Join(stateDir, "event.db")
+	historyPath := path.Join(stateDir, "history.json")
+	reportPath := path.Join(stateDir, "run-report.json")
+	envPath := path.Join(stateDir, "env.json")
+	outputsPath := path.Join(stateDir, "outputs.json")
 
 	wf := &Workflow{
-		absWfDir, logDir, execDir, tmpDir, wfJSONPath,
-		[]*Job{}, 0, &sync.Mutex{}, newFailedJobs(),
+		WorkflowDir:  absWfDir,
+		StateDir:     path.Clean(stateDir),
+		LogDir:       logDir,
+		ExecDir:      execDir,
+		TmpDir:       tmpDir,
+		ArtifactsDir: artifactsDir,
+		WFJsonPath:   wfJSONPath,
+		CombinedLog:  path.Join(logDir, "workflow.log"),
+		EventDBPath:  eventDBPath,
+		HistoryPath:  historyPath,
+		ReportPath:   reportPath,
+		EnvPath:      envPath,
+		OutputsPath:  outputsPath,
+		Jobs:         []*Job{},
+		Executor:     LocalExecutor{},
+		jobIDLock:    &sync.Mutex{},
+		failedJobs:   newFailedJobs(),
+		gracePeriod:  defaultGracePeriod,
+		stdout:       os.Stdout,
+		stderr:       os.Stderr,
+		streamLock:   &sync.Mutex{},
+		after:        time.After,
+		logger:       newLogger(os.Stderr, LogFormatText),
+	}
+	err = wf.initWorkflow()
+	if err != nil {
+		return nil, err
 	}
-	wf.createWorkflowDirs()
-	return wf
+	return wf, nil
 }
 
-func (w *Workflow) inferExitStatus() int {
-	numberFailedJobs := len(w.failedJobs.jobs)
-	if numberFailedJobs > 0 {
-		log.Println("Error:", strconv.Itoa(numberFailedJobs), "jobs failed")
-		return ExitJobsFailed
+// inferExitStatus logs a summary of each failed job and returns the exit status of the run
+// whose jobs ran with ctx, preferring the most severe outcome: ExitInterrupted if the run was
+// stopped by a signal, then ExitTimeout if it ran past its Timeout, then ExitJobsFailed
+// if any job failed or was skipped because a dependency failed, and otherwise ExitSuccess
+func (w *Workflow) inferExitStatus(ctx context.Context) int {
+	status := ExitSuccess
+	if failures := w.failedJobs.List(); len(failures) > 0 {
+		w.logFailures(failures)
+		status = ExitJobsFailed
+	}
+	switch ctx.Err() {
+	case context.Canceled:
+		return ExitInterrupted
+	case context.DeadlineExceeded:
+		return ExitTimeout
+	}
+	return status
+}
+
+// logFailures logs why each job failed and how many failed, not counting skipped dependents
+func (w *Workflow) logFailures(failures []jobFailure) {
+	numberFailedJobs := 0
+	for _, f := range failures {
+		if f.Reason != FailureSkippedDependency {
+			numberFailedJobs++
+		}
+		w.logger.Errorf(f.Job.ID, "Failure: %s: %s: exit code: %d: stderr log: %s", f.Reason, f.Detail, f.ExitCode, f.StderrLog)
 	}
-	return 0
+	w.logger.Errorf(0, "Error: %d jobs failed", numberFailedJobs)
 }
 
-func (w *Workflow) writeWorkflowJSON() {
-	f, err := os.Create(w.WFJsonPath)
+func (w *Workflow) writeWorkflowJSON() error {
+	wfJSON, err := json.MarshalIndent(w, "", "  ")
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	tmp := w.WFJsonPath + ".tmp"
+	err = ioutil.WriteFile(tmp, []byte(w.redact(string(wfJSON))+"\n"), w.fileMode())
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.WFJsonPath)
+}
+
+// printPlan writes the jobs in the order they are scheduled,
+// with their command, directories and dependencies
+func (w *Workflow) printPlan(jobs []*Job) {
+	fmt.Fprintf(w.stdout, "Plan: %d jobs\n", len(jobs))
+	for _, j := range jobs {
+		dirs := []string{}
+		for _, d := range j.Directories {
+			dirs = append(dirs, w.pathToWDir(d))
+		}
+		deps := []string{}
+		for _, d := range j.Dependencies {
+			deps = append(deps, strconv.Itoa(d.ID))
+		}
+		fmt.Fprintf(w.stdout, "job_id:%d\n", j.ID)
+		fmt.Fprintf(w.stdout, "  cmd: %s\n", j.Cmd)
+		fmt.Fprintf(w.stdout, "  directories: %s\n", listOrNone(dirs))
+		fmt.Fprintf(w.stdout, "  dependencies: %s\n", listOrNone(deps))
+	}
+}
+
+// errFailFast is the cause of the running jobs being cancelled once a job has failed with FailFast set,
+// or once MaxFailures jobs have failed
+var errFailFast = errors.New("another job failed")
+
+// stopScheduling stops jobs from starting once a job has failed, unless KeepGoing is set.
+// With FailFast the running jobs are cancelled too.
+// With MaxFailures set, jobs keep being started until that many have failed, then the running jobs are cancelled
+func (w *Workflow) stopScheduling() {
+	if w.MaxFailures > 0 {
+		if failed := int(atomic.AddInt32(&w.failures, 1)); failed == w.MaxFailures {
+			w.logger.Errorf(0, "Workflow Stopping: %d jobs failed, max_failures is %d", failed, w.MaxFailures)
+			w.cancelJobs(errFailFast)
+			w.stopSchedule()
+		}
+		return
+	}
+	if w.FailFast {
+		w.cancelJobs(errFailFast)
+	}
+	if !w.KeepGoing {
+		w.stopSchedule()
 	}
-	defer f.Close()
-	enc := json.NewEncoder(f)
-	enc.SetIndent("", "  ")
-	if enc.Encode(w); err != nil {
-		log.Fatal(err)
+}
+
+// cancelledFast reports whether ctx of a job was cancelled because another job failed with FailFast set
+func cancelledFast(ctx context.Context) bool {
+	return context.Cause(ctx) == errFailFast
+}
+
+// schedulingStopped reports whether a job failed and no more jobs are started
+func (w *Workflow) schedulingStopped() bool {
+	return w.scheduling.Err() != nil
+}
+
+func listOrNone(l []string) string {
+	if len(l) == 0 {
+		return "none"
 	}
+	return strings.Join(l, ", ")
 }
 
 // Run runs the workflow, which has a dependency tree of jobs
-// Run initializes each job in order of dependency, then executes
-// each job until everything returns. The exit status is then inferred,
+// Run validates the workflow, then initializes each job in order of dependency
+// and starts them all; each job waits for its dependencies to succeed before
+// executing. Once everything returns the exit status is inferred,
 // and the workflow JSON file is written to the filesystem.
+// On SIGINT or SIGTERM, or once the workflow Timeout passes, no more jobs are started,
+// running jobs are terminated and the workflow JSON records which jobs were interrupted.
+// The exit status is one of the Exit constants, ExitInvalidWorkflow if the jobs could not be run
 func (w *Workflow) Run() int {
-	w.initWorkflow()
-	wg := &sync.WaitGroup{}
+	if !w.QuietSuccess {
+		return w.run()
+	}
+	w.logger.hold()
+	exitStatus := w.run()
+	w.logger.release(exitStatus != ExitSuccess)
+	return exitStatus
+}
 
-	for _, j := range w.Jobs {
+// run runs the workflow for Run, logging as it goes
+func (w *Workflow) run() int {
+	if w.KeepGoing && w.FailFast {
+		w.logger.Errorf(0, "Invalid workflow: keep_going and fail_fast cannot both be set")
+		return ExitInvalidWorkflow
+	}
+	if w.MaxFailures > 0 && w.FailFast {
+		w.logger.Errorf(0, "Invalid workflow: max_failures and fail_fast cannot both be set")
+		return ExitInvalidWorkflow
+	}
+	runID, err := newRunID()
+	if err != nil {
+		w.logger.Errorf(0, "Failed generating run id: %v", err)
+		return ExitInvalidWorkflow
+	}
+	w.runID = runID
+	sorted, err := w.sortJobs()
+	if err != nil {
+		w.logger.Errorf(0, "Invalid workflow: %v", err)
+		return ExitInvalidWorkflow
+	}
+	err = outputConflict(sorted)
+	if err != nil {
+		w.logger.Errorf(0, "Invalid workflow: %v", err)
+		return ExitInvalidWorkflow
+	}
+	jobs := sorted
+	if w.Only != "" {
+		jobs, err = onlyJobs(jobs, w.Only)
+		if err != nil {
+			w.logger.Errorf(0, "Invalid workflow: %v", err)
+			return ExitInvalidWorkflow
+		}
+	}
+	if len(w.OnlyTags) > 0 {
+		jobs, err = w.taggedJobs(jobs)
+		if err != nil {
+			w.logger.Errorf(0, "Invalid workflow: %v", err)
+			return ExitInvalidWorkflow
+		}
+	}
+	unselect(sorted, jobs)
+	if w.Explain {
+		w.printExplanations(jobs)
+	}
+	if w.DryRun {
+		w.printPlan(jobs)
+		return ExitSuccess
+	}
+	err = w.loadSecrets()
+	if err != nil {
+		w.logger.Errorf(0, "Invalid workflow: %v", err)
+		return ExitInvalidWorkflow
+	}
+	start := time.Now()
+	err = w.initWorkflow()
+	if err != nil {
+		w.logger.Errorf(0, "Failed initializing workflow: %v", err)
+		return ExitInvalidWorkflow
+	}
+	err = w.recordEnv()
+	if err != nil {
+		w.logger.Errorf(0, "Failed recording environment: %v", err)
+	}
+	err = w.recordOutputs()
+	if err != nil {
+		w.logger.Errorf(0, "Failed recording outputs: %v", err)
+	}
+	if w.CombinedLog != "" {
+		w.combined, err = openCombinedLog(w.CombinedLog, w.fileMode())
+		if err != nil {
+			w.logger.Errorf(0, "Failed opening combined log: %v", err)
+			return ExitInvalidWorkflow
+		}
+		w.logger.combined = w.combined
+		defer func() {
+			w.logger.combined = nil
+			err := w.combined.Close()
+			w.combined = nil
+			if err != nil {
+				w.logger.Errorf(0, "Failed writing combined log: %v", err)
+			}
+		}()
+	}
+
+	for _, j := range jobs {
 		err := j.initJob()
 		if err != nil {
-			log.Fatalf("Failed initializing job_id: %d", j.ID)
+			w.logger.Errorf(j.ID, "Failed initializing job: %v", err)
+			return ExitInvalidWorkflow
+		}
+	}
+	hash := structureHash(jobs)
+	if w.Resume {
+		err = w.prepareResume(jobs, hash)
+		if err != nil {
+			w.logger.Errorf(0, "Failed resuming workflow: %v", err)
+			return ExitInvalidWorkflow
 		}
+	}
+	err = w.prepareRecent(jobs)
+	if err != nil {
+		w.logger.Errorf(0, "Failed reading previous runs: %v", err)
+		return ExitInvalidWorkflow
+	}
+	if w.rerunJobs != nil {
+		for _, j := range jobs {
+			j.succeededPreviously = j.succeededPreviously || !w.rerunJobs[j]
+		}
+	}
+
+	// written at the start too, so status and logs find the jobs of a run in progress
+	err = w.writeWorkflowJSON()
+	if err != nil {
+		w.logger.Errorf(0, "Failed writing workflow json: %v", err)
+	}
+	w.eventDB = discardEvents{}
+	if !w.NoEventDB {
+		err = w.setupEventDB()
+		if err != nil {
+			w.logger.Errorf(0, "Failed opening event db: %v", err)
+			return ExitInvalidWorkflow
+		}
+	}
+	defer w.eventDB.Close()
+	err = w.eventDB.record(Event{Type: EventWorkflowStarted, RunID: w.runID, WorkflowHash: hash, Labels: w.Labels})
+	if err != nil {
+		w.logger.Errorf(0, "Failed recording workflow start: %v", err)
+	} else {
+		w.logger.Debugf(0, "Recorded event '%s'", EventWorkflowStarted)
+	}
+
+	w.metrics = newMetrics()
+	if w.MetricsAddr != "" {
+		shutdown, err := w.serveMetrics()
+		if err != nil {
+			w.logger.Errorf(0, "Failed serving metrics: %v", err)
+			return ExitInvalidWorkflow
+		}
+		defer shutdown()
+	}
+	var p *progress
+	if w.Progress {
+		p = newProgress(w.stderr)
+	}
+	w.logger.quiet = w.Progress
+	w.logger.clear = p != nil && p.tty
+	w.states = newJobStates(jobs, p)
+	if w.ServeAddr != "" {
+		shutdown, err := w.serveAPI()
+		if err != nil {
+			w.logger.Errorf(0, "Failed serving job states: %v", err)
+			return ExitInvalidWorkflow
+		}
+		defer shutdown()
+	}
+
+	w.slots = nil
+	if w.MaxParallel > 0 {
+		w.slots = newSlotQueue(w.MaxParallel)
+	}
+	w.locks = newLocks(jobs)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if w.Timeout.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.Timeout.Duration)
+		defer cancel()
+	}
+
+	jobsCtx, cancelJobs := context.WithCancelCause(ctx)
+	w.cancelJobs = cancelJobs
+	defer cancelJobs(nil)
+	w.scheduling, w.stopSchedule = context.WithCancel(jobsCtx)
+	defer w.stopSchedule()
+
+	w.hookFailed = 0
+	w.failures = 0
+	w.notifying = &sync.WaitGroup{}
+	if !w.runHook(hookOnStart, w.Hooks.OnStart) && w.Hooks.FailOnError {
+		w.logger.Errorf(0, "Workflow failed: on_start hook failed: exit status: %d", ExitJobsFailed)
+		return ExitJobsFailed
+	}
+
+	w.logger.Verbosef(0, "Scheduling %d jobs", len(jobs))
+	wg := &sync.WaitGroup{}
+	for _, j := range jobs {
 		wg.Add(1)
-		go j.runJob(wg)
+		go j.runJob(jobsCtx, wg)
 	}
 
 	wg.Wait()
-	w.writeWorkflowJSON()
-	exitStatus := w.inferExitStatus()
-	if exitStatus != 0 {
-		log.Printf("Workflow failed: exit status: %d", exitStatus)
-		return exitStatus
+	err = w.writeWorkflowJSON()
+	if err != nil {
+		w.logger.Errorf(0, "Failed writing workflow json: %v", err)
+	}
+	exitStatus := w.inferExitStatus(ctx)
+	w.runHook(hookOnFinish, w.Hooks.OnFinish, "GFLOW_EXIT_STATUS="+strconv.Itoa(exitStatus))
+	if exitStatus == ExitSuccess && w.hooksFailed() {
+		exitStatus = ExitJobsFailed
+	}
+	err = w.writeRunReport(exitStatus, jobs, start)
+	if err != nil {
+		w.logger.Errorf(0, "Failed writing run report: %v", err)
+	}
+	err = w.recordHistory(start, exitStatus)
+	if err != nil {
+		w.logger.Errorf(0, "Failed recording run history: %v", err)
+	}
+	w.notify(exitStatus, jobs, time.Since(start))
+
+	switch exitStatus {
+	case ExitSuccess:
+		w.logger.Infof(0, "Workflow success")
+	case ExitInterrupted:
+		w.logger.Errorf(0, "Workflow interrupted: exit status: %d", exitStatus)
+	case ExitTimeout:
+		w.logger.Errorf(0, "Workflow timed out after %v: exit status: %d", w.Timeout.Duration, exitStatus)
+	default:
+		w.logger.Errorf(0, "Workflow failed: exit status: %d", exitStatus)
 	}
-	log.Printf("Workflow success")
 	return exitStatus
 }
 
-func addWorkflowBackref(w *Workflow, jobs []*Job) {
+// newJobFromJob resolves a job unmarshalled from yaml into a job owned by w.
+// Dependencies are resolved recursively; jobs with the same id resolve to
+// a single *Job, so a job referenced by more than one parent exists only once.
+// A job in the spec without a cmd refers to the job declared with its id
+func newJobFromJob(w *Workflow, j *Job, declared, resolved map[int]*Job) *Job {
+	if job, ok := resolved[j.ID]; ok {
+		return job
+	}
+	if d, ok := declared[j.ID]; ok {
+		j = d
+	}
+	deps := []*Job{}
+	for _, depJob := range j.Dependencies {
+		deps = append(deps, newJobFromJob(w, depJob, declared, resolved))
+	}
+	job := *j
+	job.workflow = w
+	job.Dependencies = deps
+	resolved[job.ID] = &job
+	return &job
+}
+
+// assignJobIDs gives each job of the spec without an id the next id in topological order,
+// visiting jobs in the order they are declared with every job after the jobs it depends on,
+// so the same spec always yields the same ids. Explicit ids are kept,
+// generated ids start after the largest of them
+func assignJobIDs(jobs []*Job) {
+	byName := map[string][]*Job{}
+	var collect func(jobs []*Job)
+	collect = func(jobs []*Job) {
+		for _, j := range jobs {
+			if j.Name != "" {
+				byName[j.Name] = append(byName[j.Name], j)
+			}
+			if j.matrixName != "" {
+				byName[j.matrixName] = append(byName[j.matrixName], j)
+			}
+			collect(j.Dependencies)
+		}
+	}
+	collect(jobs)
+
+	next := maxJobID(jobs)
+	visited := map[*Job]bool{}
+	var visit func(j *Job)
+	visit = func(j *Job) {
+		if visited[j] {
+			return
+		}
+		visited[j] = true
+		for _, d := range j.Dependencies {
+			visit(d)
+		}
+		for _, name := range append(append(append([]string{}, j.DependsOn...), j.After...), j.StdinFrom) {
+			for _, d := range byName[name] {
+				visit(d)
+			}
+		}
+		if j.ID == 0 {
+			next++
+			j.ID = next
+		}
+	}
 	for _, j := range jobs {
-		j.workflow = w
-		addWorkflowBackref(w, j.Dependencies)
+		visit(j)
+	}
+}
+
+func maxJobID(jobs []*Job) int {
+	max := 0
+	for _, j := range jobs {
+		if j.ID > max {
+			max = j.ID
+		}
+		if depMax := maxJobID(j.Dependencies); depMax > max {
+			max = depMax
+		}
 	}
+	return max
+}
+
+// workflowFromYaml loads the workflow at yamlPath. If workflowDir is not empty
+// it overrides the workflow_dir set in the yaml. The spec is validated
+// with validateSpec before the workflow is created
+func workflowFromYaml(yamlPath, workflowDir string) (*Workflow, error) {
+	return workflowFromYamlVars(yamlPath, workflowDir, "", nil)
 }
 
-func workflowFromYaml(yamlPath string) *Workflow {
+// stdinPath is the yaml path that reads the workflow yaml from stdin
+const stdinPath = "-"
+
+// stdin is read for the workflow yaml when its path is stdinPath
+var stdin io.Reader = os.Stdin
+
+// workflowFromYamlVars loads the workflow yaml at yamlPath, or from stdin if it is "-",
+// with vars overriding those the yaml sets and a stateDir, relative to the current directory,
+// overriding its state_dir. A yamlPath that is an http or https URL is fetched,
+// like yaml from stdin its relative workflow_dir and includes are relative to the current directory
+func workflowFromYamlVars(yamlPath, workflowDir, stateDir string, vars map[string]string) (*Workflow, error) {
+	if yamlPath == stdinPath {
+		return workflowFromReader(stdin, workflowDir, stateDir, vars)
+	}
+	if isRemote(yamlPath) {
+		yamlBytes, err := fetchYaml(yamlPath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading workflow yaml: %v", err)
+		}
+		return workflowFromBytes(yamlBytes, ".", workflowDir, stateDir, vars)
+	}
 	yamlBytes, err := ioutil.ReadFile(yamlPath)
 	if err != nil {
-		log.Fatalf("Error reading workflow yaml: %v\n", err)
+		return nil, fmt.Errorf("error reading workflow yaml: %v", err)
+	}
+	return workflowFromBytes(yamlBytes, path.Dir(yamlPath), workflowDir, stateDir, vars)
+}
+
+// workflowFromReader loads a workflow yaml read from r. A relative workflow_dir
+// is relative to the current directory and so are its includes
+func workflowFromReader(r io.Reader, workflowDir, stateDir string, vars map[string]string) (*Workflow, error) {
+	yamlBytes, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading workflow yaml: %v", err)
+	}
+	return workflowFromBytes(yamlBytes, ".", workflowDir, stateDir, vars)
+}
+
+// workflowFromBytes loads a workflow yaml, whose includes and relative workflow_dir are relative
+// to includeDir. A workflowDir overriding the workflow_dir and a stateDir overriding the state_dir
+// are relative to the current directory
+func workflowFromBytes(yamlBytes []byte, includeDir, workflowDir, stateDir string, vars map[string]string) (*Workflow, error) {
+	var spec Workflow
+	err := yaml.Unmarshal(yamlBytes, &spec)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling workflow: %v", err)
+	}
+	if workflowDir != "" {
+		spec.WorkflowDir = workflowDir
 	}
-	var w Workflow
-	err = yaml.Unmarshal(yamlBytes, &w)
+	if stateDir != "" {
+		spec.StateDir, err = filepath.Abs(stateDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = includeJobs(&spec, includeDir)
 	if err != nil {
-		log.Fatalf("Error unmarshalling workflow: %v\n", err)
+		return nil, err
 	}
-	w.currentJobID = 0
-	w.jobIDLock = &sync.Mutex{}
-	w.failedJobs = newFailedJobs()
-	addWorkflowBackref(&w, w.Jobs)
-	return &w
+	errs := expandMatrix(&spec)
+	errs = append(errs, substituteVars(&spec, vars)...)
+	if workflowDir == "" && spec.WorkflowDir != "" && !filepath.IsAbs(spec.WorkflowDir) {
+		spec.WorkflowDir = filepath.Join(includeDir, spec.WorkflowDir)
+	}
+	errs = append(errs, validateSpec(&spec)...)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return workflowFromSpec(&spec)
 }
 
-func RunFromYaml(yamlPath string) int {
-	w := workflowFromYaml(yamlPath)
-	return w.Run()
+// workflowFromSpec creates the workflow described by a validated spec
+func workflowFromSpec(spec *Workflow) (*Workflow, error) {
+	w, err := newWorkflowState(spec.WorkflowDir, spec.StateDir)
+	if err != nil {
+		return nil, fmt.Errorf("error creating workflow dir: %v", err)
+	}
+	w.MaxParallel = spec.MaxParallel
+	w.MaxRetriesCap = spec.MaxRetriesCap
+	w.Timeout = spec.Timeout
+	w.DirMode = spec.DirMode
+	w.FileMode = spec.FileMode
+	w.Shell = spec.Shell
+	w.Env = spec.Env
+	w.Vars = spec.Vars
+	w.Secrets = spec.Secrets
+	w.SecretsFile = spec.SecretsFile
+	w.RecordEnv = spec.RecordEnv
+	w.DryRun = spec.DryRun
+	w.Explain = spec.Explain
+	w.Resume = spec.Resume
+	w.NoEventDB = spec.NoEventDB
+	w.QuietSuccess = spec.QuietSuccess
+	w.KeepGoing = spec.KeepGoing
+	w.FailFast = spec.FailFast
+	w.MaxFailures = spec.MaxFailures
+	w.Stream = spec.Stream
+	w.Progress = spec.Progress
+	w.CacheDir = spec.CacheDir
+	w.Only = spec.Only
+	w.Stages = spec.Stages
+	w.Tags = spec.Tags
+	w.OnlyTags = spec.OnlyTags
+	w.TagsStrict = spec.TagsStrict
+	w.Labels = spec.Labels
+	w.MetricsAddr = spec.MetricsAddr
+	w.ServeAddr = spec.ServeAddr
+	w.SSH = spec.SSH
+	w.Hooks = spec.Hooks
+	w.Notifications = spec.Notifications
+	assignJobIDs(spec.Jobs)
+	w.currentJobID = maxJobID(spec.Jobs)
+	declared := declaredJobs(spec.Jobs)
+	resolved := map[int]*Job{}
+	for _, j := range spec.Jobs {
+		w.AddJob(newJobFromJob(w, j, declared, resolved))
+	}
+	err = resolveDependsOn(w.allJobs())
+	if err != nil {
+		return nil, err
+	}
+	err = resolveStages(w.Stages, w.allJobs())
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// resolveDependsOn adds the jobs named in each job's DependsOn to its Dependencies,
+// the name of a matrix job adds all of its copies. The jobs named in After and the job
+// named by StdinFrom are also added, unless they are already dependencies
+func resolveDependsOn(jobs []*Job) error {
+	byName := map[string][]*Job{}
+	for _, j := range jobs {
+		if j.Name != "" {
+			byName[j.Name] = append(byName[j.Name], j)
+		}
+		if j.matrixName != "" {
+			byName[j.matrixName] = append(byName[j.matrixName], j)
+		}
+	}
+	for _, j := range jobs {
+		for _, name := range j.DependsOn {
+			deps, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("job %s depends on unknown job '%s'", j.label(), name)
+			}
+			j.AddDependency(deps...)
+		}
+		for _, name := range j.After {
+			deps, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("job %s is after unknown job '%s'", j.label(), name)
+			}
+			for _, d := range deps {
+				if !j.dependsOn(d) {
+					j.AddDependency(d)
+					j.afterJobs = append(j.afterJobs, d)
+				}
+			}
+		}
+		if j.StdinFrom == "" {
+			continue
+		}
+		upstream := byName[j.StdinFrom]
+		if len(upstream) != 1 {
+			return fmt.Errorf("job %s has stdin_from '%s' which does not name a single job", j.label(), j.StdinFrom)
+		}
+		j.stdinJob = upstream[0]
+		if !j.dependsOn(j.stdinJob) {
+			j.AddDependency(j.stdinJob)
+		}
+	}
+	return nil
+}
+
+// RunFromYaml loads and runs the workflow at yamlPath, returning its exit status.
+// An error is returned if the workflow could not be loaded
+func RunFromYaml(yamlPath string) (int, error) {
+	w, err := workflowFromYaml(yamlPath, "")
+	if err != nil {
+		return ExitInvalidWorkflow, err
+	}
+	return w.Run(), nil
 }
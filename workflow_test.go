@@ -1,10 +1,25 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 const OutputDir = "testoutput"
@@ -13,7 +28,6 @@ var noClean bool
 
 func init() {
 	flag.BoolVar(&noClean, "no-clean", false, "do not clean workflow directories")
-	flag.Parse()
 }
 
 func cleanTestData(t *testing.T) {
@@ -25,6 +39,14 @@ func cleanTestData(t *testing.T) {
 	}
 }
 
+func testWorkflow(t *testing.T, name string) *Workflow {
+	wf, err := newWorkflow(path.Join(OutputDir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wf
+}
+
 func expectZero(t *testing.T, status int) {
 	if status != 0 {
 		t.Error("expected exit 0, wf exited", status)
@@ -65,17 +87,1520 @@ func TestRunWorkflow(t *testing.T) {
 		}},
 		{"DependentJobs", func(wf *Workflow) []*Job {
 			return []*Job{newJob(wf, []string{"out"},
-				[]*Job{newJob(wf, []string{"out"}, []*Job{}, []string{"out/test_out.txt"}, true, "grep -o some out/test_a.txt > out/test_out.txt")},
-				[]string{}, true, "echo 'some test output' > out/test_a.txt")}
+				[]*Job{newJob(wf, []string{"out"}, []*Job{}, []string{}, true, "echo 'some test output' > out/test_a.txt")},
+				[]string{"out/test_out.txt"}, true, "grep -o some out/test_a.txt > out/test_out.txt")}
 		}},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			defer cleanTestData(t)
-			wf := newWorkflow(path.Join(OutputDir, tc.name))
+			wf := testWorkflow(t, tc.name)
 			jobs := tc.jobs(wf)
 			wf.AddJob(jobs...)
 			wf.Run()
 		})
 	}
 }
+
+func writeTestYaml(t *testing.T, name string, yaml string) string {
+	dir := path.Join(OutputDir, name)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	yamlPath := path.Join(dir, "workflow.yaml")
+	err = ioutil.WriteFile(yamlPath, []byte(yaml), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return yamlPath
+}
+
+func TestWorkflowFromYamlDiamond(t *testing.T) {
+	defer cleanTestData(t)
+	wfYaml := `
+workflow_dir: .
+jobs:
+- id: 1
+  cmd: echo A
+  dependencies:
+  - id: 2
+    cmd: echo B
+    dependencies:
+    - id: 4
+      cmd: echo D
+  - id: 3
+    cmd: echo C
+    dependencies:
+    - id: 4
+`
+	wf, err := workflowFromYaml(writeTestYaml(t, "Diamond", wfYaml), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wf.Jobs) != 1 {
+		t.Fatalf("expected 1 top level job, got %d", len(wf.Jobs))
+	}
+	a := wf.Jobs[0]
+	if len(a.Dependencies) != 2 {
+		t.Fatalf("expected A to have 2 dependencies, got %d", len(a.Dependencies))
+	}
+	b, c := a.Dependencies[0], a.Dependencies[1]
+	if len(b.Dependencies) != 1 || len(c.Dependencies) != 1 {
+		t.Fatal("expected B and C to have exactly 1 dependency")
+	}
+	if b.Dependencies[0] != c.Dependencies[0] {
+		t.Error("expected D to be a single shared job")
+	}
+	if d := b.Dependencies[0]; d.ID != 4 || d.Cmd != "echo D" || d.workflow != wf {
+		t.Errorf("expected D to have id 4, cmd 'echo D' and belong to the workflow, got id %d cmd '%s'", d.ID, d.Cmd)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		jobs    func(*Workflow) []*Job
+		wantErr string
+	}{
+		{"SelfLoop", func(wf *Workflow) []*Job {
+			a := newJob(wf, []string{}, []*Job{}, []string{}, false, "echo a")
+			a.AddDependency(a)
+			return []*Job{a}
+		}, "dependency cycle: 1 -> 1"},
+		{"TwoNodeCycle", func(wf *Workflow) []*Job {
+			a := newJob(wf, []string{}, []*Job{}, []string{}, false, "echo a")
+			b := newJob(wf, []string{}, []*Job{a}, []string{}, false, "echo b")
+			a.AddDependency(b)
+			return []*Job{a}
+		}, "dependency cycle: 1 -> 2 -> 1"},
+		{"ValidDAG", func(wf *Workflow) []*Job {
+			d := newJob(wf, []string{}, []*Job{}, []string{}, false, "echo d")
+			b := newJob(wf, []string{}, []*Job{d}, []string{}, false, "echo b")
+			c := newJob(wf, []string{}, []*Job{d}, []string{}, false, "echo c")
+			return []*Job{newJob(wf, []string{}, []*Job{b, c}, []string{}, false, "echo a")}
+		}, ""},
+		{"DuplicateOutput", func(wf *Workflow) []*Job {
+			a := newJob(wf, []string{}, []*Job{}, []string{"/gflow/out.txt"}, false, "echo a")
+			b := newJob(wf, []string{}, []*Job{}, []string{"/gflow/out.txt"}, false, "echo b")
+			return []*Job{a, b}
+		}, "jobs 1 and 2 both write output /gflow/out.txt and do not depend on each other"},
+		{"OutputWithinOutput", func(wf *Workflow) []*Job {
+			d := newJob(wf, []string{}, []*Job{}, []string{"/gflow/build"}, false, "echo d")
+			b := newJob(wf, []string{}, []*Job{d}, []string{}, false, "echo b")
+			c := newJob(wf, []string{}, []*Job{}, []string{"/gflow/build/c.txt"}, false, "echo c")
+			return []*Job{b, c}
+		}, "jobs 1 and 3 both write output /gflow/build and do not depend on each other"},
+		{"OrderedDuplicateOutput", func(wf *Workflow) []*Job {
+			a := newJob(wf, []string{}, []*Job{}, []string{"/gflow/out.txt"}, false, "echo a")
+			b := newJob(wf, []string{}, []*Job{a}, []string{}, false, "echo b")
+			return []*Job{newJob(wf, []string{}, []*Job{b}, []string{"/gflow/out.txt"}, false, "echo c")}
+		}, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer cleanTestData(t)
+			wf := testWorkflow(t, tc.name)
+			wf.AddJob(tc.jobs(wf)...)
+			err := wf.Validate()
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Errorf("expected valid workflow, got %v", err)
+			case tc.wantErr != "" && (err == nil || err.Error() != tc.wantErr):
+				t.Errorf("expected error %q, got %v", tc.wantErr, err)
+			case tc.wantErr != "":
+				if status := wf.Run(); status != ExitInvalidWorkflow {
+					t.Errorf("expected exit %d, wf exited %d", ExitInvalidWorkflow, status)
+				}
+			}
+		})
+	}
+}
+
+func jobEvents(t *testing.T, wf *Workflow) map[int]map[string]Event {
+	events, err := readEvents(wf.EventDBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byJob := map[int]map[string]Event{}
+	for _, e := range events {
+		if byJob[e.JobID] == nil {
+			byJob[e.JobID] = map[string]Event{}
+		}
+		byJob[e.JobID][e.Type] = e
+	}
+	return byJob
+}
+
+func TestDependencyOrdering(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "DependencyOrdering")
+	a := newJob(wf, []string{}, []*Job{}, []string{}, false, "sleep 0.1")
+	b := newJob(wf, []string{}, []*Job{a}, []string{}, false, "sleep 0.1")
+	c := newJob(wf, []string{}, []*Job{a, b}, []string{}, false, "echo c")
+	wf.AddJob(c)
+	expectZero(t, wf.Run())
+
+	events := jobEvents(t, wf)
+	for _, j := range []*Job{a, b, c} {
+		started, ok := events[j.ID][EventStarted]
+		if !ok {
+			t.Fatalf("expected job_id:%d to have started", j.ID)
+		}
+		for _, d := range j.Dependencies {
+			finished, ok := events[d.ID][EventFinished]
+			if !ok {
+				t.Fatalf("expected job_id:%d to have finished", d.ID)
+			}
+			if started.Time.Before(finished.Time) {
+				t.Errorf("job_id:%d started before its dependency job_id:%d finished", j.ID, d.ID)
+			}
+		}
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	defer cleanTestData(t)
+	testCases := []struct {
+		name  string
+		setup func(wf *Workflow)
+		want  int
+	}{
+		{"Success", func(wf *Workflow) {
+			skipped := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+			skipped.When = "env:GFLOW_TEST_NOT_SET"
+			wf.AddJob(newJob(wf, []string{}, []*Job{skipped}, []string{}, false, "true"))
+		}, ExitSuccess},
+		{"JobsFailed", func(wf *Workflow) {
+			wf.AddJob(newJob(wf, []string{}, []*Job{}, []string{}, false, "false"))
+		}, ExitJobsFailed},
+		{"InvalidWorkflow", func(wf *Workflow) {
+			a := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+			b := newJob(wf, []string{}, []*Job{a}, []string{}, false, "true")
+			a.AddDependency(b)
+			wf.AddJob(a)
+		}, ExitInvalidWorkflow},
+		{"TimeoutOverFailure", func(wf *Workflow) {
+			wf.KeepGoing = true
+			wf.Timeout = Duration{200 * time.Millisecond}
+			wf.AddJob(newJob(wf, []string{}, []*Job{}, []string{}, false, "false"),
+				newJob(wf, []string{}, []*Job{}, []string{}, false, "sleep 5"))
+		}, ExitTimeout},
+		{"InterruptedOverFailure", func(wf *Workflow) {
+			wf.KeepGoing = true
+			wf.gracePeriod = 100 * time.Millisecond
+			wf.AddJob(newJob(wf, []string{}, []*Job{}, []string{}, false, "false"),
+				newJob(wf, []string{}, []*Job{}, []string{}, false, "sleep 0.2; kill -INT $PPID; sleep 5"))
+		}, ExitInterrupted},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wf := testWorkflow(t, "ExitStatus"+tc.name)
+			tc.setup(wf)
+			if status := wf.Run(); status != tc.want {
+				t.Errorf("expected exit status %d, got %d", tc.want, status)
+			}
+		})
+	}
+}
+
+func TestFailedDependencySkips(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "FailedDependencySkips")
+	a := newJob(wf, []string{}, []*Job{}, []string{}, false, "false")
+	b := newJob(wf, []string{}, []*Job{a}, []string{}, false, "echo b")
+	c := newJob(wf, []string{}, []*Job{b}, []string{}, false, "echo c")
+	wf.AddJob(c)
+	if status := wf.Run(); status != ExitJobsFailed {
+		t.Errorf("expected exit %d, wf exited %d", ExitJobsFailed, status)
+	}
+
+	if a.Status != StatusFailed {
+		t.Errorf("expected job_id:%d to be %s, got %s", a.ID, StatusFailed, a.Status)
+	}
+	events := jobEvents(t, wf)
+	for _, j := range []*Job{b, c} {
+		if j.Status != StatusSkipped {
+			t.Errorf("expected job_id:%d to be %s, got %s", j.ID, StatusSkipped, j.Status)
+		}
+		if _, ran := events[j.ID][EventStarted]; ran {
+			t.Errorf("expected skipped job_id:%d not to start", j.ID)
+		}
+		if _, skipped := events[j.ID][EventSkipped]; !skipped {
+			t.Errorf("expected a skipped event for job_id:%d", j.ID)
+		}
+	}
+	if c.Reason != fmt.Sprintf("dependency job_id:%d skipped", b.ID) {
+		t.Errorf("expected job_id:%d to be skipped because of job_id:%d, got reason '%s'", c.ID, b.ID, c.Reason)
+	}
+	reasons := map[int]string{}
+	for _, f := range wf.failedJobs.List() {
+		reasons[f.Job.ID] = f.Reason
+	}
+	want := map[int]string{a.ID: FailureNonzeroExit, b.ID: FailureSkippedDependency, c.ID: FailureSkippedDependency}
+	if !reflect.DeepEqual(reasons, want) {
+		t.Errorf("expected only job_id:%d to be failed and the others skipped, got %v", a.ID, reasons)
+	}
+
+	wfJSON, err := ioutil.ReadFile(wf.WFJsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written Workflow
+	if err := json.Unmarshal(wfJSON, &written); err != nil {
+		t.Fatal(err)
+	}
+	if got := written.Jobs[0].Status; got != StatusSkipped {
+		t.Errorf("expected workflow json to record job_id:%d %s, got %s", c.ID, StatusSkipped, got)
+	}
+}
+
+// overlapExecutor runs the failing job once the running job has started,
+// and finishes the running job once the failing job is done
+type overlapExecutor struct {
+	LocalExecutor
+	failing, running *Job
+	started          chan struct{}
+}
+
+func (e overlapExecutor) Run(ctx context.Context, j *Job, stdout, stderr io.Writer) (int, error) {
+	switch j {
+	case e.failing:
+		<-e.started
+	case e.running:
+		close(e.started)
+		<-e.failing.done
+	}
+	return e.LocalExecutor.Run(ctx, j, stdout, stderr)
+}
+
+func TestKeepGoing(t *testing.T) {
+	defer cleanTestData(t)
+	for _, keepGoing := range []bool{false, true} {
+		wf := testWorkflow(t, fmt.Sprintf("KeepGoing%v", keepGoing))
+		wf.KeepGoing = keepGoing
+		failing := newJob(wf, []string{}, []*Job{}, []string{}, false, "false")
+		dependent := newJob(wf, []string{}, []*Job{failing}, []string{}, false, "true")
+		// other is running when failing fails, then unrelated depends on it
+		other := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+		unrelated := newJob(wf, []string{}, []*Job{other}, []string{}, false, "true")
+		wf.AddJob(dependent, unrelated)
+		wf.Executor = overlapExecutor{failing: failing, running: other, started: make(chan struct{})}
+		if status := wf.Run(); status != ExitJobsFailed {
+			t.Errorf("expected exit %d with keep going %v, wf exited %d", ExitJobsFailed, keepGoing, status)
+		}
+
+		want := map[*Job]string{failing: StatusFailed, dependent: StatusSkipped, other: StatusSucceeded,
+			unrelated: StatusSkipped}
+		if keepGoing {
+			want[unrelated] = StatusSucceeded
+		}
+		for j, status := range want {
+			if j.Status != status {
+				t.Errorf("expected job_id:%d to be %s with keep going %v, got %s: %s", j.ID, status, keepGoing, j.Status, j.Reason)
+			}
+		}
+		if !keepGoing && unrelated.Reason != "another job failed" {
+			t.Errorf("expected job_id:%d to be skipped because another job failed, got '%s'", unrelated.ID, unrelated.Reason)
+		}
+	}
+}
+
+func TestMaxFailures(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "MaxFailures")
+	wf.MaxFailures = 2
+	wf.gracePeriod = 100 * time.Millisecond
+	first := newJob(wf, []string{}, []*Job{}, []string{}, false, "false")
+	second := newJob(wf, []string{}, []*Job{}, []string{}, false, "sleep 0.5; false")
+	quick := newJob(wf, []string{}, []*Job{}, []string{}, false, "sleep 0.1")
+	// afterFirst starts after the first failure, so jobs are still started until the second
+	afterFirst := newJob(wf, []string{}, []*Job{quick}, []string{}, false, "true")
+	long := newJob(wf, []string{}, []*Job{}, []string{}, false, "sleep 30")
+	afterLong := newJob(wf, []string{}, []*Job{long}, []string{}, false, "true")
+	wf.AddJob(first, second, afterFirst, afterLong)
+
+	start := time.Now()
+	if status := wf.Run(); status != ExitJobsFailed {
+		t.Errorf("expected exit %d, wf exited %d", ExitJobsFailed, status)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected the second failure to cancel the running job, took %v", elapsed)
+	}
+	want := map[*Job]string{first: StatusFailed, second: StatusFailed, quick: StatusSucceeded,
+		afterFirst: StatusSucceeded, long: StatusCancelled, afterLong: StatusSkipped}
+	for j, status := range want {
+		if j.Status != status {
+			t.Errorf("expected job_id:%d to be %s, got %s: %s", j.ID, status, j.Status, j.Reason)
+		}
+	}
+
+	wf = testWorkflow(t, "MaxFailures")
+	wf.MaxFailures = 2
+	wf.FailFast = true
+	wf.AddJob(newJob(wf, []string{}, []*Job{}, []string{}, false, "true"))
+	if status := wf.Run(); status != ExitInvalidWorkflow {
+		t.Errorf("expected exit %d with max failures and fail fast, wf exited %d", ExitInvalidWorkflow, status)
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "FailFast")
+	wf.FailFast = true
+	wf.gracePeriod = 100 * time.Millisecond
+	// failing waits for long to start so that long is running when it fails
+	long := newJob(wf, []string{}, []*Job{}, []string{}, false, "touch started; sleep 30")
+	failing := newJob(wf, []string{}, []*Job{}, []string{}, false,
+		"while [[ ! -f started ]]; do sleep 0.01; done; sleep 0.5; false")
+	dependent := newJob(wf, []string{}, []*Job{long}, []string{}, false, "true")
+	wf.AddJob(failing, dependent)
+
+	start := time.Now()
+	if status := wf.Run(); status != ExitJobsFailed {
+		t.Errorf("expected exit %d, wf exited %d", ExitJobsFailed, status)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected the failure to cancel the running job, took %v", elapsed)
+	}
+	want := map[*Job]string{failing: StatusFailed, long: StatusCancelled, dependent: StatusSkipped}
+	for j, status := range want {
+		if j.Status != status {
+			t.Errorf("expected job_id:%d to be %s, got %s: %s", j.ID, status, j.Status, j.Reason)
+		}
+	}
+
+	loaded, err := loadWorkflowJSON(wf.WorkflowDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := loaded.statusJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, j := range jobs {
+		if j.ID == long.ID && j.Status != StatusCancelled {
+			t.Errorf("expected the workflow json to record job_id:%d as cancelled, got %s", j.ID, j.Status)
+		}
+	}
+	if _, ok := jobEvents(t, wf)[long.ID][EventCancelled]; !ok {
+		t.Errorf("expected a %s event for the cancelled job", EventCancelled)
+	}
+
+	wf.KeepGoing = true
+	if status := wf.Run(); status != ExitInvalidWorkflow {
+		t.Errorf("expected exit %d with keep going and fail fast, wf exited %d", ExitInvalidWorkflow, status)
+	}
+}
+
+func TestMaxParallel(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "MaxParallel")
+	wf.MaxParallel = 4
+	first := newJob(wf, []string{}, []*Job{}, []string{}, false, "sleep 0.01")
+	wf.AddJob(first)
+	for i := 0; i < 50; i++ {
+		wf.AddJob(newJob(wf, []string{}, []*Job{first}, []string{}, false, "sleep 0.01"))
+	}
+	expectZero(t, wf.Run())
+
+	events, err := readEvents(wf.EventDBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	running, peak, started := 0, 0, 0
+	for _, e := range events {
+		switch e.Type {
+		case EventStarted:
+			running++
+			started++
+		case EventFinished, EventFailed:
+			running--
+		}
+		if running > peak {
+			peak = running
+		}
+	}
+	if started != 51 {
+		t.Errorf("expected 51 jobs to start, got %d", started)
+	}
+	if peak > wf.MaxParallel {
+		t.Errorf("expected at most %d concurrent jobs, got %d", wf.MaxParallel, peak)
+	}
+}
+
+func TestFailureReasons(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "FailureReasons")
+	wf.KeepGoing = true
+	succeeded := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	exited := newJob(wf, []string{}, []*Job{}, []string{}, false, "echo oops >&2; exit 3")
+	timedOut := newJob(wf, []string{}, []*Job{}, []string{}, false, "sleep 5")
+	timedOut.Timeout = Duration{100 * time.Millisecond}
+	missing := newJob(wf, []string{}, []*Job{}, []string{"never.txt"}, false, "true")
+	skipped := newJob(wf, []string{}, []*Job{exited}, []string{}, false, "true")
+	wf.AddJob(succeeded, timedOut, missing, skipped)
+	expectNonZero(t, wf.Run())
+
+	failures := map[*Job]jobFailure{}
+	for _, f := range wf.failedJobs.List() {
+		failures[f.Job] = f
+	}
+	if len(failures) != 4 {
+		t.Errorf("expected 4 failures, got %d", len(failures))
+	}
+	for _, tc := range []struct {
+		j        *Job
+		reason   string
+		detail   string
+		exitCode int
+	}{
+		{exited, FailureNonzeroExit, "exit status 3", 3},
+		{timedOut, FailureTimeout, "timeout", -1},
+		{missing, FailureMissingOutput, "missing output: " + missing.pathToOutput("never.txt"), 0},
+		{skipped, FailureSkippedDependency, fmt.Sprintf("dependency job_id:%d failed", exited.ID), 0},
+	} {
+		f := failures[tc.j]
+		if f.Reason != tc.reason || f.Detail != tc.detail || f.ExitCode != tc.exitCode || f.StderrLog != tc.j.StderrLog {
+			t.Errorf("expected job %d to fail for %s: %s with exit code %d, got %+v", tc.j.ID, tc.reason, tc.detail, tc.exitCode, f)
+		}
+	}
+	if _, ok := failures[succeeded]; ok {
+		t.Error("expected the succeeded job not to be recorded as failed")
+	}
+}
+
+func TestOnExit(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "OnExit")
+	succeeded := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	succeeded.OnExit = `echo "$GFLOW_JOB_STATUS $GFLOW_EXIT_CODE" > succeeded.hook`
+	failed := newJob(wf, []string{}, []*Job{}, []string{}, false, "exit 4")
+	failed.OnExit = `echo "$GFLOW_JOB_STATUS $GFLOW_EXIT_CODE" > failed.hook`
+	failingHook := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	failingHook.OnExit = "echo hook failing >&2; exit 1"
+	wf.AddJob(succeeded, failed, failingHook)
+	expectNonZero(t, wf.Run())
+
+	for hook, want := range map[string]string{"succeeded.hook": "succeeded 0\n", "failed.hook": "failed 4\n"} {
+		got, err := ioutil.ReadFile(wf.pathToWDir(hook))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("expected on_exit hook to see %q, got %q", want, string(got))
+		}
+	}
+	if failingHook.Status != StatusSucceeded {
+		t.Errorf("expected a failing on_exit hook not to fail its job, got %s", failingHook.Status)
+	}
+	stderr, err := ioutil.ReadFile(failingHook.StderrLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(stderr) != "hook failing\n" {
+		t.Errorf("expected on_exit output in the job's stderr log, got %q", string(stderr))
+	}
+}
+
+func TestJobDirectories(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "JobDirectories")
+	wf.KeepGoing = true
+	err := os.MkdirAll(wf.WorkflowDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(wf.pathToWDir("blocked"), []byte{}, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested := newJob(wf, []string{"out/a/b", "out/c"}, []*Job{}, []string{}, false, "echo hello > out/a/b/hello.txt; ls out/c")
+	blocked := newJob(wf, []string{"blocked/dir"}, []*Job{}, []string{}, false, "true")
+	wf.AddJob(nested, blocked)
+	expectNonZero(t, wf.Run())
+
+	if nested.Status != StatusSucceeded {
+		t.Errorf("expected job to find its nested directories, got %s: %s", nested.Status, nested.Reason)
+	}
+	if blocked.Status != StatusFailed || blocked.Attempts != 0 || !strings.HasPrefix(blocked.Reason, "could not create directory") {
+		t.Errorf("expected job whose directory cannot be created to fail without running, got %s: %s", blocked.Status, blocked.Reason)
+	}
+}
+
+func TestJobTimeout(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "JobTimeout")
+	j := newJob(wf, []string{}, []*Job{}, []string{}, false, "sleep 5")
+	j.Timeout = Duration{100 * time.Millisecond}
+	wf.AddJob(j)
+
+	start := time.Now()
+	expectNonZero(t, wf.Run())
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected job to be killed after its timeout, workflow took %v", elapsed)
+	}
+	if failures := wf.failedJobs.List(); len(failures) != 1 || failures[0].Job != j || failures[0].Reason != FailureTimeout {
+		t.Fatal("expected timed out job to be failed")
+	}
+	if j.Reason != "timeout" {
+		t.Errorf("expected failure reason 'timeout', got '%s'", j.Reason)
+	}
+}
+
+func TestCleanTmp(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "CleanTmp")
+	wf.KeepGoing = true
+	cmd := `echo scratch > "$GFLOW_TMP/scratch.txt"; false`
+	cleaned := newJob(wf, []string{}, []*Job{}, []string{}, true, cmd)
+	retained := newJob(wf, []string{}, []*Job{}, []string{}, false, cmd)
+	wf.AddJob(cleaned, retained)
+	expectNonZero(t, wf.Run())
+
+	if _, err := os.Stat(cleaned.pathToTmp()); !os.IsNotExist(err) {
+		t.Errorf("expected tmp dir of failed job with clean_tmp to be removed, got %v", err)
+	}
+	got, err := ioutil.ReadFile(path.Join(retained.pathToTmp(), "scratch.txt"))
+	if err != nil || string(got) != "scratch\n" {
+		t.Errorf("expected tmp dir of job without clean_tmp to be retained, got %q, %v", string(got), err)
+	}
+}
+
+func TestTmpDirName(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "TmpDirName")
+	j := newJob(wf, []string{}, []*Job{}, []string{}, false, `echo "$GFLOW_TMP" >> tmp_dirs.txt
+[ -f "$GFLOW_TMP/marker" ] && echo leftover > leftover.txt
+touch "$GFLOW_TMP/marker"
+[ -f retried ] || { touch retried; exit 1; }`)
+	j.Retries = 1
+	wf.AddJob(j)
+	expectZero(t, wf.Run())
+
+	want := path.Join(wf.WorkflowDir, ".gflow", "tmp", fmt.Sprintf("job_%d", j.ID))
+	if j.TmpDir != want {
+		t.Errorf("expected tmp dir %s, got %s", want, j.TmpDir)
+	}
+	got, err := ioutil.ReadFile(wf.pathToWDir("tmp_dirs.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want+"\n"+want+"\n" {
+		t.Errorf("expected both attempts to run with GFLOW_TMP %s, got %q", want, string(got))
+	}
+	if _, err := os.Stat(wf.pathToWDir("leftover.txt")); !os.IsNotExist(err) {
+		t.Error("expected the tmp dir to be emptied between attempts")
+	}
+	if _, err := os.Stat(path.Join(want, "marker")); err != nil {
+		t.Errorf("expected the tmp dir of the last attempt to be retained: %v", err)
+	}
+}
+
+func TestJobResourceLimits(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("resource limits are only enforced on linux")
+	}
+	defer cleanTestData(t)
+	testCases := []struct {
+		name      string
+		cmd       string
+		resources Resources
+		reason    string
+	}{
+		{"Memory", `x=$(head -c 200000000 /dev/zero | tr '\0' a)`, Resources{MemoryMB: 64},
+			"exit status 2: memory_mb limit of 64 may have been exceeded"},
+		{"CPU", "while :; do :; done", Resources{CPUSeconds: 1}, "cpu_seconds limit of 1 exceeded"},
+		{"MemoryUnexceeded", "echo failed >&2; exit 1", Resources{MemoryMB: 64}, "exit status 1"},
+		{"MemorySignal", "sh -c 'kill -SEGV $$'", Resources{MemoryMB: 64}, "killed by signal SIGSEGV"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wf := testWorkflow(t, "JobResourceLimits"+tc.name)
+			j := newJob(wf, []string{}, []*Job{}, []string{}, false, tc.cmd)
+			j.Resources = &tc.resources
+			wf.AddJob(j)
+			expectNonZero(t, wf.Run())
+			if j.Status != StatusFailed {
+				t.Fatalf("expected job over its limit to fail, got %s", j.Status)
+			}
+			if j.Reason != tc.reason {
+				t.Errorf("expected failure reason '%s', got '%s'", tc.reason, j.Reason)
+			}
+		})
+	}
+}
+
+func TestJobRetries(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "JobRetries")
+	// fails on the first two attempts, succeeds on the third
+	j := newJob(wf, []string{}, []*Job{}, []string{}, false,
+		"n=$(( $(cat attempts 2>/dev/null || echo 0) + 1 )); echo $n > attempts; [[ $n -ge 3 ]]")
+	j.Retries = 2
+	j.RetryDelay = Duration{10 * time.Millisecond}
+	wf.AddJob(j)
+	expectZero(t, wf.Run())
+
+	if j.Status != StatusSucceeded || j.Attempts != 3 {
+		t.Errorf("expected job to succeed on attempt 3, got %s on attempt %d", j.Status, j.Attempts)
+	}
+	stdout, err := ioutil.ReadFile(j.StdoutLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "GFLOW: attempt 2\nGFLOW: attempt 3\n"; string(stdout) != want {
+		t.Errorf("expected stdout log to mark each retry %q, got %q", want, string(stdout))
+	}
+	db, err := OpenEventDB(wf.EventDBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := db.Events(j.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{EventStarted, EventFailed, EventStarted, EventFailed, EventStarted, EventFinished}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(events))
+	}
+	for i, e := range events {
+		if e.Type != want[i] || e.Attempt != i/2+1 {
+			t.Errorf("event %d: expected %s on attempt %d, got %s on attempt %d", i, want[i], i/2+1, e.Type, e.Attempt)
+		}
+	}
+}
+
+func TestMaxRetriesCap(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "MaxRetriesCap")
+	out := &bytes.Buffer{}
+	wf.logger = newLogger(out, LogFormatText)
+	wf.MaxRetriesCap = 2
+	j := newJob(wf, []string{}, []*Job{}, []string{}, false, "false")
+	j.Retries = 1000
+	wf.AddJob(j)
+	expectNonZero(t, wf.Run())
+
+	if j.Status != StatusFailed || j.Attempts != 3 {
+		t.Errorf("expected job to fail after 3 attempts, got %s after %d", j.Status, j.Attempts)
+	}
+	if !strings.Contains(out.String(), "Warning: 1000 retries requested, capped at the workflow's max of 2") {
+		t.Errorf("expected a warning that the retries were capped, got:\n%s", out.String())
+	}
+	db, err := OpenEventDB(wf.EventDBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := db.Events(j.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 7 || events[5].Type != EventFailed || events[6].Type != EventRetriesExhausted || events[6].Attempt != 3 {
+		t.Errorf("expected the last failure to be followed by a %s event, got %v", EventRetriesExhausted, events)
+	}
+	failed, err := db.FailedJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(failed, []int{j.ID}) {
+		t.Errorf("expected job_id:%d to still be queried as failed, got %v", j.ID, failed)
+	}
+}
+
+// processAlive reports whether pid is running, treating zombies as exited
+func processAlive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return !os.IsNotExist(err)
+	}
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
+
+func TestWorkflowTimeout(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "WorkflowTimeout")
+	wf.Timeout = Duration{300 * time.Millisecond}
+	quick := newJob(wf, []string{}, []*Job{}, []string{}, false, "true")
+	slow := newJob(wf, []string{}, []*Job{quick}, []string{}, false, "sleep 5")
+	after := newJob(wf, []string{}, []*Job{slow}, []string{}, false, "true")
+	wf.AddJob(after)
+
+	start := time.Now()
+	if status := wf.Run(); status != ExitTimeout {
+		t.Errorf("expected exit status %d, got %d", ExitTimeout, status)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("expected running job to be cancelled at the workflow timeout, workflow took %v", elapsed)
+	}
+	for _, tc := range []struct {
+		j      *Job
+		status string
+	}{{quick, StatusSucceeded}, {slow, StatusInterrupted}, {after, StatusSkipped}} {
+		if tc.j.Status != tc.status {
+			t.Errorf("expected job %d to be %s, got %s", tc.j.ID, tc.status, tc.j.Status)
+		}
+	}
+	if slow.Reason != "workflow timeout" || after.Reason != "workflow timeout" {
+		t.Errorf("expected reasons 'workflow timeout', got '%s' and '%s'", slow.Reason, after.Reason)
+	}
+}
+
+func TestInterruptWorkflow(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "InterruptWorkflow")
+	wf.gracePeriod = 100 * time.Millisecond
+	long := newJob(wf, []string{}, []*Job{}, []string{}, false, "sleep 30 & echo $! > child.pid; wait")
+	dependent := newJob(wf, []string{}, []*Job{long}, []string{}, false, "echo never")
+	wf.AddJob(dependent)
+
+	pidFile := wf.pathToWDir("child.pid")
+	go func() {
+		for {
+			if pid, err := ioutil.ReadFile(pidFile); err == nil && len(pid) > 0 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	}()
+
+	start := time.Now()
+	if status := wf.Run(); status != ExitInterrupted {
+		t.Errorf("expected exit %d, wf exited %d", ExitInterrupted, status)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected interrupt to stop the workflow, took %v", elapsed)
+	}
+
+	pid, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	childPid, err := strconv.Atoi(strings.TrimSpace(string(pid)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the kill is asynchronous, give the child a moment to exit and be reaped
+	deadline := time.Now().Add(2 * time.Second)
+	for processAlive(childPid) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if processAlive(childPid) {
+		t.Errorf("expected child process %d to be killed", childPid)
+	}
+
+	wfJSON, err := ioutil.ReadFile(wf.WFJsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written Workflow
+	if err := json.Unmarshal(wfJSON, &written); err != nil {
+		t.Fatal(err)
+	}
+	got := written.Jobs[0]
+	if got.Status != StatusSkipped || got.Reason != "workflow interrupted" {
+		t.Errorf("expected unstarted job to be %s: workflow interrupted, got %s: %s", StatusSkipped, got.Status, got.Reason)
+	}
+	if got.Dependencies[0].Status != StatusInterrupted {
+		t.Errorf("expected running job to be %s, got %s", StatusInterrupted, got.Dependencies[0].Status)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	defer cleanTestData(t)
+	_, err := workflowFromYaml(path.Join(OutputDir, "missing.yaml"), "")
+	if err == nil {
+		t.Error("expected an error loading a missing yaml file")
+	}
+	if status, err := RunFromYaml(path.Join(OutputDir, "missing.yaml")); err == nil || status != ExitInvalidWorkflow {
+		t.Errorf("expected exit %d and an error, got exit %d and %v", ExitInvalidWorkflow, status, err)
+	}
+
+	// a workflow dir beneath a regular file can never be created
+	err = os.MkdirAll(OutputDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notADir := path.Join(OutputDir, "not_a_dir")
+	err = ioutil.WriteFile(notADir, []byte{}, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = newWorkflow(path.Join(notADir, "wf"))
+	if err == nil {
+		t.Error("expected an error creating an unwritable workflow dir")
+	}
+}
+
+func TestJobShell(t *testing.T) {
+	defer cleanTestData(t)
+	wfDir := path.Join(OutputDir, "JobShell")
+	yamlPath := writeTestYaml(t, "JobShell", `
+workflow_dir: .
+jobs:
+- cmd: shopt -s nullglob && echo builtin > builtin.out
+- shell: python -c
+  cmd: |
+    import sys
+    open('python.out', 'w').write("it's python " + sys.argv[0])
+- shell: sh -c
+  cmd: echo "$0 $1" > sh.out
+`)
+	wf, err := workflowFromYaml(yamlPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectZero(t, wf.Run())
+
+	want := map[string]string{"builtin.out": "builtin\n", "python.out": "it's python -c", "sh.out": "sh \n"}
+	for name, content := range want {
+		got, err := ioutil.ReadFile(path.Join(wfDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("expected %s to contain %q, got %q", name, content, string(got))
+		}
+	}
+}
+
+func TestStdinFrom(t *testing.T) {
+	defer cleanTestData(t)
+	wfDir := path.Join(OutputDir, "StdinFrom")
+	yamlPath := writeTestYaml(t, "StdinFrom", `
+workflow_dir: .
+jobs:
+- name: shout
+  stdin_from: emit
+  cmd: tr a-z A-Z > shout.txt
+- name: emit
+  cmd: printf 'hello\nworld\n'
+`)
+	wf, err := workflowFromYaml(yamlPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shout := wf.Jobs[0]
+	if len(shout.Dependencies) != 1 || shout.Dependencies[0] != wf.Jobs[1] {
+		t.Fatal("expected a job with stdin_from to depend on the job it reads from")
+	}
+	expectZero(t, wf.Run())
+
+	got, err := ioutil.ReadFile(path.Join(wfDir, "shout.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "HELLO\nWORLD\n"; string(got) != want {
+		t.Errorf("expected the transformed stdin %q, got %q", want, string(got))
+	}
+}
+
+func TestAfter(t *testing.T) {
+	defer cleanTestData(t)
+	yamlPath := writeTestYaml(t, "After", `
+workflow_dir: .
+keep_going: true
+jobs:
+- name: flaky
+  cmd: sleep 0.1 && false
+- name: report
+  after: [flaky]
+  cmd: echo report
+- name: deploy
+  depends_on: [flaky]
+  cmd: echo deploy
+`)
+	wf, err := workflowFromYaml(yamlPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNonZero(t, wf.Run())
+
+	flaky, report, deploy := wf.Jobs[0], wf.Jobs[1], wf.Jobs[2]
+	if report.Status != StatusSucceeded || deploy.Status != StatusSkipped {
+		t.Fatalf("expected the job after a failed job to run and its dependent to be skipped, got %s and %s",
+			report.Status, deploy.Status)
+	}
+	if report.StartedAt.Before(*flaky.FinishedAt) {
+		t.Errorf("expected the job to start after %s finished at %v, started at %v", flaky.Name, flaky.FinishedAt, report.StartedAt)
+	}
+
+	_, err = workflowFromYaml(writeTestYaml(t, "After", `
+workflow_dir: .
+jobs:
+- after: [missing]
+  cmd: echo report
+`), "")
+	if err == nil || !strings.Contains(err.Error(), "jobs[0].after[0]: unknown job 'missing'") {
+		t.Errorf("expected an error for an unknown after job, got %v", err)
+	}
+}
+
+func TestAllowFailure(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "AllowFailure")
+	lint := newJob(wf, []string{}, []*Job{}, []string{}, false, "exit 3")
+	lint.AllowFailure = true
+	build := newJob(wf, []string{}, []*Job{lint}, []string{}, false, "true")
+	other := newJob(wf, []string{}, []*Job{}, []string{}, false, "sleep 0.1")
+	wf.AddJob(build, other)
+	expectZero(t, wf.Run())
+
+	if lint.Status != StatusFailedAllowed || lint.ExitCode != 3 {
+		t.Errorf("expected the allowed failure to be recorded, got %s with exit code %d", lint.Status, lint.ExitCode)
+	}
+	if build.Status != StatusSucceeded || other.Status != StatusSucceeded {
+		t.Errorf("expected the other jobs to run, got %s and %s", build.Status, other.Status)
+	}
+	loaded, err := loadWorkflowJSON(wf.WorkflowDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Jobs[0].Dependencies[0].Status; got != StatusFailedAllowed {
+		t.Errorf("expected the workflow json to record %s, got %s", StatusFailedAllowed, got)
+	}
+}
+
+func TestRecordEnv(t *testing.T) {
+	defer cleanTestData(t)
+	os.Setenv("GFLOW_TEST_RECORD_TOKEN", "recorded-secret-value")
+	defer os.Unsetenv("GFLOW_TEST_RECORD_TOKEN")
+	os.Setenv("GFLOW_TEST_RECORD_PLAIN", "plain")
+	defer os.Unsetenv("GFLOW_TEST_RECORD_PLAIN")
+
+	wf := testWorkflow(t, "RecordEnv")
+	wf.AddJob(newJob(wf, []string{}, []*Job{}, []string{}, false, "true"))
+	expectZero(t, wf.Run())
+	snapshot, err := readEnvSnapshot(wf.EnvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Path != os.Getenv("PATH") || snapshot.Env != nil {
+		t.Errorf("expected only the PATH of the process %q to be recorded, got %q and %v",
+			os.Getenv("PATH"), snapshot.Path, snapshot.Env)
+	}
+
+	wf = testWorkflow(t, "RecordEnv")
+	wf.RecordEnv = true
+	wf.Secrets = []string{"GFLOW_TEST_RECORD_TOKEN"}
+	wf.AddJob(newJob(wf, []string{}, []*Job{}, []string{}, false, "true"))
+	expectZero(t, wf.Run())
+	snapshot, err = readEnvSnapshot(wf.EnvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Env["GFLOW_TEST_RECORD_PLAIN"] != "plain" || snapshot.Env["PATH"] != os.Getenv("PATH") {
+		t.Errorf("expected the process environment to be recorded, got %v", snapshot.Env)
+	}
+	if got := snapshot.Env["GFLOW_TEST_RECORD_TOKEN"]; got != redacted {
+		t.Errorf("expected the secret to be redacted from the recorded environment, got %q", got)
+	}
+}
+
+func TestJobEnv(t *testing.T) {
+	defer cleanTestData(t)
+	os.Setenv("GFLOW_TEST_INHERITED", "inherited")
+	defer os.Unsetenv("GFLOW_TEST_INHERITED")
+
+	wf := testWorkflow(t, "JobEnv")
+	wf.Env = map[string]string{"A": "wf-a", "B": "wf-b", "FROM_PROCESS": "${GFLOW_TEST_INHERITED}"}
+	j := newJob(wf, []string{}, []*Job{}, []string{}, false,
+		`echo "$A $B $C $FROM_PROCESS $GFLOW_TEST_INHERITED" > env.out`)
+	j.Env = map[string]string{"B": "job-b", "C": "${A}-c"}
+	wf.AddJob(j)
+	expectZero(t, wf.Run())
+
+	out, err := ioutil.ReadFile(wf.pathToWDir("env.out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "wf-a job-b wf-a-c inherited inherited\n"
+	if string(out) != want {
+		t.Errorf("expected job environment %q, got %q", want, string(out))
+	}
+}
+
+func TestRunID(t *testing.T) {
+	defer cleanTestData(t)
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	runIDs := []string{}
+	for run := 0; run < 2; run++ {
+		wf := testWorkflow(t, "RunID")
+		jobs := []*Job{}
+		for _, name := range []string{"build", "test"} {
+			j := newJob(wf, []string{}, []*Job{}, []string{}, false,
+				`echo "$GFLOW_RUN_ID $GFLOW_JOB_ID $GFLOW_JOB_NAME" > "env_$GFLOW_JOB_ID.out"`)
+			j.Name = name
+			jobs = append(jobs, j)
+		}
+		wf.AddJob(jobs...)
+		expectZero(t, wf.Run())
+
+		if !uuid.MatchString(wf.runID) {
+			t.Fatalf("expected the run id to be a uuid, got %q", wf.runID)
+		}
+		for _, j := range jobs {
+			out, err := ioutil.ReadFile(wf.pathToWDir(fmt.Sprintf("env_%d.out", j.ID)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := fmt.Sprintf("%s %d %s\n", wf.runID, j.ID, j.Name)
+			if string(out) != want {
+				t.Errorf("expected job environment %q, got %q", want, string(out))
+			}
+			if got := jobEvents(t, wf)[j.ID][EventFinished].RunID; got != wf.runID {
+				t.Errorf("expected the events of job_id:%d to record run id %s, got %q", j.ID, wf.runID, got)
+			}
+		}
+		runIDs = append(runIDs, wf.runID)
+	}
+	if runIDs[0] == runIDs[1] {
+		t.Errorf("expected each run to have its own run id, got %s twice", runIDs[0])
+	}
+}
+
+func TestJobLogs(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "JobLogs")
+	j := newJob(wf, []string{}, []*Job{}, []string{}, false, "echo hello; echo oops >&2")
+	wf.AddJob(j)
+	expectZero(t, wf.Run())
+
+	wantStdout := path.Join(wf.LogDir, fmt.Sprintf("job_%d.stdout.log", j.ID))
+	wantStderr := path.Join(wf.LogDir, fmt.Sprintf("job_%d.stderr.log", j.ID))
+	for logPath, want := range map[string]string{wantStdout: "hello\n", wantStderr: "oops\n"} {
+		got, err := ioutil.ReadFile(logPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("expected %s to contain %q, got %q", logPath, want, string(got))
+		}
+	}
+	if j.StdoutLog != wantStdout || j.StderrLog != wantStderr {
+		t.Errorf("expected job log paths %s and %s, got %s and %s", wantStdout, wantStderr, j.StdoutLog, j.StderrLog)
+	}
+	started := jobEvents(t, wf)[j.ID][EventStarted]
+	if started.StdoutLog != wantStdout || started.StderrLog != wantStderr {
+		t.Errorf("expected started event to record log paths, got %s and %s", started.StdoutLog, started.StderrLog)
+	}
+}
+
+func TestStreamOutput(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "StreamOutput")
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	wf.stdout, wf.stderr = stdout, stderr
+	wf.Stream = true
+	// writes each line in two parts, so concurrent jobs would interleave mid-line without buffering
+	cmd := "for i in 1 2 3; do printf 'job {{.Job.ID}} '; sleep 0.01; echo line $i; done; printf 'no newline' >&2"
+	j1 := newJob(wf, []string{}, []*Job{}, []string{}, false, cmd)
+	j2 := newJob(wf, []string{}, []*Job{}, []string{}, false, cmd)
+	wf.AddJob(j1, j2)
+	expectZero(t, wf.Run())
+
+	wantStdout := []string{}
+	wantStderr := []string{}
+	for _, j := range []*Job{j1, j2} {
+		for i := 1; i <= 3; i++ {
+			wantStdout = append(wantStdout, fmt.Sprintf("[job_%d] job %d line %d", j.ID, j.ID, i))
+		}
+		wantStderr = append(wantStderr, fmt.Sprintf("[job_%d] no newline", j.ID))
+	}
+	for name, tc := range map[string]struct {
+		got  *bytes.Buffer
+		want []string
+	}{"stdout": {stdout, wantStdout}, "stderr": {stderr, wantStderr}} {
+		lines := strings.Split(strings.TrimSuffix(tc.got.String(), "\n"), "\n")
+		sort.Strings(lines)
+		if !reflect.DeepEqual(lines, tc.want) {
+			t.Errorf("expected streamed %s lines %q, got %q", name, tc.want, lines)
+		}
+	}
+	got, err := ioutil.ReadFile(j1.StdoutLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("job %d line 1\njob %d line 2\njob %d line 3\n", j1.ID, j1.ID, j1.ID); string(got) != want {
+		t.Errorf("expected stdout log %q while streaming, got %q", want, string(got))
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "DryRun")
+	wf.DryRun = true
+	out := &bytes.Buffer{}
+	wf.stdout = out
+	a := newJob(wf, []string{"out"}, []*Job{}, []string{}, false, "echo a > out/a")
+	b := newJob(wf, []string{}, []*Job{a}, []string{}, false, "cat out/a")
+	c := newJob(wf, []string{"out", "c"}, []*Job{a, b}, []string{}, false, "echo c")
+	wf.AddJob(c)
+	expectZero(t, wf.Run())
+
+	want := fmt.Sprintf(`Plan: 3 jobs
+job_id:1
+  cmd: echo a > out/a
+  directories: %[1]s/out
+  dependencies: none
+job_id:2
+  cmd: cat out/a
+  directories: none
+  dependencies: 1
+job_id:3
+  cmd: echo c
+  directories: %[1]s/out, %[1]s/c
+  dependencies: 1, 2
+`, wf.WorkflowDir)
+	if out.String() != want {
+		t.Errorf("expected plan:\n%s\ngot:\n%s", want, out.String())
+	}
+	if exists, _ := fileExists(wf.EventDBPath); exists {
+		t.Error("expected dry run not to create the event db")
+	}
+	if exists, _ := fileExists(wf.pathToWDir("out")); exists {
+		t.Error("expected dry run not to create job directories")
+	}
+}
+
+func TestJobWorkDir(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "JobWorkDir")
+	inWorkDir := newJob(wf, []string{}, []*Job{}, []string{"pwd.out"}, false, "pwd > pwd.out")
+	inWorkDir.WorkDir = "nested/work"
+	inWfDir := newJob(wf, []string{}, []*Job{}, []string{"pwd.out"}, false, "pwd > pwd.out")
+	wf.AddJob(inWorkDir, inWfDir)
+	expectZero(t, wf.Run())
+
+	for _, tc := range []struct {
+		job  *Job
+		want string
+	}{
+		{inWorkDir, wf.pathToWDir("nested", "work")},
+		{inWfDir, wf.WorkflowDir},
+	} {
+		pwd, err := ioutil.ReadFile(path.Join(tc.want, "pwd.out"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSpace(string(pwd)); got != tc.want {
+			t.Errorf("expected job_id:%d to run in %s, ran in %s", tc.job.ID, tc.want, got)
+		}
+		if !tc.job.checkOutputs() {
+			t.Errorf("expected job_id:%d output relative to %s to exist", tc.job.ID, tc.want)
+		}
+	}
+}
+
+func TestMissingOutputs(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "MissingOutputs")
+	wf.KeepGoing = true
+	missing := newJob(wf, []string{}, []*Job{}, []string{"made.txt", "never.txt"}, false, "echo made > made.txt")
+	empty := newJob(wf, []string{}, []*Job{}, []string{"empty.txt"}, false, "touch empty.txt")
+	empty.OutputsNonEmpty = true
+	produced := newJob(wf, []string{}, []*Job{}, []string{"full.txt"}, false, "echo full > full.txt")
+	produced.OutputsNonEmpty = true
+	wf.AddJob(missing, empty, produced)
+	expectNonZero(t, wf.Run())
+
+	testCases := []struct {
+		job        *Job
+		wantStatus string
+		wantReason string
+	}{
+		{missing, StatusFailed, "missing output: " + wf.pathToWDir("never.txt")},
+		{empty, StatusFailed, "empty output: " + wf.pathToWDir("empty.txt")},
+		{produced, StatusSucceeded, ""},
+	}
+	for _, tc := range testCases {
+		if tc.job.Status != tc.wantStatus || tc.job.Reason != tc.wantReason {
+			t.Errorf("expected job_id:%d to be %s '%s', got %s '%s'",
+				tc.job.ID, tc.wantStatus, tc.wantReason, tc.job.Status, tc.job.Reason)
+		}
+	}
+}
+
+func TestJobTiming(t *testing.T) {
+	defer cleanTestData(t)
+	wf := testWorkflow(t, "JobTiming")
+	a := newJob(wf, []string{}, []*Job{}, []string{}, false, "sleep 0.05")
+	b := newJob(wf, []string{}, []*Job{a}, []string{}, true, "sleep 0.05; exit 3")
+	wf.AddJob(b)
+	expectNonZero(t, wf.Run())
+
+	wfJSON, err := ioutil.ReadFile(wf.WFJsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written Workflow
+	if err := json.Unmarshal(wfJSON, &written); err != nil {
+		t.Fatal(err)
+	}
+	gotB := written.Jobs[0]
+	gotA := gotB.Dependencies[0]
+	for _, tc := range []struct {
+		job      *Job
+		exitCode int
+	}{{gotA, 0}, {gotB, 3}} {
+		j := tc.job
+		if j.StartedAt == nil || j.FinishedAt == nil {
+			t.Fatalf("expected job_id:%d to record start and finish times", j.ID)
+		}
+		wallDuration := j.FinishedAt.Sub(*j.StartedAt)
+		if j.Duration.Duration <= 0 || j.Duration.Duration-wallDuration > time.Millisecond ||
+			wallDuration-j.Duration.Duration > time.Millisecond {
+			t.Errorf("expected job_id:%d to have a positive duration matching its times, got %v", j.ID, j.Duration)
+		}
+		if j.ExitCode != tc.exitCode || j.Attempts != 1 {
+			t.Errorf("expected job_id:%d to exit %d after 1 attempt, got exit %d after %d",
+				j.ID, tc.exitCode, j.ExitCode, j.Attempts)
+		}
+	}
+	if gotB.StartedAt.Before(*gotA.FinishedAt) {
+		t.Errorf("expected job_id:%d to start after job_id:%d finished", gotB.ID, gotA.ID)
+	}
+}
+
+func TestStateDir(t *testing.T) {
+	defer cleanTestData(t)
+	yamlPath := writeTestYaml(t, "StateDir/wf", `
+workflow_dir: .
+state_dir: ../state
+jobs:
+- name: build
+  cmd: echo built
+`)
+	stateDir := path.Join(OutputDir, "StateDir", "override")
+	testCases := []struct {
+		name     string
+		stateDir string
+		want     string
+	}{
+		{"Yaml", "", path.Join(OutputDir, "StateDir", "state")},
+		{"Override", stateDir, stateDir},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wf, err := workflowFromYamlVars(yamlPath, "", tc.stateDir, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectZero(t, wf.Run())
+			want, err := filepath.Abs(tc.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wf.StateDir != want {
+				t.Errorf("expected state dir %s, got %s", want, wf.StateDir)
+			}
+			for _, p := range []string{"wf.json", "event.db", "history.json", "run-report.json", "log/job_1.stdout.log", "exec", "tmp"} {
+				if _, err := os.Stat(path.Join(want, p)); err != nil {
+					t.Errorf("expected %s in the state dir: %v", p, err)
+				}
+			}
+			if _, err := os.Stat(wf.pathToWDir(".gflow")); !os.IsNotExist(err) {
+				t.Errorf("expected no .gflow dir in the workflow dir, got %v", err)
+			}
+			loaded, err := (&Command{StateDir: want}).loadWorkflowJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded.StateDir != want || len(loaded.Jobs) != 1 {
+				t.Errorf("expected to read back the workflow json from the state dir, got %+v", loaded)
+			}
+		})
+	}
+}
+
+func TestRelativeWorkflowDir(t *testing.T) {
+	defer cleanTestData(t)
+	yamlPath := writeTestYaml(t, "RelativeWorkflowDir", `
+workflow_dir: run
+jobs:
+- cmd: echo hello
+`)
+	yamlDir, err := filepath.Abs(path.Dir(yamlPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	elsewhere := path.Join(yamlDir, "elsewhere")
+	if err := os.MkdirAll(elsewhere, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(elsewhere); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+
+	testCases := []struct {
+		name        string
+		yamlPath    string
+		workflowDir string
+		expected    string
+	}{
+		{"RelativeToYaml", "../workflow.yaml", "", path.Join(yamlDir, "run")},
+		{"AbsoluteYamlPath", path.Join(yamlDir, "workflow.yaml"), "", path.Join(yamlDir, "run")},
+		{"OverrideRelativeToCwd", "../workflow.yaml", "override", path.Join(elsewhere, "override")},
+		{"AbsoluteOverride", "../workflow.yaml", path.Join(yamlDir, "abs"), path.Join(yamlDir, "abs")},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wf, err := workflowFromYaml(tc.yamlPath, tc.workflowDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wf.WorkflowDir != tc.expected {
+				t.Errorf("expected workflow dir %s, got %s", tc.expected, wf.WorkflowDir)
+			}
+		})
+	}
+}
+
+func TestUnwritableWorkflowDir(t *testing.T) {
+	defer cleanTestData(t)
+	parent, err := filepath.Abs(path.Join(OutputDir, "UnwritableWorkflowDir"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if os.Geteuid() != 0 {
+		readOnly := path.Join(parent, "readonly")
+		if err := os.Mkdir(readOnly, 0555); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Chmod(readOnly, 0755)
+		wfDir := path.Join(readOnly, "wf")
+		_, err = newWorkflow(wfDir)
+		if err == nil || !strings.HasPrefix(err.Error(), "workflow dir "+wfDir+" is not writable: ") ||
+			!strings.Contains(err.Error(), "permission denied") {
+			t.Errorf("expected an error naming the workflow dir in a read-only dir, got %v", err)
+		}
+	}
+
+	file := path.Join(parent, "file")
+	if err := ioutil.WriteFile(file, []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	wfDir := path.Join(file, "wf")
+	_, err = newWorkflow(wfDir)
+	if want := "workflow dir " + wfDir + " is not writable: " + file + " is not a directory"; err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+
+	wf := testWorkflow(t, "UnwritableWorkflowDir")
+	wf.AddJob(newJob(wf, []string{}, []*Job{}, []string{}, false, "true"))
+	gflowDir := path.Dir(wf.ExecDir)
+	if err := os.RemoveAll(gflowDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(gflowDir, []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = wf.Validate()
+	if want := "workflow dir " + gflowDir + " is not writable: " + gflowDir + " is not a directory"; err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+	if status := wf.Run(); status != ExitInvalidWorkflow {
+		t.Errorf("expected exit %d, wf exited %d", ExitInvalidWorkflow, status)
+	}
+}
+
+func TestWorkflowFromStdin(t *testing.T) {
+	defer cleanTestData(t)
+	defer func(r io.Reader) { stdin = r }(stdin)
+	stdin = strings.NewReader(`
+workflow_dir: testoutput/WorkflowFromStdin
+jobs:
+- cmd: echo from stdin > out.txt
+  outputs: [ out.txt ]
+`)
+	status, err := RunFromYaml("-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectZero(t, status)
+	got, err := ioutil.ReadFile(path.Join(OutputDir, "WorkflowFromStdin", "out.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "from stdin\n" {
+		t.Errorf("expected the workflow read from stdin to run, got %q", string(got))
+	}
+
+	_, err = workflowFromReader(strings.NewReader("jobs:\n- cmd: true\n"), "", "", nil)
+	if err == nil {
+		t.Error("expected an error for yaml from a reader without a workflow_dir")
+	}
+	wf, err := workflowFromReader(strings.NewReader("jobs:\n- cmd: true\n"), path.Join(OutputDir, "WorkflowFromStdin"), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectZero(t, wf.Run())
+}
+
+func TestDirAndFileModes(t *testing.T) {
+	defer cleanTestData(t)
+	oldMask := syscall.Umask(022)
+	defer syscall.Umask(oldMask)
+	yamlPath := writeTestYaml(t, "DirAndFileModes", `
+workflow_dir: .
+dir_mode: "0700"
+file_mode: "0600"
+jobs:
+- cmd: echo hello
+  directories: [build/out]
+`)
+	wf, err := workflowFromYaml(yamlPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectZero(t, wf.Run())
+
+	j := wf.Jobs[0]
+	want := map[string]os.FileMode{
+		path.Dir(wf.ExecDir):          0700,
+		wf.ExecDir:                    0700,
+		wf.LogDir:                     0700,
+		j.pathToExec():                0700,
+		j.pathToTmp():                 0700,
+		wf.pathToWDir("build"):        0700,
+		wf.pathToWDir("build", "out"): 0700,
+		j.pathToExec("exe"):           0700,
+		j.StdoutLog:                   0600,
+		j.StderrLog:                   0600,
+		wf.WFJsonPath:                 0600,
+		wf.EventDBPath:                0600,
+	}
+	for p, mode := range want {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != mode {
+			t.Errorf("expected %s to have mode %04o, got %04o", p, mode, info.Mode().Perm())
+		}
+	}
+
+	_, err = workflowFromYaml(writeTestYaml(t, "InvalidMode", `
+workflow_dir: .
+dir_mode: "0799"
+jobs:
+- cmd: echo hello
+`), "")
+	if err == nil {
+		t.Error("expected an error loading a workflow with an invalid dir_mode")
+	}
+}